@@ -63,7 +63,8 @@ type Message struct {
 	Content   string   `json:"content"`
 	Extra     any      `json:"extra,omitempty"`
 	Timestamp FlexTime `json:"timestamp"`
-	Client    string   `json:"client,omitempty"` // 发送端：web / android / cli / webhook
+	Client    string   `json:"client,omitempty"`   // 发送端：web / android / cli / webhook
+	Priority  string   `json:"priority,omitempty"` // 优先级：min / low / high / urgent，默认优先级省略
 }
 
 func main() {
@@ -85,7 +86,8 @@ func main() {
 
 	// 命令行参数（订阅模式）
 	broker := flag.String("broker", "tcp://localhost:9091", "MQTT Broker 地址")
-	topic := flag.String("topic", "notice/#", "订阅的主题")
+	topic := flag.String("topic", "notice/#", "订阅的主题，支持共享订阅 $share/<group>/<topic>")
+	group := flag.String("group", "", "共享订阅组：同组的多个实例分摊消息，每条消息只由其中一个处理")
 	clientID := flag.String("id", "cli-client", "客户端 ID")
 	authToken := flag.String("token", "", "认证 Token (可选)")
 	execCmd := flag.String("exec", "", "收到消息时执行的命令 (消息通过环境变量和stdin传递)")
@@ -94,9 +96,17 @@ func main() {
 	// 保存到全局变量供 handleMessage 使用
 	globalExecCmd = *execCmd
 
+	subTopic := subscribeTopic(*topic, *group)
+
 	log.Printf("启动 Notice Client...")
 	log.Printf("连接到: %s", *broker)
-	log.Printf("订阅主题: %s", *topic)
+	log.Printf("订阅主题: %s", subTopic)
+	if isSharedTopic(subTopic) {
+		log.Printf("共享订阅: 同组实例分摊消息，每个实例需使用不同的 -id")
+		if *clientID == "cli-client" {
+			log.Printf("警告: 使用默认客户端 ID，同组的其他实例连接时会互相踢下线")
+		}
+	}
 	if globalExecCmd != "" {
 		log.Printf("消息处理命令: %s", globalExecCmd)
 	}
@@ -135,11 +145,11 @@ func main() {
 		log.Println("已连接到 MQTT Broker")
 
 		// 订阅主题（会话恢复时订阅已存在，但仍需注册处理函数）
-		token := c.Subscribe(*topic, 1, nil) // 使用 nil，消息由 DefaultPublishHandler 处理
+		token := c.Subscribe(subTopic, 1, nil) // 使用 nil，消息由 DefaultPublishHandler 处理
 		if token.Wait() && token.Error() != nil {
 			log.Printf("订阅失败: %v", token.Error())
 		} else {
-			log.Printf("已订阅: %s", *topic)
+			log.Printf("已订阅: %s", subTopic)
 		}
 	})
 
@@ -176,6 +186,21 @@ func main() {
 	log.Println("已断开连接")
 }
 
+// subscribeTopic 根据 -group 生成共享订阅主题；-topic 已是共享订阅时保持不变
+func subscribeTopic(topic, group string) string {
+	topic = strings.TrimSpace(topic)
+	group = strings.TrimSpace(group)
+	if group == "" || isSharedTopic(topic) {
+		return topic
+	}
+	return "$share/" + group + "/" + topic
+}
+
+// isSharedTopic 是否为共享订阅主题 $share/<group>/<topic>
+func isSharedTopic(topic string) bool {
+	return strings.HasPrefix(topic, "$share/")
+}
+
 // handleMessage 处理接收到的消息
 func handleMessage(topic string, payload []byte) {
 	log.Printf("收到消息 [%s]: %s", topic, string(payload))
@@ -194,7 +219,10 @@ func handleMessage(topic string, payload []byte) {
 	if msg.Client != "" {
 		title = fmt.Sprintf("[%s] %s", msg.Client, title)
 	}
-	showNotification(title, msg.Content)
+	// 最低优先级只记录日志，不打扰用户
+	if msg.Priority != "min" {
+		showNotification(title, msg.Content, msg.Priority)
+	}
 
 	// 执行外部命令
 	if globalExecCmd != "" {
@@ -204,7 +232,7 @@ func handleMessage(topic string, payload []byte) {
 
 // executeCommand 执行外部命令
 // 消息通过以下方式传递:
-// - 环境变量: NOTICE_TOPIC, NOTICE_TITLE, NOTICE_CONTENT, NOTICE_EXTRA, NOTICE_TIMESTAMP, NOTICE_RAW, NOTICE_CLIENT(可选)
+// - 环境变量: NOTICE_TOPIC, NOTICE_TITLE, NOTICE_CONTENT, NOTICE_EXTRA, NOTICE_TIMESTAMP, NOTICE_RAW, NOTICE_CLIENT(可选), NOTICE_PRIORITY
 // - stdin: 原始 JSON 消息
 func executeCommand(cmdStr, topic string, payload []byte, msg *Message) {
 	// 解析命令（支持带参数的命令）
@@ -227,6 +255,11 @@ func executeCommand(cmdStr, topic string, payload []byte, msg *Message) {
 	if msg.Client != "" {
 		cmd.Env = append(cmd.Env, "NOTICE_CLIENT="+msg.Client)
 	}
+	priority := msg.Priority
+	if priority == "" {
+		priority = "default"
+	}
+	cmd.Env = append(cmd.Env, "NOTICE_PRIORITY="+priority)
 
 	// Extra 字段转为 JSON 字符串
 	if msg.Extra != nil {
@@ -313,6 +346,7 @@ func runSend(args []string) error {
 	content := fs.String("content", "", "消息内容（必填）")
 	title := fs.String("title", "CLI", "消息标题")
 	client := fs.String("client", "cli", "发送端标识")
+	priority := fs.String("priority", "", "可选：优先级 min / low / default / high / urgent")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
@@ -334,6 +368,9 @@ func runSend(args []string) error {
 	if *topic != "" {
 		body["topic"] = *topic
 	}
+	if *priority != "" {
+		body["priority"] = *priority
+	}
 	raw, err := json.Marshal(body)
 	if err != nil {
 		return err
@@ -8,9 +8,13 @@ import (
 	"github.com/gen2brain/beeep"
 )
 
-// showNotification 在非 Windows 平台显示系统通知
-func showNotification(title, content string) {
-	if err := beeep.Notify(title, content, ""); err != nil {
+// showNotification 在非 Windows 平台显示系统通知，高优先级和紧急消息带提示音
+func showNotification(title, content, priority string) {
+	notify := beeep.Notify
+	if priority == "high" || priority == "urgent" {
+		notify = beeep.Alert
+	}
+	if err := notify(title, content, ""); err != nil {
 		log.Printf("显示通知失败: %v", err)
 	}
 }
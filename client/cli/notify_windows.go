@@ -8,13 +8,16 @@ import (
 	toast "git.sr.ht/~jackmordaunt/go-toast"
 )
 
-// showNotification 在 Windows 上显示 Toast 通知
-func showNotification(title, content string) {
+// showNotification 在 Windows 上显示 Toast 通知，紧急消息常驻直到用户处理
+func showNotification(title, content, priority string) {
 	n := toast.Notification{
 		AppID: "Notice CLI",
 		Title: title,
 		Body:  content,
 	}
+	if priority == "urgent" {
+		n.Duration = toast.Long
+	}
 
 	if err := n.Push(); err != nil {
 		log.Printf("显示通知失败: %v", err)
@@ -0,0 +1,90 @@
+package broker
+
+import (
+	mqtt "github.com/mochi-mqtt/server/v2"
+
+	"notice-server/logger"
+	"notice-server/store"
+)
+
+// BatchItem 批量发布中的一条消息
+type BatchItem struct {
+	Topic   string
+	Message Message
+	Charge  func() error // 确定发布前调用（如扣除发布限额），返回错误时不发布；被合并的重复消息不调用，可为 nil
+}
+
+// BatchResult 批量发布中一条消息的结果
+type BatchResult struct {
+	ID         uint64 // 消息历史中的 ID（启用存储时）；被合并时为窗口内首条消息的 ID
+	Suppressed bool   // 是否作为重复消息被合并（未发布）
+	Repeats    int    // 窗口内已合并的重复次数
+	Err        error
+}
+
+// PublishBatch 批量发布消息，结果与 items 一一对应
+// 启用重复消息合并时逐条经 PublishDedup 发布；否则以一次批量写入保存全部消息后逐条下发，
+// 与 Publish 相同，保存失败时仍然下发（ID 为 0）
+func (b *Broker) PublishBatch(items []BatchItem) []BatchResult {
+	results := make([]BatchResult, len(items))
+	if _, ok := b.server.Clients.Get(mqtt.InlineClientId); !ok {
+		for i := range results {
+			results[i].Err = mqtt.ErrInlineClientNotEnabled
+		}
+		return results
+	}
+
+	if b.dedup != nil {
+		for i, item := range items {
+			r, err := b.dedup.publish(item.Topic, item.Message, item.Charge)
+			results[i] = BatchResult{ID: r.ID, Suppressed: r.Suppressed, Repeats: r.Repeats, Err: err}
+		}
+		return results
+	}
+
+	// 扣除失败的消息不发布
+	var publish []int
+	for i, item := range items {
+		if err := callCharge(item.Charge); err != nil {
+			results[i].Err = err
+			continue
+		}
+		publish = append(publish, i)
+	}
+
+	topics := make([]string, len(items))
+	for _, i := range publish {
+		topics[i] = items[i].Message.Priority.topic(items[i].Topic, b.config.PriorityTopics)
+	}
+
+	if b.storeManager != nil && b.storeManager.IsEnabled() && len(publish) > 0 {
+		msgs := make([]*store.Message, len(publish))
+		for j, i := range publish {
+			msg := items[i].Message
+			msgs[j] = &store.Message{
+				Topic:     topics[i],
+				Title:     msg.Title,
+				Content:   msg.Content,
+				Extra:     msg.Extra,
+				Priority:  string(msg.Priority),
+				GroupKey:  msg.GroupKey,
+				Tags:      msg.Tags,
+				Key:       msg.Key,
+				Publisher: msg.Publisher,
+			}
+		}
+		saved, err := b.storeManager.SaveMessages(b.config.AuthToken, msgs)
+		if err != nil {
+			logger.Warn("消息批量保存失败", "count", len(msgs), "error", err)
+		} else if saved != nil {
+			for j, i := range publish {
+				items[i].Message.ID = saved[j].ID
+			}
+		}
+	}
+
+	for _, i := range publish {
+		results[i] = BatchResult{ID: items[i].Message.ID, Err: b.publishMessage(topics[i], items[i].Message)}
+	}
+	return results
+}
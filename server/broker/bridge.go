@@ -0,0 +1,869 @@
+package broker
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+
+	"notice-server/logger"
+)
+
+// 桥接方向
+const (
+	BridgeIn   = "in"   // 上游 -> 本地
+	BridgeOut  = "out"  // 本地 -> 上游
+	BridgeBoth = "both" // 双向
+)
+
+const (
+	bridgeQueueSize   = 1024             // 出站队列长度，断线期间的消息在此排队
+	bridgeMaxInflight = 1024             // 出站未确认消息上限
+	bridgeDialTimeout = 10 * time.Second // 连接及 CONNACK 超时
+	bridgeEchoWindow  = 30 * time.Second // MQTT 3.1.1 回环检测窗口
+)
+
+// BridgeConfig 上游 MQTT broker 桥接配置
+type BridgeConfig struct {
+	Name            string        // 桥接名称，用于日志和防环标记，默认为上游地址
+	Address         string        // 上游地址 host:port
+	TLS             bool          // 是否使用 TLS 连接
+	ClientID        string        // 连接上游使用的 Client ID，默认 notice-bridge-<name>
+	Username        string        // 上游用户名
+	Password        string        // 上游密码
+	ProtocolVersion byte          // MQTT 协议版本：4 (3.1.1) 或 5，默认 4
+	Keepalive       uint16        // 心跳间隔（秒），默认 60
+	CleanSession    bool          // 是否使用 clean session
+	RetryMin        int           // 重连最小间隔（秒），默认 1
+	RetryMax        int           // 重连最大间隔（秒），默认 60
+	Topics          []BridgeTopic // 主题映射
+}
+
+// BridgeTopic 桥接主题映射
+// 本地主题 = LocalPrefix + 相对主题，上游主题 = RemotePrefix + 相对主题，Filter 匹配相对主题
+type BridgeTopic struct {
+	Filter       string // 主题过滤器，默认 #
+	Direction    string // 方向：in / out / both，默认 both
+	Qos          byte   // 订阅上游和转发到上游使用的 QoS
+	LocalPrefix  string // 本地主题前缀
+	RemotePrefix string // 上游主题前缀
+}
+
+func (t BridgeTopic) inbound() bool {
+	return t.Direction == BridgeIn || t.Direction == BridgeBoth
+}
+
+func (t BridgeTopic) outbound() bool {
+	return t.Direction == BridgeOut || t.Direction == BridgeBoth
+}
+
+// BridgeStatus 桥接状态
+type BridgeStatus struct {
+	Name        string     `json:"name"`
+	Address     string     `json:"address"`
+	Connected   bool       `json:"connected"`
+	ConnectedAt *time.Time `json:"connected_at,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	Received    int64      `json:"received"`  // 上游 -> 本地转发数
+	Forwarded   int64      `json:"forwarded"` // 本地 -> 上游转发数
+	Dropped     int64      `json:"dropped"`   // 队列满或未确认过多而丢弃的消息数
+}
+
+// bridge 作为客户端连接上游 broker，按主题映射双向转发消息
+//
+// 防环：
+//   - 转入本地的消息带有用户属性 bridge=<name>，不会再被同一桥接转发回上游
+//   - MQTT 5 订阅上游时使用 No Local，上游不会把本桥接发布的消息发回
+//   - MQTT 3.1.1 没有 No Local，丢弃短时间内刚转发到上游的相同主题和负载
+type bridge struct {
+	broker *Broker
+	cfg    BridgeConfig
+	out    chan packets.Packet
+	stop   chan struct{}
+	done   chan struct{}
+
+	wmu  sync.Mutex // 串行化写入
+	conn net.Conn
+
+	mu          sync.Mutex
+	packetID    uint16
+	inflight    map[uint16]packets.Packet // 出站未确认的 PUBLISH / PUBREL，重连后重发
+	received    map[uint16]bool           // 入站 QoS 2 已收到、等待 PUBREL 的 packet id
+	echoes      map[uint64]time.Time      // 最近转发到上游的消息
+	connected   bool
+	connectedAt time.Time
+	lastError   string
+
+	receivedCount  atomic.Int64
+	forwardedCount atomic.Int64
+	droppedCount   atomic.Int64
+}
+
+// newBridge 创建桥接并补全默认值
+func newBridge(b *Broker, cfg BridgeConfig) (*bridge, error) {
+	if cfg.Address == "" {
+		return nil, errors.New("桥接缺少上游地址")
+	}
+	if cfg.Name == "" {
+		cfg.Name = cfg.Address
+	}
+	if strings.ContainsAny(cfg.Name, "/+#") {
+		return nil, fmt.Errorf("桥接名称不能包含 / + #: %s", cfg.Name)
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = "notice-bridge-" + cfg.Name
+	}
+	if cfg.ProtocolVersion == 0 {
+		cfg.ProtocolVersion = 4
+	}
+	if cfg.ProtocolVersion != 4 && cfg.ProtocolVersion != 5 {
+		return nil, fmt.Errorf("桥接 %s: 不支持的协议版本 %d", cfg.Name, cfg.ProtocolVersion)
+	}
+	if cfg.Keepalive == 0 {
+		cfg.Keepalive = 60
+	}
+	if cfg.RetryMin <= 0 {
+		cfg.RetryMin = 1
+	}
+	if cfg.RetryMax < cfg.RetryMin {
+		cfg.RetryMax = max(60, cfg.RetryMin)
+	}
+	if len(cfg.Topics) == 0 {
+		return nil, fmt.Errorf("桥接 %s: 未配置主题映射", cfg.Name)
+	}
+
+	topics := make([]BridgeTopic, len(cfg.Topics))
+	for i, t := range cfg.Topics {
+		if t.Filter == "" {
+			t.Filter = "#"
+		}
+		if t.Direction == "" {
+			t.Direction = BridgeBoth
+		}
+		if !t.inbound() && !t.outbound() {
+			return nil, fmt.Errorf("桥接 %s: 无效的方向 %q", cfg.Name, t.Direction)
+		}
+		if t.Qos > 2 {
+			return nil, fmt.Errorf("桥接 %s: 无效的 QoS %d", cfg.Name, t.Qos)
+		}
+		if !mqtt.IsValidFilter(t.LocalPrefix+t.Filter, false) || !mqtt.IsValidFilter(t.RemotePrefix+t.Filter, false) {
+			return nil, fmt.Errorf("桥接 %s: 无效的主题过滤器 %q", cfg.Name, t.Filter)
+		}
+		topics[i] = t
+	}
+	cfg.Topics = topics
+
+	return &bridge{
+		broker:   b,
+		cfg:      cfg,
+		out:      make(chan packets.Packet, bridgeQueueSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+		inflight: make(map[uint16]packets.Packet),
+		received: make(map[uint16]bool),
+		echoes:   make(map[uint64]time.Time),
+	}, nil
+}
+
+// run 保持与上游的连接，断开后按指数退避重连
+func (c *bridge) run() {
+	defer close(c.done)
+
+	minDelay := time.Duration(c.cfg.RetryMin) * time.Second
+	maxDelay := time.Duration(c.cfg.RetryMax) * time.Second
+	delay := minDelay
+	for {
+		connected, err := c.session()
+		if c.stopped() {
+			return
+		}
+		if connected {
+			delay = minDelay
+		}
+		c.setError(err)
+		logger.Warn("MQTT 桥接断开，等待重连", "bridge", c.cfg.Name, "error", err, "retry_in", delay.String())
+
+		select {
+		case <-time.After(delay):
+		case <-c.stop:
+			return
+		}
+		delay = min(delay*2, maxDelay)
+	}
+}
+
+// close 断开与上游的连接并停止重连
+func (c *bridge) close() {
+	close(c.stop)
+	<-c.done
+}
+
+func (c *bridge) stopped() bool {
+	select {
+	case <-c.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// session 建立一次连接并处理消息，直到断开；返回是否曾连接成功
+func (c *bridge) session() (bool, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	present, err := c.handshake(conn, r)
+	if err != nil {
+		return false, err
+	}
+
+	c.wmu.Lock()
+	c.conn = conn
+	c.wmu.Unlock()
+	c.setConnected(true)
+	defer func() {
+		c.wmu.Lock()
+		c.conn = nil
+		c.wmu.Unlock()
+		c.setConnected(false)
+	}()
+	logger.Info("MQTT 桥接已连接", "bridge", c.cfg.Name, "address", c.cfg.Address)
+
+	if err := c.subscribe(); err != nil {
+		return true, err
+	}
+	if err := c.resend(present); err != nil {
+		return true, err
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.readLoop(conn, r)
+	}()
+
+	ping := time.NewTicker(time.Duration(c.cfg.Keepalive) * time.Second)
+	defer ping.Stop()
+
+	for {
+		select {
+		case pk := <-c.out:
+			if err := c.publish(pk); err != nil {
+				return true, err
+			}
+		case <-ping.C:
+			if err := c.write(packets.Packet{FixedHeader: packets.FixedHeader{Type: packets.Pingreq}}); err != nil {
+				return true, err
+			}
+		case err := <-errCh:
+			return true, err
+		case <-c.stop:
+			_ = c.write(packets.Packet{FixedHeader: packets.FixedHeader{Type: packets.Disconnect}})
+			return true, nil
+		}
+	}
+}
+
+// dial 连接上游
+func (c *bridge) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: bridgeDialTimeout}
+	if c.cfg.TLS {
+		host, _, _ := net.SplitHostPort(c.cfg.Address)
+		return tls.DialWithDialer(dialer, "tcp", c.cfg.Address, &tls.Config{ServerName: host})
+	}
+	return dialer.Dial("tcp", c.cfg.Address)
+}
+
+// handshake 发送 CONNECT 并等待 CONNACK，返回上游是否保留了会话
+func (c *bridge) handshake(conn net.Conn, r *bufio.Reader) (bool, error) {
+	pk := packets.Packet{
+		FixedHeader:     packets.FixedHeader{Type: packets.Connect},
+		ProtocolVersion: c.cfg.ProtocolVersion,
+		Connect: packets.ConnectParams{
+			ProtocolName:     []byte("MQTT"),
+			ClientIdentifier: c.cfg.ClientID,
+			Clean:            c.cfg.CleanSession,
+			Keepalive:        c.cfg.Keepalive,
+			UsernameFlag:     c.cfg.Username != "",
+			Username:         []byte(c.cfg.Username),
+			PasswordFlag:     c.cfg.Password != "",
+			Password:         []byte(c.cfg.Password),
+		},
+	}
+	if c.cfg.ProtocolVersion == 5 {
+		// 告知上游不要发送超过本地上限的报文
+		pk.Properties.MaximumPacketSize = c.broker.maxPacketSize()
+	}
+	if c.cfg.ProtocolVersion == 5 && !c.cfg.CleanSession {
+		// MQTT 5 中会话保留时长由属性决定，与本地会话过期时间一致
+		pk.Properties.SessionExpiryInterval = c.broker.config.SessionExpiry
+		pk.Properties.SessionExpiryIntervalFlag = true
+	}
+
+	conn.SetDeadline(time.Now().Add(bridgeDialTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	if err := writePacket(conn, pk); err != nil {
+		return false, err
+	}
+	ack, err := readPacket(r, c.cfg.ProtocolVersion, c.broker.maxPacketSize())
+	if err != nil {
+		return false, err
+	}
+	if ack.FixedHeader.Type != packets.Connack {
+		return false, fmt.Errorf("期望 CONNACK，收到报文类型 %d", ack.FixedHeader.Type)
+	}
+	if ack.ReasonCode != packets.CodeSuccess.Code {
+		return false, fmt.Errorf("上游拒绝连接: 0x%02x", ack.ReasonCode)
+	}
+	return ack.SessionPresent, nil
+}
+
+// subscribe 订阅入站方向的主题
+func (c *bridge) subscribe() error {
+	pk := packets.Packet{
+		FixedHeader: packets.FixedHeader{Type: packets.Subscribe, Qos: 1},
+	}
+	for _, t := range c.cfg.Topics {
+		if !t.inbound() {
+			continue
+		}
+		pk.Filters = append(pk.Filters, packets.Subscription{
+			Filter:  t.RemotePrefix + t.Filter,
+			Qos:     t.Qos,
+			NoLocal: c.cfg.ProtocolVersion == 5,
+		})
+	}
+	if len(pk.Filters) == 0 {
+		return nil
+	}
+
+	c.mu.Lock()
+	pk.PacketID = c.nextPacketID()
+	c.mu.Unlock()
+	return c.write(pk)
+}
+
+// resend 重连后按顺序处理未确认的消息
+// 上游保留了会话（CONNACK session present）时原样重发 PUBLISH / PUBREL；
+// 否则丢弃会话状态：已收到 PUBREC 的消息上游已接收，不再发送，
+// 未确认的 PUBLISH 作为新消息重新发布，入站 QoS 2 的等待记录一并清除
+func (c *bridge) resend(present bool) error {
+	c.mu.Lock()
+	ids := make([]int, 0, len(c.inflight))
+	for id := range c.inflight {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	pending := make([]packets.Packet, 0, len(ids))
+	for _, id := range ids {
+		pk := c.inflight[uint16(id)]
+		switch {
+		case present && pk.FixedHeader.Type == packets.Publish:
+			pk.FixedHeader.Dup = true
+		case !present && pk.FixedHeader.Type == packets.Pubrel:
+			delete(c.inflight, uint16(id))
+			continue
+		}
+		pending = append(pending, pk)
+	}
+	if !present {
+		clear(c.received)
+	}
+	c.mu.Unlock()
+
+	for _, pk := range pending {
+		if err := c.write(pk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readLoop 读取上游报文，直到出错或连接关闭
+func (c *bridge) readLoop(conn net.Conn, r *bufio.Reader) error {
+	timeout := time.Duration(c.cfg.Keepalive) * time.Second * 3 / 2
+	for {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		pk, err := readPacket(r, c.cfg.ProtocolVersion, c.broker.maxPacketSize())
+		if err != nil {
+			return err
+		}
+
+		switch pk.FixedHeader.Type {
+		case packets.Publish:
+			err = c.receive(pk)
+		case packets.Puback, packets.Pubcomp:
+			c.mu.Lock()
+			delete(c.inflight, pk.PacketID)
+			c.mu.Unlock()
+		case packets.Pubrec:
+			c.mu.Lock()
+			if pk.ReasonCode >= packets.ErrUnspecifiedError.Code {
+				delete(c.inflight, pk.PacketID)
+				c.mu.Unlock()
+				continue
+			}
+			rel := c.ack(packets.Pubrel, pk.PacketID)
+			c.inflight[pk.PacketID] = rel
+			c.mu.Unlock()
+			err = c.write(rel)
+		case packets.Pubrel:
+			// QoS 2 入站流程结束，packet id 可被上游复用
+			c.mu.Lock()
+			delete(c.received, pk.PacketID)
+			c.mu.Unlock()
+			err = c.write(c.ack(packets.Pubcomp, pk.PacketID))
+		case packets.Suback:
+			for _, code := range pk.ReasonCodes {
+				if code >= packets.ErrUnspecifiedError.Code {
+					logger.Warn("MQTT 桥接订阅被拒绝", "bridge", c.cfg.Name, "code", code)
+				}
+			}
+		case packets.Disconnect:
+			return fmt.Errorf("上游断开连接: 0x%02x", pk.ReasonCode)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// receive 处理上游下发的消息并确认
+func (c *bridge) receive(pk packets.Packet) error {
+	switch pk.FixedHeader.Qos {
+	case 1:
+		c.deliver(pk)
+		return c.write(c.ack(packets.Puback, pk.PacketID))
+	case 2:
+		// 重复的 QoS 2 消息只确认不转发
+		c.mu.Lock()
+		dup := c.received[pk.PacketID]
+		c.received[pk.PacketID] = true
+		c.mu.Unlock()
+		if !dup {
+			c.deliver(pk)
+		}
+		return c.write(c.ack(packets.Pubrec, pk.PacketID))
+	default:
+		c.deliver(pk)
+		return nil
+	}
+}
+
+// deliver 将上游消息按映射转入本地
+func (c *bridge) deliver(pk packets.Packet) {
+	if userProperty(pk.Properties, PropBridge) == c.cfg.Name || c.isEcho(pk) {
+		return
+	}
+
+	for _, t := range c.cfg.Topics {
+		if !t.inbound() {
+			continue
+		}
+		rel, ok := strings.CutPrefix(pk.TopicName, t.RemotePrefix)
+		if !ok || !matchTopic(t.Filter, rel) {
+			continue
+		}
+
+		topic := t.LocalPrefix + rel
+		if err := c.broker.inject(topic, pk, c.cfg.Name); err != nil {
+			logger.Warn("MQTT 桥接转入失败", "bridge", c.cfg.Name, "topic", topic, "error", err)
+			return
+		}
+		c.receivedCount.Add(1)
+		logger.Debug("MQTT 桥接转入", "bridge", c.cfg.Name, "remote", pk.TopicName, "local", topic)
+		return
+	}
+}
+
+// forward 将本地消息按映射放入出站队列
+func (c *bridge) forward(pk packets.Packet) {
+	if userProperty(pk.Properties, PropBridge) == c.cfg.Name {
+		return
+	}
+
+	for _, t := range c.cfg.Topics {
+		if !t.outbound() {
+			continue
+		}
+		rel, ok := strings.CutPrefix(pk.TopicName, t.LocalPrefix)
+		if !ok || !matchTopic(t.Filter, rel) {
+			continue
+		}
+
+		out := packets.Packet{
+			FixedHeader: packets.FixedHeader{
+				Type:   packets.Publish,
+				Qos:    t.Qos,
+				Retain: pk.FixedHeader.Retain,
+			},
+			TopicName: t.RemotePrefix + rel,
+			Payload:   pk.Payload,
+		}
+		if c.cfg.ProtocolVersion == 5 {
+			out.Properties = bridgeProperties(pk.Properties, c.cfg.Name)
+		}
+
+		select {
+		case c.out <- out:
+		default:
+			c.droppedCount.Add(1)
+			logger.Warn("MQTT 桥接队列已满，丢弃消息", "bridge", c.cfg.Name, "topic", pk.TopicName)
+		}
+		return
+	}
+}
+
+// publish 发送出站消息，QoS > 0 时记录到未确认列表
+func (c *bridge) publish(pk packets.Packet) error {
+	if pk.FixedHeader.Qos > 0 {
+		c.mu.Lock()
+		if len(c.inflight) >= bridgeMaxInflight {
+			c.mu.Unlock()
+			c.droppedCount.Add(1)
+			logger.Warn("MQTT 桥接未确认消息过多，丢弃消息", "bridge", c.cfg.Name, "topic", pk.TopicName)
+			return nil
+		}
+		pk.PacketID = c.nextPacketID()
+		c.inflight[pk.PacketID] = pk
+		c.mu.Unlock()
+	}
+
+	c.recordEcho(pk)
+	if err := c.write(pk); err != nil {
+		return err
+	}
+	c.forwardedCount.Add(1)
+	logger.Debug("MQTT 桥接转出", "bridge", c.cfg.Name, "remote", pk.TopicName)
+	return nil
+}
+
+// recordEcho 记录转发到上游的消息，用于丢弃 MQTT 3.1.1 下被发回的副本
+func (c *bridge) recordEcho(pk packets.Packet) {
+	if c.cfg.ProtocolVersion == 5 {
+		return
+	}
+
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, t := range c.echoes {
+		if now.Sub(t) > bridgeEchoWindow {
+			delete(c.echoes, k)
+		}
+	}
+	c.echoes[echoKey(pk)] = now
+}
+
+// isEcho 判断上游消息是否为本桥接刚转发出去的副本
+func (c *bridge) isEcho(pk packets.Packet) bool {
+	if c.cfg.ProtocolVersion == 5 {
+		return false
+	}
+
+	key := echoKey(pk)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.echoes[key]
+	if !ok {
+		return false
+	}
+	delete(c.echoes, key)
+	return time.Since(t) <= bridgeEchoWindow
+}
+
+// nextPacketID 分配未被占用的 packet id，调用方需持有 mu
+func (c *bridge) nextPacketID() uint16 {
+	for {
+		c.packetID++
+		if c.packetID == 0 {
+			continue
+		}
+		if _, ok := c.inflight[c.packetID]; !ok {
+			return c.packetID
+		}
+	}
+}
+
+// ack 构造 PUBACK / PUBREC / PUBREL / PUBCOMP
+func (c *bridge) ack(typ byte, id uint16) packets.Packet {
+	pk := packets.Packet{
+		FixedHeader: packets.FixedHeader{Type: typ},
+		PacketID:    id,
+	}
+	if typ == packets.Pubrel {
+		pk.FixedHeader.Qos = 1 // [MQTT-3.6.1-1]
+	}
+	return pk
+}
+
+// write 向当前连接写入报文
+func (c *bridge) write(pk packets.Packet) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.conn == nil {
+		return net.ErrClosed
+	}
+	pk.ProtocolVersion = c.cfg.ProtocolVersion
+	c.conn.SetWriteDeadline(time.Now().Add(bridgeDialTimeout))
+	return writePacket(c.conn, pk)
+}
+
+func (c *bridge) setConnected(connected bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connected = connected
+	if connected {
+		c.connectedAt = time.Now()
+		c.lastError = ""
+	}
+}
+
+func (c *bridge) setError(err error) {
+	if err == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastError = err.Error()
+}
+
+// status 获取桥接状态
+func (c *bridge) status() BridgeStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := BridgeStatus{
+		Name:      c.cfg.Name,
+		Address:   c.cfg.Address,
+		Connected: c.connected,
+		LastError: c.lastError,
+		Received:  c.receivedCount.Load(),
+		Forwarded: c.forwardedCount.Load(),
+		Dropped:   c.droppedCount.Load(),
+	}
+	if c.connected {
+		s.ConnectedAt = timePtr(c.connectedAt)
+	}
+	return s
+}
+
+// BridgeHook 将本地发布的消息转发给各桥接
+type BridgeHook struct {
+	mqtt.HookBase
+	bridges []*bridge
+}
+
+func (h *BridgeHook) ID() string {
+	return "bridge"
+}
+
+func (h *BridgeHook) Provides(b byte) bool {
+	return b == mqtt.OnPublished
+}
+
+// OnPublished 消息发布后按映射转发到上游
+func (h *BridgeHook) OnPublished(cl *mqtt.Client, pk packets.Packet) {
+	// 被其他钩子忽略（如超出发布限额）的消息未投递，也不转发
+	if pk.Ignore {
+		return
+	}
+	for _, c := range h.bridges {
+		c.forward(pk)
+	}
+}
+
+// Bridges 获取所有桥接的状态
+func (b *Broker) Bridges() []BridgeStatus {
+	list := make([]BridgeStatus, 0, len(b.bridges))
+	for _, c := range b.bridges {
+		list = append(list, c.status())
+	}
+	return list
+}
+
+// startBridges 创建并启动桥接
+func (b *Broker) startBridges() error {
+	for _, cfg := range b.config.Bridges {
+		c, err := newBridge(b, cfg)
+		if err != nil {
+			return err
+		}
+		b.bridges = append(b.bridges, c)
+	}
+	if len(b.bridges) == 0 {
+		return nil
+	}
+
+	if err := b.server.AddHook(&BridgeHook{bridges: b.bridges}, nil); err != nil {
+		return err
+	}
+	for _, c := range b.bridges {
+		go c.run()
+		logger.Info("MQTT 桥接已启用", "bridge", c.cfg.Name, "address", c.cfg.Address, "topics", len(c.cfg.Topics))
+	}
+	return nil
+}
+
+// inject 以内置客户端身份发布桥接转入的消息，标记来源桥接
+func (b *Broker) inject(topic string, pk packets.Packet, bridgeName string) error {
+	cl, ok := b.server.Clients.Get(mqtt.InlineClientId)
+	if !ok {
+		return mqtt.ErrInlineClientNotEnabled
+	}
+
+	return b.server.InjectPacket(cl, packets.Packet{
+		FixedHeader: packets.FixedHeader{
+			Type:   packets.Publish,
+			Qos:    1, // 与 Publish 一致，离线客户端也能收到
+			Retain: pk.FixedHeader.Retain,
+		},
+		TopicName:  topic,
+		Payload:    pk.Payload,
+		Properties: bridgeProperties(pk.Properties, bridgeName),
+		PacketID:   1,
+	})
+}
+
+// bridgeProperties 复制跨 broker 有意义的属性，去掉本地消息 ID 并标记来源桥接
+func bridgeProperties(in packets.Properties, bridgeName string) packets.Properties {
+	props := packets.Properties{
+		ContentType:           in.ContentType,
+		PayloadFormat:         in.PayloadFormat,
+		PayloadFormatFlag:     in.PayloadFormatFlag,
+		MessageExpiryInterval: in.MessageExpiryInterval,
+		ResponseTopic:         in.ResponseTopic,
+		CorrelationData:       in.CorrelationData,
+	}
+	for _, p := range in.User {
+		if p.Key == PropMessageID || p.Key == PropBridge {
+			continue
+		}
+		props.User = append(props.User, p)
+	}
+	props.User = append(props.User, packets.UserProperty{Key: PropBridge, Val: bridgeName})
+	return props
+}
+
+// matchTopic 判断主题是否匹配过滤器（支持 + 和 # 通配符）
+func matchTopic(filter, topic string) bool {
+	// 以通配符开头的过滤器不匹配以 $ 开头的主题 [MQTT-4.7.2-1]
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+
+	fs := strings.Split(filter, "/")
+	ts := strings.Split(topic, "/")
+	for i, f := range fs {
+		if f == "#" {
+			return true
+		}
+		if i >= len(ts) || (f != "+" && f != ts[i]) {
+			return false
+		}
+	}
+	return len(fs) == len(ts)
+}
+
+// echoKey 主题和负载的摘要
+func echoKey(pk packets.Packet) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(pk.TopicName))
+	h.Write([]byte{0})
+	h.Write(pk.Payload)
+	return h.Sum64()
+}
+
+// writePacket 编码并写入报文
+func writePacket(w io.Writer, pk packets.Packet) error {
+	var buf bytes.Buffer
+	var err error
+	switch pk.FixedHeader.Type {
+	case packets.Connect:
+		err = pk.ConnectEncode(&buf)
+	case packets.Publish:
+		err = pk.PublishEncode(&buf)
+	case packets.Puback:
+		err = pk.PubackEncode(&buf)
+	case packets.Pubrec:
+		err = pk.PubrecEncode(&buf)
+	case packets.Pubrel:
+		err = pk.PubrelEncode(&buf)
+	case packets.Pubcomp:
+		err = pk.PubcompEncode(&buf)
+	case packets.Subscribe:
+		err = pk.SubscribeEncode(&buf)
+	case packets.Pingreq:
+		err = pk.PingreqEncode(&buf)
+	case packets.Disconnect:
+		err = pk.DisconnectEncode(&buf)
+	default:
+		err = fmt.Errorf("不支持的报文类型 %d", pk.FixedHeader.Type)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// readPacket 读取并解码一个报文，maxSize 大于 0 时拒绝超过该字节数的报文，避免按上游声明的长度分配内存
+func readPacket(r *bufio.Reader, version byte, maxSize uint32) (packets.Packet, error) {
+	pk := packets.Packet{ProtocolVersion: version}
+
+	hb, err := r.ReadByte()
+	if err != nil {
+		return pk, err
+	}
+	if err := pk.FixedHeader.Decode(hb); err != nil {
+		return pk, err
+	}
+	n, _, err := packets.DecodeLength(r)
+	if err != nil {
+		return pk, err
+	}
+	pk.FixedHeader.Remaining = n
+	if maxSize > 0 && uint32(n)+1 > maxSize {
+		return pk, packets.ErrPacketTooLarge
+	}
+
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return pk, err
+	}
+
+	switch pk.FixedHeader.Type {
+	case packets.Connack:
+		err = pk.ConnackDecode(buf)
+	case packets.Publish:
+		err = pk.PublishDecode(buf)
+	case packets.Puback:
+		err = pk.PubackDecode(buf)
+	case packets.Pubrec:
+		err = pk.PubrecDecode(buf)
+	case packets.Pubrel:
+		err = pk.PubrelDecode(buf)
+	case packets.Pubcomp:
+		err = pk.PubcompDecode(buf)
+	case packets.Suback:
+		err = pk.SubackDecode(buf)
+	case packets.Disconnect:
+		err = pk.DisconnectDecode(buf)
+	}
+	return pk, err
+}
@@ -0,0 +1,253 @@
+package broker
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+func TestBridgeResend(t *testing.T) {
+	publish := func(id uint16) packets.Packet {
+		return packets.Packet{
+			FixedHeader: packets.FixedHeader{Type: packets.Publish, Qos: 1},
+			TopicName:   "notice",
+			Payload:     []byte("msg"),
+			PacketID:    id,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		present  bool
+		want     []byte // 重发的报文类型
+		dup      bool
+		inflight int
+	}{
+		{"会话保留", true, []byte{packets.Publish, packets.Pubrel, packets.Publish}, true, 3},
+		{"会话丢失", false, []byte{packets.Publish, packets.Publish}, false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := newBridge(&Broker{}, BridgeConfig{
+				Address: "127.0.0.1:1883",
+				Topics:  []BridgeTopic{{Filter: "#"}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			local, remote := net.Pipe()
+			defer remote.Close()
+			c.conn = local
+
+			c.inflight[1] = publish(1)
+			c.inflight[2] = c.ack(packets.Pubrel, 2)
+			c.inflight[3] = publish(3)
+			c.received[7] = true
+
+			errCh := make(chan error, 1)
+			go func() {
+				errCh <- c.resend(tt.present)
+				local.Close()
+			}()
+
+			r := bufio.NewReader(remote)
+			var got []byte
+			for {
+				pk, err := readPacket(r, c.cfg.ProtocolVersion, 0)
+				if err != nil {
+					break
+				}
+				got = append(got, pk.FixedHeader.Type)
+				if pk.FixedHeader.Type == packets.Publish && pk.FixedHeader.Dup != tt.dup {
+					t.Errorf("PUBLISH %d 的 DUP = %v，期望 %v", pk.PacketID, pk.FixedHeader.Dup, tt.dup)
+				}
+			}
+			if err := <-errCh; err != nil {
+				t.Fatalf("resend() error = %v", err)
+			}
+
+			if string(got) != string(tt.want) {
+				t.Errorf("重发报文类型 = %v，期望 %v", got, tt.want)
+			}
+			if len(c.inflight) != tt.inflight {
+				t.Errorf("未确认消息数 = %d，期望 %d", len(c.inflight), tt.inflight)
+			}
+			if tt.present != c.received[7] {
+				t.Errorf("入站 QoS 2 记录保留 = %v，期望 %v", c.received[7], tt.present)
+			}
+		})
+	}
+}
+
+func TestBridgeReceiveQos2(t *testing.T) {
+	c, err := newBridge(&Broker{}, BridgeConfig{
+		Address: "127.0.0.1:1883",
+		Topics:  []BridgeTopic{{Filter: "#", Direction: BridgeOut}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, remote := net.Pipe()
+	c.conn = local
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.readLoop(local, bufio.NewReader(local))
+	}()
+
+	r := bufio.NewReader(remote)
+	exchange := func(pk packets.Packet, want byte) {
+		t.Helper()
+		pk.ProtocolVersion = c.cfg.ProtocolVersion
+		if err := writePacket(remote, pk); err != nil {
+			t.Fatal(err)
+		}
+		ack, err := readPacket(r, c.cfg.ProtocolVersion, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ack.FixedHeader.Type != want || ack.PacketID != pk.PacketID {
+			t.Fatalf("收到报文 %d/%d，期望 %d/%d", ack.FixedHeader.Type, ack.PacketID, want, pk.PacketID)
+		}
+	}
+	received := func() int {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.received)
+	}
+
+	for id := uint16(1); id <= 3; id++ {
+		exchange(packets.Packet{
+			FixedHeader: packets.FixedHeader{Type: packets.Publish, Qos: 2},
+			TopicName:   "notice",
+			Payload:     []byte("msg"),
+			PacketID:    id,
+		}, packets.Pubrec)
+	}
+	if n := received(); n != 3 {
+		t.Fatalf("等待 PUBREL 的记录数 = %d，期望 3", n)
+	}
+
+	// 收到 PUBREL 后移除记录
+	for id := uint16(1); id <= 3; id++ {
+		exchange(c.ack(packets.Pubrel, id), packets.Pubcomp)
+	}
+	if n := received(); n != 0 {
+		t.Errorf("PUBCOMP 后仍有 %d 条记录", n)
+	}
+
+	remote.Close()
+	<-errCh
+}
+
+func TestReadPacketTooLarge(t *testing.T) {
+	// PUBLISH 报文声明 2 MB 的剩余长度，但没有实际内容
+	r := bufio.NewReader(bytes.NewReader([]byte{packets.Publish << 4, 0x80, 0x80, 0x80, 0x01}))
+	if _, err := readPacket(r, 4, 1<<20); !errors.Is(err, packets.ErrPacketTooLarge) {
+		t.Errorf("readPacket() error = %v，期望 %v", err, packets.ErrPacketTooLarge)
+	}
+}
+
+// waitFor 等待条件成立，超时则失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待超时: %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestBridgeUpstream 连接真实的上游 broker，验证双向 QoS 2 流程完成且消息不回环
+func TestBridgeUpstream(t *testing.T) {
+	for _, version := range []byte{4, 5} {
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			upstream := mqtt.New(&mqtt.Options{InlineClient: true})
+			addr := serveTestServer(t, upstream)
+			remote := &publishRecorder{}
+			err := upstream.Subscribe("remote/#", 1, func(cl *mqtt.Client, sub packets.Subscription, pk packets.Packet) {
+				remote.mu.Lock()
+				remote.payloads = append(remote.payloads, string(pk.Payload))
+				remote.mu.Unlock()
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			b, local := newTestBroker(t, Config{})
+			c, err := newBridge(b, BridgeConfig{
+				Name:            "up",
+				Address:         addr,
+				ProtocolVersion: version,
+				CleanSession:    true,
+				Topics:          []BridgeTopic{{Qos: 2, LocalPrefix: "local/", RemotePrefix: "remote/"}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := b.server.AddHook(&BridgeHook{bridges: []*bridge{c}}, nil); err != nil {
+				t.Fatal(err)
+			}
+			go c.run()
+			t.Cleanup(c.close)
+
+			waitFor(t, "桥接订阅上游", func() bool {
+				cl, ok := upstream.Clients.Get(c.cfg.ClientID)
+				return ok && cl.State.Subscriptions.Len() > 0
+			})
+			pending := func() int {
+				c.mu.Lock()
+				defer c.mu.Unlock()
+				return len(c.inflight) + len(c.received)
+			}
+			upstreamInflight := func() int {
+				cl, ok := upstream.Clients.Get(c.cfg.ClientID)
+				if !ok {
+					return -1
+				}
+				return cl.State.Inflight.Len()
+			}
+
+			// 上游 -> 本地
+			if err := upstream.Publish("remote/in", []byte("from-upstream"), false, 2); err != nil {
+				t.Fatal(err)
+			}
+			waitFor(t, "消息转入本地", func() bool { return local.count() == 1 })
+			waitFor(t, "入站 QoS 2 流程完成", func() bool { return pending() == 0 && upstreamInflight() == 0 })
+			if got := local.last(); got != "from-upstream" {
+				t.Errorf("本地收到 %q", got)
+			}
+
+			// 本地 -> 上游
+			if err := b.server.Publish("local/out", []byte("from-local"), false, 1); err != nil {
+				t.Fatal(err)
+			}
+			waitFor(t, "消息转出到上游", func() bool { return remote.count() == 2 })
+			waitFor(t, "出站 QoS 2 流程完成", func() bool { return pending() == 0 && upstreamInflight() == 0 })
+			if got := remote.last(); got != "from-local" {
+				t.Errorf("上游收到 %q", got)
+			}
+
+			// 转出的消息不会被上游发回本地，转入的消息也不会再转出
+			time.Sleep(100 * time.Millisecond)
+			if n := local.count(); n != 2 {
+				t.Errorf("本地收到 %d 条消息，期望 2（转入 1 条、本地发布 1 条）", n)
+			}
+			if n := remote.count(); n != 2 {
+				t.Errorf("上游收到 %d 条消息，期望 2（上游发布 1 条、转出 1 条）", n)
+			}
+			if s := c.status(); s.Received != 1 || s.Forwarded != 1 {
+				t.Errorf("转入 %d 条、转出 %d 条，期望各 1 条", s.Received, s.Forwarded)
+			}
+		})
+	}
+}
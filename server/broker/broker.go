@@ -1,9 +1,13 @@
 package broker
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"math"
+	"net/http"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	badgerdb "github.com/dgraph-io/badger/v4"
@@ -13,30 +17,69 @@ import (
 	"github.com/mochi-mqtt/server/v2/packets"
 
 	"notice-server/logger"
+	"notice-server/ratelimit"
 	"notice-server/store"
 )
 
 const (
 	// mqttStorageDir MQTT 持久化存储子目录
 	mqttStorageDir = "mqtt"
+
+	// minPacketSize MQTT 报文最大字节数的下限，负载不限制时也以此为上限
+	minPacketSize = 1 << 20
+	// packetHeadroom 负载之外留给主题和属性的字节数
+	packetHeadroom = 64 << 10
+)
+
+// 凭据标识，用于按凭据限流
+const (
+	CredentialToken = "token" // 普通 Token
+	CredentialAdmin = "admin" // 管理员 Token
 )
 
 // Message 推送消息结构
 type Message struct {
+	ID        uint64    `json:"id,omitempty"` // 消息历史中的 ID（启用存储时）
 	Title     string    `json:"title"`
 	Content   string    `json:"content"`
 	Extra     any       `json:"extra,omitempty"`
 	Timestamp time.Time `json:"timestamp"`
-	Client    string    `json:"client,omitempty"` // 发送端标识：web / android / cli / webhook
+	Client    string    `json:"client,omitempty"`    // 发送端标识：web / android / cli / webhook
+	Priority  Priority  `json:"priority,omitempty"`  // 优先级，默认优先级省略
+	GroupKey  string    `json:"group_key,omitempty"` // 去重分组键，客户端可据此折叠同组通知
+	Tags      []string  `json:"tags,omitempty"`      // 标签，可由发送端指定或由路由规则添加
+	Key       string    `json:"key,omitempty"`       // 发送方指定的稳定标识，可据此更新消息
+	Updated   bool      `json:"updated,omitempty"`   // 更新事件：客户端按 id 原地替换已显示的消息
+	Recalled  bool      `json:"recalled,omitempty"`  // 撤回事件：客户端按 id 移除或划掉已显示的消息
+	Replayed  bool      `json:"replayed,omitempty"`  // 订阅时回放的历史消息
+
+	Publisher string `json:"-"` // 发布使用的凭据名称，只写入消息历史，不随消息下发
 }
 
 // Config Broker 配置
 type Config struct {
-	SessionExpiry  uint32 // 会话过期时间（秒）
-	MessageExpiry  uint32 // 消息过期时间（秒）
-	AuthToken      string // 认证 Token，为空则不校验
-	StorageEnabled bool   // 是否启用持久化存储
-	StoragePath    string // 持久化存储路径
+	SessionExpiry  uint32            // 会话过期时间（秒）
+	MessageExpiry  uint32            // 消息过期时间（秒）
+	AuthToken      string            // 认证 Token，为空则不校验
+	AdminToken     string            // 管理员 Token，为空则 AuthToken 视为管理员
+	StorageEnabled bool              // 是否启用持久化存储
+	StoragePath    string            // 持久化存储路径
+	SysInterval    int64             // $SYS 统计发布间隔（秒），0 表示不发布
+	PresenceTopic  string            // 在线事件主题前缀，为空则不发布
+	Bridges        []BridgeConfig    // 上游 broker 桥接
+	WSPath         string            // HTTP 服务上的 WebSocket 路径，为空则不挂载
+	PriorityTopics bool              // 非默认优先级的消息发布到 <topic>/<priority>
+	DedupWindow    int               // 重复消息合并窗口（秒），0 表示不合并
+	DedupSummary   bool              // 窗口结束时发布重复次数汇总
+	Recurring      []RecurringConfig // 配置文件定义的周期消息
+	Rules          []RuleConfig      // Webhook 消息路由规则
+
+	// 客户端直接发布消息的校验
+	MaxTitleLength   int  // 标题最大长度（字符），0 表示不限制
+	MaxContentLength int  // 内容最大长度（字符），0 表示不限制
+	MaxPayloadBytes  int  // 负载最大字节数，0 表示不限制
+	StrictJSON       bool // 严格模式：只接受通知格式的 JSON
+	Truncate         bool // 超长的标题和内容截断而非拒绝
 }
 
 // Broker MQTT Broker 服务
@@ -45,19 +88,48 @@ type Broker struct {
 	topic        string
 	config       Config
 	storeManager *store.Manager
+	limiter      *ratelimit.Limiter        // 与 HTTP 共享的认证失败限流，为 nil 则不限制
+	publishLimit *ratelimit.PublishLimiter // 与 Webhook 共享的发布限流，为 nil 则不限制
+	presence     *PresenceHook
+	expirer      *expireHook   // 管理员过期在线会话
+	storageHook  *badger.Hook  // MQTT 持久化钩子，未启用时为 nil
+	delivery     *DeliveryHook // 投递回执钩子，未启用存储时为 nil
+	bridges      []*bridge
+	wsHandler    *websocketListener // 挂载到 HTTP 服务的 WebSocket 监听器，未启用时为 nil
+	scheduler    *scheduler         // 定时消息和周期消息调度器，未启用存储时为 nil
+	dedup        *deduper           // 重复消息合并，未启用时为 nil
+	editMu       sync.Mutex         // 串行化按 Key 的查找和创建，避免同一 Key 产生多条消息
+	rules        []*rule            // 路由规则，启动时解析
 }
 
 // New 创建新的 Broker
-func New(topic string, cfg Config, m *store.Manager) *Broker {
-	return &Broker{
+// l 为与 HTTP 接口共享的认证失败限流器，同一 IP 在任一入口被封禁后两边都拒绝
+// pl 为与 Webhook 共享的发布限流器，同一凭据经 HTTP 和 MQTT 发布共用额度
+func New(topic string, cfg Config, m *store.Manager, l *ratelimit.Limiter, pl *ratelimit.PublishLimiter) *Broker {
+	b := &Broker{
 		topic:        topic,
 		config:       cfg,
 		storeManager: m,
+		limiter:      l,
+		publishLimit: pl,
 	}
+	if cfg.DedupWindow > 0 {
+		b.dedup = newDeduper(b, time.Duration(cfg.DedupWindow)*time.Second, cfg.DedupSummary)
+	}
+	return b
+}
+
+// maxPacketSize MQTT 报文最大字节数，适用于本地客户端和桥接上游发来的报文
+func (b *Broker) maxPacketSize() uint32 {
+	return uint32(max(minPacketSize, b.config.MaxPayloadBytes+packetHeadroom))
 }
 
 // Start 启动 MQTT Broker
 func (b *Broker) Start(tcpAddr, wsAddr string) error {
+	if err := b.loadRules(); err != nil {
+		return err
+	}
+
 	// 使用我们的 logger
 	mqttLogger := logger.Get()
 
@@ -65,16 +137,20 @@ func (b *Broker) Start(tcpAddr, wsAddr string) error {
 		InlineClient: true,
 		Logger:       mqttLogger,
 		Capabilities: &mqtt.Capabilities{
-			MaximumClients:               math.MaxInt64,                 // 最大客户端数（无限制）
-			MaximumSessionExpiryInterval: b.config.SessionExpiry,        // 会话过期时间
-			MaximumClientWritesPending:   1024,                          // 最大待写入消息数
-			MaximumMessageExpiryInterval: int64(b.config.MessageExpiry), // 消息过期时间
-			ReceiveMaximum:               1024,                          // 最大接收队列
-			MaximumInflight:              8192,                          // 最大飞行中消息数
-			MaximumQos:                   2,                             // 最大 QoS 级别（支持 QoS 0/1/2）
+			MaximumClients:               math.MaxInt64,          // 最大客户端数（无限制）
+			MaximumSessionExpiryInterval: b.config.SessionExpiry, // 会话过期时间
+			MaximumClientWritesPending:   1024,                   // 最大待写入消息数
+			MaximumMessageExpiryInterval: 0,                      // 消息过期由 PriorityHook 检查，紧急消息不过期
+			ReceiveMaximum:               1024,                   // 最大接收队列
+			MaximumInflight:              8192,                   // 最大飞行中消息数
+			MaximumQos:                   2,                      // 最大 QoS 级别（支持 QoS 0/1/2）
+			SharedSubAvailable:           1,                      // 支持共享订阅 $share/<group>/<filter>
+			RetainAvailable:              1,                      // 支持保留消息（在线事件以保留消息发布）
+			MaximumPacketSize:            b.maxPacketSize(),      // 最大报文字节数
 		},
 		ClientNetWriteBufferSize: 4096, // 客户端写缓冲区
 		ClientNetReadBufferSize:  4096, // 客户端读缓冲区
+		SysTopicResendInterval:   b.config.SysInterval,
 	})
 
 	logger.Info("MQTT 配置加载",
@@ -88,7 +164,8 @@ func (b *Broker) Start(tcpAddr, wsAddr string) error {
 		// 配置 BadgerDB 选项，设置日志级别为 WARNING 以减少 DEBUG 输出
 		badgerOpts := badgerdb.DefaultOptions(mqttPath).
 			WithLoggingLevel(badgerdb.INFO)
-		if err := b.server.AddHook(new(badger.Hook), &badger.Options{
+		b.storageHook = new(badger.Hook)
+		if err := b.server.AddHook(b.storageHook, &badger.Options{
 			Path:    mqttPath,
 			Options: &badgerOpts,
 		}); err != nil {
@@ -98,11 +175,40 @@ func (b *Broker) Start(tcpAddr, wsAddr string) error {
 	}
 
 	// 启用 Token 认证
-	if err := b.server.AddHook(&AuthHook{token: b.config.AuthToken}, nil); err != nil {
+	auth := &AuthHook{
+		server:        b.server,
+		token:         b.config.AuthToken,
+		adminToken:    b.config.AdminToken,
+		presenceTopic: b.config.PresenceTopic,
+		limiter:       b.limiter,
+	}
+	if err := b.server.AddHook(auth, nil); err != nil {
 		return err
 	}
 	logger.Info("MQTT Token 认证已启用")
 
+	// 消息校验与发布限流（须在消息存储钩子之前，被拒绝的消息不写入历史）
+	if err := b.server.AddHook(newValidateHook(b.config), nil); err != nil {
+		return err
+	}
+	if b.publishLimit != nil {
+		if err := b.server.AddHook(&PublishLimitHook{limiter: b.publishLimit, auth: auth}, nil); err != nil {
+			return err
+		}
+	}
+
+	// 消息优先级（须在消息存储钩子之前，优先级随消息保存）
+	if err := b.server.AddHook(newPriorityHook(b), nil); err != nil {
+		return err
+	}
+
+	// 路由规则（须在优先级钩子之后、消息存储钩子之前，按规则修改后的消息保存）
+	if len(b.rules) > 0 {
+		if err := b.server.AddHook(&RulesHook{broker: b, auth: auth}, nil); err != nil {
+			return err
+		}
+	}
+
 	// 添加日志钩子
 	if err := b.server.AddHook(new(LogHook), nil); err != nil {
 		return err
@@ -113,10 +219,50 @@ func (b *Broker) Start(tcpAddr, wsAddr string) error {
 		if err := b.server.AddHook(&MessageStoreHook{
 			manager: b.storeManager,
 			token:   b.config.AuthToken,
+			auth:    auth,
 		}, nil); err != nil {
 			return err
 		}
 		logger.Info("消息历史记录已启用")
+
+		b.delivery = newDeliveryHook(b.storeManager, b.config.AuthToken)
+		if err := b.server.AddHook(b.delivery, nil); err != nil {
+			return err
+		}
+		logger.Info("投递回执已启用")
+	}
+
+	// 添加历史回放钩子（未启用存储时仍需还原 $history/<n>/ 过滤器）
+	if err := b.server.AddHook(newHistoryHook(b), nil); err != nil {
+		return err
+	}
+
+	// 添加共享订阅钩子（组内轮询在线成员）
+	if err := b.server.AddHook(newSharedSubHook(b.server), nil); err != nil {
+		return err
+	}
+
+	// 添加在线状态跟踪钩子
+	b.presence = newPresenceHook(b, b.config.PresenceTopic)
+	if err := b.server.AddHook(b.presence, nil); err != nil {
+		return err
+	}
+	if b.config.PresenceTopic != "" {
+		logger.Info("MQTT 在线事件已启用", "topic", b.config.PresenceTopic+"/<client_id>")
+	}
+
+	// 添加 $SYS 统计钩子
+	if b.config.SysInterval > 0 {
+		if err := b.server.AddHook(&SysHook{broker: b}, nil); err != nil {
+			return err
+		}
+		logger.Info("MQTT $SYS 统计已启用", "topic", sysTopicPrefix, "interval", b.config.SysInterval)
+	}
+
+	// 管理员过期在线会话（须在其他处理断开的钩子之后）
+	b.expirer = &expireHook{broker: b}
+	if err := b.server.AddHook(b.expirer, nil); err != nil {
+		return err
 	}
 
 	// TCP 监听器
@@ -129,15 +275,26 @@ func (b *Broker) Start(tcpAddr, wsAddr string) error {
 	}
 	logger.Info("MQTT TCP 监听", "addr", tcpAddr)
 
-	// WebSocket 监听器
-	ws := listeners.NewWebsocket(listeners.Config{
-		ID:      "ws",
-		Address: wsAddr,
-	})
-	if err := b.server.AddListener(ws); err != nil {
-		return err
+	// WebSocket 监听器（独立端口，可选）
+	if wsAddr != "" {
+		ws := listeners.NewWebsocket(listeners.Config{
+			ID:      "ws",
+			Address: wsAddr,
+		})
+		if err := b.server.AddListener(ws); err != nil {
+			return err
+		}
+		logger.Info("MQTT WebSocket 监听", "addr", wsAddr)
+	}
+
+	// WebSocket 监听器（挂载到 HTTP 服务，与 Web 控制台和 Webhook 共用端口）
+	if b.config.WSPath != "" {
+		b.wsHandler = newWebsocketListener("ws-http", b.config.WSPath)
+		if err := b.server.AddListener(b.wsHandler); err != nil {
+			return err
+		}
+		logger.Info("MQTT WebSocket 挂载到 HTTP 服务", "path", b.config.WSPath)
 	}
-	logger.Info("MQTT WebSocket 监听", "addr", wsAddr)
 
 	// 启动服务器
 	go func() {
@@ -147,20 +304,86 @@ func (b *Broker) Start(tcpAddr, wsAddr string) error {
 	}()
 
 	logger.Info("MQTT Broker 已启动")
-	return nil
+
+	// 定时消息调度（依赖内置客户端发布消息）
+	b.startScheduler()
+
+	// 连接上游 broker（依赖内置客户端转入消息）
+	return b.startBridges()
 }
 
-// Publish 发布消息到指定主题
-func (b *Broker) Publish(topic string, msg Message) error {
+// WebsocketHandler 返回挂载到 HTTP 服务的 MQTT over WebSocket 处理器，未启用时返回 nil
+func (b *Broker) WebsocketHandler() http.Handler {
+	if b.wsHandler == nil {
+		return nil
+	}
+	return b.wsHandler
+}
+
+// Publish 发布消息到指定主题，返回消息历史中的 ID（未启用存储时为 0）
+// 除 JSON 负载外，同时携带 MQTT v5 属性（content-type 及标题、发送端、优先级等用户属性）
+// 紧急消息使用 QoS 2；启用优先级主题时非默认优先级的消息发布到 <topic>/<priority>
+func (b *Broker) Publish(topic string, msg Message) (uint64, error) {
+	if _, ok := b.server.Clients.Get(mqtt.InlineClientId); !ok {
+		return 0, mqtt.ErrInlineClientNotEnabled
+	}
+	topic = msg.Priority.topic(topic, b.config.PriorityTopics)
+
+	// 先保存以获得消息 ID，随消息下发便于客户端和投递回执关联
+	if b.storeManager != nil && b.storeManager.IsEnabled() {
+		saved, err := b.storeManager.SaveMessage(b.config.AuthToken, &store.Message{
+			Topic:     topic,
+			Title:     msg.Title,
+			Content:   msg.Content,
+			Extra:     msg.Extra,
+			Priority:  string(msg.Priority),
+			GroupKey:  msg.GroupKey,
+			Tags:      msg.Tags,
+			Key:       msg.Key,
+			Publisher: msg.Publisher,
+		})
+		if err != nil {
+			logger.Warn("消息保存失败", "error", err)
+		} else if saved != nil {
+			msg.ID = saved.ID
+		}
+	}
+
+	return msg.ID, b.publishMessage(topic, msg)
+}
+
+// publishMessage 通过内置客户端将消息发布到主题，不写入存储
+func (b *Broker) publishMessage(topic string, msg Message) error {
+	cl, ok := b.server.Clients.Get(mqtt.InlineClientId)
+	if !ok {
+		return mqtt.ErrInlineClientNotEnabled
+	}
+
 	payload, err := json.Marshal(msg)
 	if err != nil {
 		return err
 	}
-	return b.server.Publish(topic, payload, false, 1)
+
+	// 撤回事件不携带 message_id，避免其确认被记为原消息的投递回执
+	props := messageProperties(msg)
+	if msg.ID > 0 && !msg.Recalled {
+		setMessageID(&props, msg.ID)
+	}
+
+	return b.server.InjectPacket(cl, packets.Packet{
+		FixedHeader: packets.FixedHeader{
+			Type: packets.Publish,
+			Qos:  msg.Priority.qos(),
+		},
+		TopicName:  topic,
+		Payload:    payload,
+		Properties: props,
+		PacketID:   1, // 内置客户端不处理入站 QoS，但需要 packet id 通过校验
+	})
 }
 
 // PublishToDefault 发布消息到默认主题
-func (b *Broker) PublishToDefault(msg Message) error {
+func (b *Broker) PublishToDefault(msg Message) (uint64, error) {
 	return b.Publish(b.topic, msg)
 }
 
@@ -178,6 +401,15 @@ func (b *Broker) ClientCount() int {
 
 // Close 关闭 Broker
 func (b *Broker) Close() error {
+	if b.scheduler != nil {
+		b.scheduler.close()
+	}
+	if b.dedup != nil {
+		b.dedup.close()
+	}
+	for _, c := range b.bridges {
+		c.close()
+	}
 	return b.server.Close()
 }
 
@@ -247,7 +479,12 @@ func (h *LogHook) OnPublished(cl *mqtt.Client, pk packets.Packet) {
 // AuthHook Token 认证钩子
 type AuthHook struct {
 	mqtt.HookBase
-	token string
+	server        *mqtt.Server
+	token         string
+	adminToken    string
+	presenceTopic string             // 在线事件主题前缀，与 $SYS 一样仅管理员可订阅
+	limiter       *ratelimit.Limiter // 认证失败限流，为 nil 则不限制
+	admins        sync.Map           // client_id -> 是否以管理员身份认证
 }
 
 func (h *AuthHook) ID() string {
@@ -255,7 +492,28 @@ func (h *AuthHook) ID() string {
 }
 
 func (h *AuthHook) Provides(b byte) bool {
-	return b == mqtt.OnConnectAuthenticate || b == mqtt.OnACLCheck
+	return b == mqtt.OnConnect || b == mqtt.OnConnectAuthenticate || b == mqtt.OnACLCheck
+}
+
+// OnConnect 在认证前拒绝已封禁 IP 的连接
+func (h *AuthHook) OnConnect(cl *mqtt.Client, pk packets.Packet) error {
+	if h.limiter == nil {
+		return nil
+	}
+	ip := ratelimit.RemoteIP(cl.Net.Remote)
+	if !h.limiter.IsBlocked(ip) {
+		return nil
+	}
+
+	logger.Warn("MQTT 连接被拒绝，IP 已封禁", "client_id", cl.ID, "ip", ip)
+	code := packets.ErrConnectionRateExceeded
+	if cl.Properties.ProtocolVersion < 5 {
+		code = packets.ErrBadUsernameOrPassword // 3.1.1 没有对应返回码，按未授权处理
+	}
+	if err := h.server.SendConnack(cl, code, false, nil); err != nil {
+		return err
+	}
+	return code
 }
 
 // OnConnectAuthenticate 连接认证
@@ -268,34 +526,91 @@ func (h *AuthHook) OnConnectAuthenticate(cl *mqtt.Client, pk packets.Packet) boo
 
 	username := string(pk.Connect.Username)
 	password := string(pk.Connect.Password)
+	ip := ratelimit.RemoteIP(cl.Net.Remote)
+
+	// 管理员 Token
+	if h.adminToken != "" && (tokenEqual(username, h.adminToken) || tokenEqual(password, h.adminToken)) {
+		h.admins.Store(cl.ID, true)
+		h.recordSuccess(ip)
+		logger.Debug("MQTT 认证成功 (admin)", "client_id", cl.ID)
+		return true
+	}
+
+	// 未单独配置管理员 Token 时，普通 Token 即管理员
+	isAdmin := h.adminToken == ""
 
 	// 方式 1: username 直接是 token
-	if username == h.token {
+	if tokenEqual(username, h.token) {
+		h.admins.Store(cl.ID, isAdmin)
+		h.recordSuccess(ip)
 		logger.Debug("MQTT 认证成功 (username)", "client_id", cl.ID)
 		return true
 	}
 
 	// 方式 2: password 是 token
-	if password == h.token {
+	if tokenEqual(password, h.token) {
+		h.admins.Store(cl.ID, isAdmin)
+		h.recordSuccess(ip)
 		logger.Debug("MQTT 认证成功 (password)", "client_id", cl.ID)
 		return true
 	}
 
-	logger.Warn("MQTT 认证失败", "client_id", cl.ID, "username", username)
+	if h.limiter != nil {
+		h.limiter.RecordFailure(ip)
+	}
+	logger.Warn("MQTT 认证失败", "client_id", cl.ID, "username", username, "ip", ip)
 	return false
 }
 
-// OnACLCheck ACL 检查，允许所有已认证用户
+// recordSuccess 认证成功，清除该 IP 的失败记录
+func (h *AuthHook) recordSuccess(ip string) {
+	if h.limiter != nil {
+		h.limiter.RecordSuccess(ip)
+	}
+}
+
+// OnACLCheck ACL 检查
+// $SYS 与在线事件主题仅允许管理员订阅，其余操作允许所有已认证用户
+// 投递消息时 mochi 按实际主题再次检查，通配订阅（如 $notice/#）也收不到受限主题的消息
 func (h *AuthHook) OnACLCheck(cl *mqtt.Client, topic string, write bool) bool {
-	// 已通过认证的客户端允许所有操作
+	// 共享订阅按实际过滤器检查，避免通过 $share/<group>/$SYS/# 绕过限制
+	_, topic = sharedFilter(topic)
+	if strings.HasPrefix(topic, "$SYS") || h.isPresenceTopic(topic) {
+		return !write && h.isAdmin(cl.ID)
+	}
 	return true
 }
 
+// isPresenceTopic 主题是否属于在线事件主题
+func (h *AuthHook) isPresenceTopic(topic string) bool {
+	return h.presenceTopic != "" && (topic == h.presenceTopic || strings.HasPrefix(topic, h.presenceTopic+"/"))
+}
+
+// tokenEqual 以常量时间比较 Token，避免通过响应耗时逐字节猜测
+func tokenEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// credential 客户端认证使用的凭据名称
+func (h *AuthHook) credential(clientID string) string {
+	if h.adminToken != "" && h.isAdmin(clientID) {
+		return CredentialAdmin
+	}
+	return CredentialToken
+}
+
+// isAdmin 客户端是否以管理员身份认证
+func (h *AuthHook) isAdmin(clientID string) bool {
+	v, ok := h.admins.Load(clientID)
+	return ok && v.(bool)
+}
+
 // MessageStoreHook 消息存储钩子
 type MessageStoreHook struct {
 	mqtt.HookBase
 	manager *store.Manager
-	token   string // 当前服务使用的 token
+	token   string    // 当前服务使用的 token
+	auth    *AuthHook // 用于记录客户端发布使用的凭据
 }
 
 func (h *MessageStoreHook) ID() string {
@@ -303,28 +618,66 @@ func (h *MessageStoreHook) ID() string {
 }
 
 func (h *MessageStoreHook) Provides(b byte) bool {
-	return b == mqtt.OnPublished
+	return b == mqtt.OnPublish
 }
 
-// OnPublished 消息发布时保存到存储
-func (h *MessageStoreHook) OnPublished(cl *mqtt.Client, pk packets.Packet) {
+// OnPublish 消息发布前保存到存储，并将存储 ID 写入用户属性随消息下发
+func (h *MessageStoreHook) OnPublish(cl *mqtt.Client, pk packets.Packet) (packets.Packet, error) {
 	// 跳过系统消息（以 $ 开头的主题）
 	if len(pk.TopicName) > 0 && pk.TopicName[0] == '$' {
-		return
+		return pk, nil
 	}
 
-	// 尝试解析消息内容
-	var msg Message
-	if err := json.Unmarshal(pk.Payload, &msg); err != nil {
-		// 非 JSON 格式，直接存储原始内容
-		if _, err := h.manager.Save(h.token, pk.TopicName, "", string(pk.Payload), nil); err != nil {
-			logger.Warn("消息保存失败", "error", err)
-		}
-		return
+	// Broker.Publish 已保存并写入消息 ID；撤回事件不作为新消息保存
+	if cl.Net.Inline && (userProperty(pk.Properties, PropMessageID) != "" || userProperty(pk.Properties, PropRecalled) != "") {
+		return pk, nil
+	}
+
+	// 内置客户端的消息（如桥接）没有发布凭据，只能由管理员撤回
+	var publisher string
+	if !cl.Net.Inline {
+		publisher = h.auth.credential(cl.ID)
 	}
 
-	// JSON 格式，提取字段
-	if _, err := h.manager.Save(h.token, pk.TopicName, msg.Title, msg.Content, msg.Extra); err != nil {
+	title, content, extra := parsePayload(pk)
+	saved, err := h.manager.SaveMessage(h.token, &store.Message{
+		Topic:     pk.TopicName,
+		Title:     title,
+		Content:   content,
+		Extra:     extra,
+		Priority:  userProperty(pk.Properties, PropPriority), // 已由优先级钩子规范化
+		Tags:      splitTags(userProperty(pk.Properties, PropTags)),
+		Publisher: publisher,
+	})
+	if err != nil {
 		logger.Warn("消息保存失败", "error", err)
+		return pk, nil
+	}
+	if saved != nil {
+		setMessageID(&pk.Properties, saved.ID)
+	}
+	return pk, nil
+}
+
+// parsePayload 解析消息负载
+// JSON 格式提取字段；非 JSON 格式存储原始内容，标题和元数据取自 MQTT v5 用户属性
+func parsePayload(pk packets.Packet) (title, content string, extra any) {
+	if isJSONContent(pk.Properties) {
+		// 不解析 priority，无效的优先级不影响按通知格式存储
+		var msg struct {
+			Title   string `json:"title"`
+			Content string `json:"content"`
+			Extra   any    `json:"extra"`
+		}
+		// 非通知格式的 JSON（如桥接来的 Home Assistant 事件）按原始内容存储
+		if err := json.Unmarshal(pk.Payload, &msg); err == nil && (msg.Title != "" || msg.Content != "") {
+			return msg.Title, msg.Content, msg.Extra
+		}
+	}
+
+	title = userProperty(pk.Properties, PropTitle)
+	if meta := metadataProperties(pk.Properties); meta != nil {
+		extra = meta
 	}
+	return title, string(pk.Payload), extra
 }
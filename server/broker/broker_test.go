@@ -0,0 +1,42 @@
+package broker
+
+import (
+	"testing"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+)
+
+func TestAuthHookACL(t *testing.T) {
+	h := &AuthHook{adminToken: "admin", presenceTopic: "$notice/presence"}
+	h.admins.Store("admin-client", true)
+	h.admins.Store("user-client", false)
+
+	tests := []struct {
+		name   string
+		client string
+		topic  string
+		write  bool
+		want   bool
+	}{
+		{"user subscribes notice", "user-client", "notice", false, true},
+		{"user publishes notice", "user-client", "notice", true, true},
+		{"user subscribes sys", "user-client", "$SYS/notice/stats", false, false},
+		{"admin subscribes sys", "admin-client", "$SYS/#", false, true},
+		{"admin publishes sys", "admin-client", "$SYS/notice/stats", true, false},
+		{"user subscribes presence", "user-client", "$notice/presence/#", false, false},
+		{"user receives presence", "user-client", "$notice/presence/phone", false, false},
+		{"user shared presence", "user-client", "$share/g/$notice/presence/#", false, false},
+		{"admin subscribes presence", "admin-client", "$notice/presence/#", false, true},
+		{"admin publishes presence", "admin-client", "$notice/presence/phone", true, false},
+		{"similar prefix", "user-client", "$notice/presences", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := &mqtt.Client{ID: tt.client}
+			if got := h.OnACLCheck(cl, tt.topic, tt.write); got != tt.want {
+				t.Errorf("OnACLCheck(%q, write=%v) = %v, want %v", tt.topic, tt.write, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package broker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"notice-server/logger"
+	"notice-server/store"
+)
+
+// DedupResult 经去重发布的结果
+type DedupResult struct {
+	ID         uint64 // 消息 ID；被合并时为窗口内首条消息的 ID
+	Suppressed bool   // 是否作为重复消息被合并（未发布）
+	Repeats    int    // 窗口内已合并的重复次数（不含首次）
+}
+
+// dedupEntry 去重窗口内的首条消息
+type dedupEntry struct {
+	id      uint64
+	topic   string
+	msg     Message
+	repeats int
+	timer   *time.Timer
+}
+
+// deduper 重复消息合并
+// 相同 group_key（未指定时为相同标题和内容）的消息在窗口内只发布一次，之后的重复只累加存储消息的重复次数；
+// 窗口从首条消息发布时开始计算，结束后可发布一条重复次数汇总。窗口状态仅保存在内存中
+type deduper struct {
+	broker  *Broker
+	window  time.Duration
+	summary bool
+	entries map[string]*dedupEntry
+	mu      sync.Mutex
+}
+
+func newDeduper(b *Broker, window time.Duration, summary bool) *deduper {
+	return &deduper{
+		broker:  b,
+		window:  window,
+		summary: summary,
+		entries: make(map[string]*dedupEntry),
+	}
+}
+
+// dedupKey 去重键：主题 + group_key，未指定 group_key 时为主题 + 标题和内容的哈希
+func dedupKey(topic string, msg Message) string {
+	if msg.GroupKey != "" {
+		return topic + "\x00g:" + msg.GroupKey
+	}
+	sum := sha256.Sum256([]byte(msg.Title + "\x00" + msg.Content))
+	return topic + "\x00h:" + hex.EncodeToString(sum[:])
+}
+
+// priorityRank 优先级排序，数值越大越紧急
+func priorityRank(p Priority) int {
+	return slices.Index(priorityLevels, p)
+}
+
+// publish 窗口内的重复消息不发布，只累加首条消息的重复次数
+// 比窗口内首条消息优先级更高的重复消息照常发布，并开始新的窗口；紧急消息不参与合并
+// charge 在确定发布前调用（如扣除发布限额），返回错误时不发布；被合并的重复消息不调用
+func (d *deduper) publish(topic string, msg Message, charge func() error) (DedupResult, error) {
+	b := d.broker
+	if msg.Priority == PriorityUrgent {
+		if err := callCharge(charge); err != nil {
+			return DedupResult{}, err
+		}
+		id, err := b.Publish(topic, msg)
+		return DedupResult{ID: id}, err
+	}
+	key := dedupKey(topic, msg)
+
+	// 只在锁内更新窗口状态，存储和发布在锁外进行
+	d.mu.Lock()
+	if e, ok := d.entries[key]; ok && priorityRank(msg.Priority) <= priorityRank(e.msg.Priority) {
+		e.repeats++
+		result := DedupResult{ID: e.id, Suppressed: true, Repeats: e.repeats}
+		d.mu.Unlock()
+		// 首条消息仍在发布时 ID 为 0，重复次数在其发布完成后写入
+		if result.ID > 0 {
+			d.saveRepeats(result.ID, result.Repeats)
+		}
+		return result, nil
+	}
+	// 先占用窗口，发布期间到达的重复消息被合并到本条
+	old := d.entries[key]
+	e := &dedupEntry{topic: topic, msg: msg}
+	e.timer = time.AfterFunc(d.window, func() { d.expire(key, e) })
+	d.entries[key] = e
+	d.mu.Unlock()
+
+	err := callCharge(charge)
+	var id uint64
+	if err == nil {
+		id, err = b.Publish(topic, msg)
+	}
+
+	d.mu.Lock()
+	if err != nil {
+		// 未发布，恢复原窗口（发布期间被合并的重复消息随之丢弃）
+		e.timer.Stop()
+		if d.entries[key] == e {
+			if old != nil {
+				d.entries[key] = old
+			} else {
+				delete(d.entries, key)
+			}
+		}
+		d.mu.Unlock()
+		return DedupResult{}, err
+	}
+	if old != nil {
+		old.timer.Stop()
+	}
+	e.id = id
+	repeats := e.repeats
+	d.mu.Unlock()
+
+	if repeats > 0 && id > 0 {
+		d.saveRepeats(id, repeats)
+	}
+	return DedupResult{ID: id}, nil
+}
+
+// callCharge 调用 charge，为 nil 时不扣除
+func callCharge(charge func() error) error {
+	if charge == nil {
+		return nil
+	}
+	return charge()
+}
+
+// saveRepeats 更新存储消息的重复次数，并发更新时只保留较大值
+func (d *deduper) saveRepeats(id uint64, repeats int) {
+	b := d.broker
+	now := time.Now()
+	if _, err := b.storeManager.Update(b.config.AuthToken, id, func(m *store.Message) {
+		if repeats > m.Repeats {
+			m.Repeats = repeats
+			m.RepeatedAt = now
+		}
+	}); err != nil {
+		logger.Warn("重复次数更新失败", "id", id, "error", err)
+	}
+}
+
+// expire 窗口结束，移除记录并按需发布重复次数汇总
+func (d *deduper) expire(key string, e *dedupEntry) {
+	d.mu.Lock()
+	if d.entries[key] != e {
+		d.mu.Unlock()
+		return
+	}
+	delete(d.entries, key)
+	id, repeats := e.id, e.repeats
+	d.mu.Unlock()
+
+	if !d.summary || repeats == 0 {
+		return
+	}
+
+	summary := e.msg
+	summary.ID = 0
+	summary.Timestamp = time.Now()
+	summary.Content = fmt.Sprintf("%s\n\n（%s内重复 %d 次）", e.msg.Content, formatWindow(d.window), repeats)
+	summaryID, err := d.broker.Publish(e.topic, summary)
+	if err != nil {
+		logger.Error("重复汇总发布失败", "id", id, "error", err)
+		return
+	}
+	logger.Info("重复汇总已发布", "id", summaryID, "first_id", id, "topic", e.topic, "repeats", repeats)
+}
+
+// close 停止所有窗口，未发布的汇总被丢弃
+func (d *deduper) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for key, e := range d.entries {
+		e.timer.Stop()
+		delete(d.entries, key)
+	}
+}
+
+// formatWindow 将窗口时长格式化为中文描述，如 "5 分钟"
+func formatWindow(window time.Duration) string {
+	secs := int(window.Seconds())
+	switch {
+	case secs >= 3600 && secs%3600 == 0:
+		return fmt.Sprintf("%d 小时", secs/3600)
+	case secs >= 60 && secs%60 == 0:
+		return fmt.Sprintf("%d 分钟", secs/60)
+	default:
+		return fmt.Sprintf("%d 秒", secs)
+	}
+}
+
+// PublishDedup 经重复消息合并后发布，未启用合并时等同于 Publish
+// charge 在确定发布前调用（可为 nil），返回错误时不发布并原样返回该错误；被合并的重复消息不调用 charge
+func (b *Broker) PublishDedup(topic string, msg Message, charge func() error) (DedupResult, error) {
+	if b.dedup == nil {
+		if err := callCharge(charge); err != nil {
+			return DedupResult{}, err
+		}
+		id, err := b.Publish(topic, msg)
+		return DedupResult{ID: id}, err
+	}
+	return b.dedup.publish(topic, msg, charge)
+}
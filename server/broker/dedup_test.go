@@ -0,0 +1,274 @@
+package broker
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+
+	"notice-server/store"
+)
+
+// publishRecorder 记录经内置客户端发布到各主题的消息负载
+type publishRecorder struct {
+	mu       sync.Mutex
+	payloads []string
+}
+
+func (r *publishRecorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.payloads)
+}
+
+func (r *publishRecorder) last() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.payloads) == 0 {
+		return ""
+	}
+	return r.payloads[len(r.payloads)-1]
+}
+
+// newTestBroker 创建只启用内置客户端、不监听端口和不存储消息的 Broker
+func newTestBroker(t *testing.T, cfg Config) (*Broker, *publishRecorder) {
+	t.Helper()
+	b := New("notice", cfg, store.NewManager(t.TempDir(), false), nil, nil)
+	b.server = mqtt.New(&mqtt.Options{InlineClient: true})
+	rec := &publishRecorder{}
+	err := b.server.Subscribe("#", 1, func(cl *mqtt.Client, sub packets.Subscription, pk packets.Packet) {
+		rec.mu.Lock()
+		rec.payloads = append(rec.payloads, string(pk.Payload))
+		rec.mu.Unlock()
+	})
+	if err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+	t.Cleanup(func() { b.server.Close() })
+	return b, rec
+}
+
+func TestDedupPublish(t *testing.T) {
+	msg := func(title, content string, p Priority, group string) Message {
+		return Message{Title: title, Content: content, Priority: p, GroupKey: group}
+	}
+	type send struct {
+		topic      string
+		msg        Message
+		suppressed bool
+		repeats    int
+	}
+
+	tests := []struct {
+		name  string
+		sends []send
+	}{
+		{"duplicate merged", []send{
+			{"notice", msg("t", "c", "", ""), false, 0},
+			{"notice", msg("t", "c", "", ""), true, 1},
+			{"notice", msg("t", "c", "", ""), true, 2},
+		}},
+		{"different content", []send{
+			{"notice", msg("t", "a", "", ""), false, 0},
+			{"notice", msg("t", "b", "", ""), false, 0},
+		}},
+		{"different topic", []send{
+			{"notice", msg("t", "c", "", ""), false, 0},
+			{"alerts", msg("t", "c", "", ""), false, 0},
+		}},
+		{"group key", []send{
+			{"notice", msg("disk", "90%", "", "disk"), false, 0},
+			{"notice", msg("disk", "95%", "", "disk"), true, 1},
+		}},
+		{"higher priority republished", []send{
+			{"notice", msg("t", "c", PriorityLow, ""), false, 0},
+			{"notice", msg("t", "c", PriorityHigh, ""), false, 0},
+			{"notice", msg("t", "c", PriorityDefault, ""), true, 1},
+		}},
+		{"urgent never merged", []send{
+			{"notice", msg("t", "c", PriorityUrgent, ""), false, 0},
+			{"notice", msg("t", "c", PriorityUrgent, ""), false, 0},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, rec := newTestBroker(t, Config{})
+			d := newDeduper(b, time.Minute, false)
+			defer d.close()
+
+			published := 0
+			for i, s := range tt.sends {
+				res, err := d.publish(s.topic, s.msg, nil)
+				if err != nil {
+					t.Fatalf("#%d publish() error = %v", i, err)
+				}
+				if res.Suppressed != s.suppressed || res.Repeats != s.repeats {
+					t.Errorf("#%d publish() = %+v, want suppressed %v repeats %d", i, res, s.suppressed, s.repeats)
+				}
+				if !s.suppressed {
+					published++
+				}
+			}
+			if got := rec.count(); got != published {
+				t.Errorf("published %d messages, want %d", got, published)
+			}
+		})
+	}
+}
+
+func TestDedupCharge(t *testing.T) {
+	b, rec := newTestBroker(t, Config{})
+	d := newDeduper(b, time.Minute, false)
+	defer d.close()
+
+	charges := 0
+	charge := func() error {
+		charges++
+		return nil
+	}
+	m := Message{Title: "t", Content: "c"}
+	for range 3 {
+		if _, err := d.publish("notice", m, charge); err != nil {
+			t.Fatalf("publish() error = %v", err)
+		}
+	}
+	if charges != 1 {
+		t.Errorf("charge called %d times, want 1（被合并的重复消息不应扣除额度）", charges)
+	}
+
+	// 扣除失败时不发布，也不占用窗口
+	limited := errors.New("limited")
+	other := Message{Title: "t", Content: "other"}
+	if _, err := d.publish("notice", other, func() error { return limited }); !errors.Is(err, limited) {
+		t.Fatalf("publish() error = %v, want %v", err, limited)
+	}
+	if got := rec.count(); got != 1 {
+		t.Errorf("published %d messages, want 1", got)
+	}
+	res, err := d.publish("notice", other, charge)
+	if err != nil || res.Suppressed {
+		t.Errorf("扣除失败后重试 publish() = %+v, %v, want published", res, err)
+	}
+	if charges != 2 || rec.count() != 2 {
+		t.Errorf("charges = %d, published = %d, want 2, 2", charges, rec.count())
+	}
+}
+
+func TestPublishBatchDedup(t *testing.T) {
+	limited := errors.New("limited")
+	for _, window := range []int{0, 60} {
+		b, rec := newTestBroker(t, Config{DedupWindow: window})
+		if b.dedup != nil {
+			defer b.dedup.close()
+		}
+
+		charges := 0
+		charge := func() error {
+			charges++
+			return nil
+		}
+		dup := Message{Title: "disk", Content: "91%"}
+		items := []BatchItem{
+			{Topic: "notice", Message: dup, Charge: charge},
+			{Topic: "notice", Message: dup, Charge: charge},
+			{Topic: "notice", Message: Message{Title: "load", Content: "high"}, Charge: func() error { return limited }},
+			{Topic: "notice", Message: Message{Title: "cpu", Content: "ok"}},
+		}
+		results := b.PublishBatch(items)
+
+		// 启用合并时第二条与第一条重复，不发布也不扣除
+		wantSuppressed := window > 0
+		if results[0].Suppressed || results[1].Suppressed != wantSuppressed {
+			t.Errorf("window %d: suppressed = %v, %v, want false, %v", window, results[0].Suppressed, results[1].Suppressed, wantSuppressed)
+		}
+		if wantSuppressed && results[1].Repeats != 1 {
+			t.Errorf("window %d: repeats = %d, want 1", window, results[1].Repeats)
+		}
+		if !errors.Is(results[2].Err, limited) {
+			t.Errorf("window %d: charge error = %v, want %v", window, results[2].Err, limited)
+		}
+		if results[3].Err != nil {
+			t.Errorf("window %d: publish error = %v", window, results[3].Err)
+		}
+
+		published := 3
+		if wantSuppressed {
+			published = 2
+		}
+		if got := rec.count(); got != published {
+			t.Errorf("window %d: published %d messages, want %d", window, got, published)
+		}
+		if charges != published-1 {
+			t.Errorf("window %d: charged %d times, want %d", window, charges, published-1)
+		}
+	}
+}
+
+func TestDedupWindowSummary(t *testing.T) {
+	b, rec := newTestBroker(t, Config{})
+	d := newDeduper(b, 50*time.Millisecond, true)
+	defer d.close()
+
+	m := Message{Title: "t", Content: "c"}
+	d.publish("notice", m, nil)
+	d.publish("notice", m, nil)
+	d.publish("notice", m, nil)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for rec.count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := rec.count(); got != 2 {
+		t.Fatalf("published %d messages, want 2（首条和汇总）", got)
+	}
+	if !strings.Contains(rec.last(), "重复 2 次") {
+		t.Errorf("summary = %s, want 重复 2 次", rec.last())
+	}
+
+	// 窗口结束后相同消息重新发布
+	if res, _ := d.publish("notice", m, nil); res.Suppressed {
+		t.Error("窗口结束后的消息不应被合并")
+	}
+}
+
+func TestDedupConcurrent(t *testing.T) {
+	b, rec := newTestBroker(t, Config{})
+	d := newDeduper(b, time.Minute, false)
+	defer d.close()
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.publish("notice", Message{Title: "t", Content: "c"}, nil)
+		}()
+	}
+	wg.Wait()
+	if got := rec.count(); got != 1 {
+		t.Errorf("published %d messages, want 1", got)
+	}
+}
+
+func TestFormatWindow(t *testing.T) {
+	tests := []struct {
+		window time.Duration
+		want   string
+	}{
+		{30 * time.Second, "30 秒"},
+		{90 * time.Second, "90 秒"},
+		{5 * time.Minute, "5 分钟"},
+		{2 * time.Hour, "2 小时"},
+		{90 * time.Minute, "90 分钟"},
+	}
+	for _, tt := range tests {
+		if got := formatWindow(tt.window); got != tt.want {
+			t.Errorf("formatWindow(%v) = %q, want %q", tt.window, got, tt.want)
+		}
+	}
+}
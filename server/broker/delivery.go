@@ -0,0 +1,288 @@
+package broker
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+
+	"notice-server/logger"
+	"notice-server/store"
+)
+
+// deliveryQueueSize 等待写入的投递回执队列长度，队列满时 MQTT 流程等待写入
+const deliveryQueueSize = 4096
+
+// DeliveryHook 投递回执钩子
+// 通过 QoS 流程记录每条消息下发给了哪些客户端、何时被确认
+// 回执由后台协程批量写入存储，不阻塞消息下发
+type DeliveryHook struct {
+	mqtt.HookBase
+	manager *store.Manager
+	token   string
+	pending map[string]map[uint16]uint64 // client_id -> packet_id -> 消息 ID，等待客户端确认
+	mu      sync.Mutex
+
+	queue   chan deliveryOp
+	stopped bool         // Stop 后不再接受回执
+	qmu     sync.RWMutex // 保护 stopped 和向 queue 发送
+	done    chan struct{}
+}
+
+// deliveryOp 写入队列中的一项：回执更新，或 flush 标记（done 非 nil）
+type deliveryOp struct {
+	update store.DeliveryUpdate
+	done   chan struct{} // 之前的回执写入后关闭
+}
+
+// newDeliveryHook 创建投递回执钩子并启动写入协程
+func newDeliveryHook(m *store.Manager, token string) *DeliveryHook {
+	h := &DeliveryHook{
+		manager: m,
+		token:   token,
+		pending: make(map[string]map[uint16]uint64),
+		queue:   make(chan deliveryOp, deliveryQueueSize),
+		done:    make(chan struct{}),
+	}
+	go h.run()
+	return h
+}
+
+func (h *DeliveryHook) ID() string {
+	return "delivery"
+}
+
+func (h *DeliveryHook) Provides(b byte) bool {
+	return b == mqtt.OnQosPublish ||
+		b == mqtt.OnQosComplete ||
+		b == mqtt.OnQosDropped ||
+		b == mqtt.OnDisconnect ||
+		b == mqtt.OnClientExpired
+}
+
+// Stop 停止接受回执，写入队列中剩余的回执后返回
+func (h *DeliveryHook) Stop() error {
+	h.qmu.Lock()
+	if !h.stopped {
+		h.stopped = true
+		close(h.queue)
+	}
+	h.qmu.Unlock()
+	<-h.done
+	return nil
+}
+
+// OnQosPublish 消息下发给客户端（含进入离线队列和重发）
+func (h *DeliveryHook) OnQosPublish(cl *mqtt.Client, pk packets.Packet, sent int64, resends int) {
+	// 入站 QoS 流程传入的是服务端构造的 ack，只处理出站的 Publish
+	if pk.FixedHeader.Type != packets.Publish {
+		return
+	}
+	id, ok := receiptMessageID(pk)
+	if !ok {
+		return
+	}
+
+	h.mu.Lock()
+	if h.pending[cl.ID] == nil {
+		h.pending[cl.ID] = make(map[uint16]uint64)
+	}
+	h.pending[cl.ID][pk.PacketID] = id
+	h.mu.Unlock()
+
+	now := time.Now()
+	h.update(id, cl.ID, func(d *store.Delivery) {
+		if d.QueuedAt.IsZero() {
+			d.QueuedAt = now
+		}
+		if d.Status == "" {
+			d.Status = store.DeliveryQueued
+		}
+	})
+}
+
+// OnQosComplete 客户端确认接收（QoS 1 的 PUBACK 或 QoS 2 的 PUBCOMP）
+func (h *DeliveryHook) OnQosComplete(cl *mqtt.Client, pk packets.Packet) {
+	// 客户端发来的 ack 由解码得到，Created 为 0；服务端为入站消息构造的 ack 带有 Created
+	if pk.Created != 0 || (pk.FixedHeader.Type != packets.Puback && pk.FixedHeader.Type != packets.Pubcomp) {
+		return
+	}
+	id, ok := h.take(cl.ID, pk.PacketID)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	h.update(id, cl.ID, func(d *store.Delivery) {
+		d.Status = store.DeliveryDelivered
+		d.DeliveredAt = &now
+	})
+}
+
+// OnQosDropped 消息未送达即被丢弃（过期、被清除等）
+func (h *DeliveryHook) OnQosDropped(cl *mqtt.Client, pk packets.Packet) {
+	id, ok := h.take(cl.ID, pk.PacketID)
+	if !ok {
+		// 重启后 pending 为空，从消息属性中恢复
+		if id, ok = receiptMessageID(pk); !ok {
+			return
+		}
+	}
+	h.dropped(id, cl.ID)
+}
+
+// OnDisconnect 移除客户端等待确认的记录；持久会话重连后重发时重新记录
+// 非持久会话随断开结束，离线队列中的消息记为丢弃
+func (h *DeliveryHook) OnDisconnect(cl *mqtt.Client, err error, expire bool) {
+	h.forget(cl.ID)
+	if expire && !cl.IsTakenOver() {
+		h.dropInflights(cl)
+	}
+}
+
+// OnClientExpired 持久会话过期，离线队列中的消息记为丢弃
+func (h *DeliveryHook) OnClientExpired(cl *mqtt.Client) {
+	h.forget(cl.ID)
+	h.dropInflights(cl)
+}
+
+// dropInflights 将客户端离线队列中的消息记为丢弃
+func (h *DeliveryHook) dropInflights(cl *mqtt.Client) {
+	for _, pk := range cl.State.Inflight.GetAll(false) {
+		if pk.FixedHeader.Type != packets.Publish {
+			continue
+		}
+		if id, ok := receiptMessageID(pk); ok {
+			h.dropped(id, cl.ID)
+		}
+	}
+}
+
+// dropped 记录消息未送达即被丢弃，已确认的回执不变
+func (h *DeliveryHook) dropped(id uint64, clientID string) {
+	now := time.Now()
+	h.update(id, clientID, func(d *store.Delivery) {
+		if d.Status == store.DeliveryDelivered {
+			return
+		}
+		d.Status = store.DeliveryDropped
+		d.DroppedAt = &now
+	})
+}
+
+// take 取出并移除等待确认的消息 ID
+func (h *DeliveryHook) take(clientID string, packetID uint16) (uint64, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	id, ok := h.pending[clientID][packetID]
+	if ok {
+		delete(h.pending[clientID], packetID)
+		if len(h.pending[clientID]) == 0 {
+			delete(h.pending, clientID)
+		}
+	}
+	return id, ok
+}
+
+// forget 移除客户端所有等待确认的记录
+func (h *DeliveryHook) forget(clientID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.pending, clientID)
+}
+
+// update 将回执更新加入写入队列
+func (h *DeliveryHook) update(id uint64, clientID string, fn func(d *store.Delivery)) {
+	h.send(deliveryOp{update: store.DeliveryUpdate{ID: id, ClientID: clientID, Apply: fn}})
+}
+
+// flush 等待已加入队列的回执写入存储
+func (h *DeliveryHook) flush() {
+	done := make(chan struct{})
+	if h.send(deliveryOp{done: done}) {
+		<-done
+	}
+}
+
+// send 加入写入队列，Stop 后返回 false
+func (h *DeliveryHook) send(op deliveryOp) bool {
+	h.qmu.RLock()
+	defer h.qmu.RUnlock()
+	if h.stopped {
+		return false
+	}
+	h.queue <- op
+	return true
+}
+
+// run 从队列取出回执批量写入，每次写入当前已排队的全部回执
+func (h *DeliveryHook) run() {
+	defer close(h.done)
+
+	var batch []store.DeliveryUpdate
+	write := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := h.manager.UpdateDeliveries(h.token, batch); err != nil {
+			logger.Warn("投递回执保存失败", "count", len(batch), "error", err)
+		}
+		batch = batch[:0]
+	}
+
+	for op := range h.queue {
+		for {
+			if op.done != nil {
+				write()
+				close(op.done)
+			} else {
+				batch = append(batch, op.update)
+			}
+
+			var ok bool
+			select {
+			case op, ok = <-h.queue:
+				if !ok {
+					write()
+					return
+				}
+				continue
+			default:
+			}
+			break
+		}
+		write()
+	}
+}
+
+// packetMessageID 从用户属性中读取消息 ID
+func packetMessageID(pk packets.Packet) (uint64, bool) {
+	v := userProperty(pk.Properties, PropMessageID)
+	if v == "" {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(v, 10, 64)
+	return id, err == nil
+}
+
+// receiptMessageID 需要记录投递回执的消息 ID
+// 更新和撤回事件沿用原消息 ID，不是新的投递，不记录回执
+func receiptMessageID(pk packets.Packet) (uint64, bool) {
+	if userProperty(pk.Properties, PropUpdated) != "" || userProperty(pk.Properties, PropRecalled) != "" {
+		return 0, false
+	}
+	return packetMessageID(pk)
+}
+
+// Deliveries 获取消息的投递回执，包含已加入写入队列的回执
+func (b *Broker) Deliveries(id uint64) ([]store.Delivery, error) {
+	if b.storeManager == nil {
+		return []store.Delivery{}, nil
+	}
+	if b.delivery != nil {
+		b.delivery.flush()
+	}
+	return b.storeManager.Deliveries(b.config.AuthToken, id)
+}
@@ -0,0 +1,226 @@
+package broker
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+
+	"notice-server/store"
+)
+
+// freeAddr 获取一个空闲的本地 TCP 地址
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// serveTestServer 在空闲端口上启动 MQTT 服务，允许所有客户端连接，返回监听地址
+func serveTestServer(t *testing.T, server *mqtt.Server) string {
+	t.Helper()
+	if err := server.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatal(err)
+	}
+	addr := freeAddr(t)
+	if err := server.AddListener(listeners.NewTCP(listeners.Config{ID: "test", Address: addr})); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return addr
+}
+
+// testClient 以原始报文与服务端交互的 MQTT 3.1.1 客户端
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// dialTestClient 以非持久会话连接服务端并完成 CONNECT
+func dialTestClient(t *testing.T, addr, clientID string) *testClient {
+	t.Helper()
+	return dialTestSession(t, addr, clientID, true)
+}
+
+// dialTestSession 连接服务端并完成 CONNECT，clean 为 false 时断开后保留会话和离线队列
+func dialTestSession(t *testing.T, addr, clientID string, clean bool) *testClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	c := &testClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+	c.write(packets.Packet{
+		FixedHeader: packets.FixedHeader{Type: packets.Connect},
+		Connect: packets.ConnectParams{
+			ProtocolName:     []byte("MQTT"),
+			ClientIdentifier: clientID,
+			Clean:            clean,
+			Keepalive:        60,
+		},
+	})
+	if pk := c.read(); pk.FixedHeader.Type != packets.Connack || pk.ReasonCode != packets.CodeSuccess.Code {
+		t.Fatalf("连接失败: %+v", pk)
+	}
+	return c
+}
+
+func (c *testClient) write(pk packets.Packet) {
+	c.t.Helper()
+	pk.ProtocolVersion = 4
+	if err := writePacket(c.conn, pk); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *testClient) read() packets.Packet {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	pk, err := readPacket(c.r, 4, 0)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	return pk
+}
+
+// subscribe 以 QoS 1 订阅并等待 SUBACK
+func (c *testClient) subscribe(filter string) {
+	c.t.Helper()
+	c.write(packets.Packet{
+		FixedHeader: packets.FixedHeader{Type: packets.Subscribe, Qos: 1},
+		PacketID:    1,
+		Filters:     []packets.Subscription{{Filter: filter, Qos: 1}},
+	})
+	if pk := c.read(); pk.FixedHeader.Type != packets.Suback {
+		c.t.Fatalf("期望 SUBACK，收到报文类型 %d", pk.FixedHeader.Type)
+	}
+}
+
+// receive 读取下发的消息并确认，返回时服务端已处理 PUBACK
+func (c *testClient) receive() packets.Packet {
+	c.t.Helper()
+	pk := c.read()
+	if pk.FixedHeader.Type != packets.Publish {
+		c.t.Fatalf("期望 PUBLISH，收到报文类型 %d", pk.FixedHeader.Type)
+	}
+	c.write(packets.Packet{FixedHeader: packets.FixedHeader{Type: packets.Puback}, PacketID: pk.PacketID})
+	// 服务端按顺序处理同一连接的报文，收到 PINGRESP 说明 PUBACK 已处理
+	c.write(packets.Packet{FixedHeader: packets.FixedHeader{Type: packets.Pingreq}})
+	if resp := c.read(); resp.FixedHeader.Type != packets.Pingresp {
+		c.t.Fatalf("期望 PINGRESP，收到报文类型 %d", resp.FixedHeader.Type)
+	}
+	return pk
+}
+
+// newDeliveryTestBroker 创建启用存储和投递回执、监听本地端口的 Broker，返回监听地址
+func newDeliveryTestBroker(t *testing.T) (*Broker, string) {
+	t.Helper()
+	m := store.NewManager(t.TempDir(), true)
+	t.Cleanup(func() { m.Close() })
+
+	b := New("notice", Config{AuthToken: "token"}, m, nil, nil)
+	b.server = mqtt.New(&mqtt.Options{InlineClient: true})
+	b.delivery = newDeliveryHook(m, "token")
+	if err := b.server.AddHook(b.delivery, nil); err != nil {
+		t.Fatal(err)
+	}
+	return b, serveTestServer(t, b.server)
+}
+
+func TestDeliveriesAfterAck(t *testing.T) {
+	b, addr := newDeliveryTestBroker(t)
+	c := dialTestClient(t, addr, "phone")
+	c.subscribe("notice")
+
+	id, err := b.Publish("notice", Message{Title: "t", Content: "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.receive()
+
+	// 确认后立即查询，尚在写入队列中的回执也应可见
+	got, err := b.Deliveries(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ClientID != "phone" || got[0].Status != store.DeliveryDelivered || got[0].DeliveredAt == nil {
+		t.Fatalf("Deliveries() = %+v，期望 phone 已确认", got)
+	}
+	deliveredAt := *got[0].DeliveredAt
+
+	// 更新事件沿用原消息 ID，确认后不改变原消息的回执
+	if _, err := b.Edit("notice", id, Message{Content: "c2"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if pk := c.receive(); !strings.Contains(string(pk.Payload), `"updated":true`) {
+		t.Fatalf("期望收到更新事件: %+v", pk)
+	}
+	got, err = b.Deliveries(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].DeliveredAt == nil || !got[0].DeliveredAt.Equal(deliveredAt) {
+		t.Errorf("更新事件改变了回执: %+v", got)
+	}
+}
+
+func TestDeliveryHookClientIDs(t *testing.T) {
+	m := store.NewManager(t.TempDir(), true)
+	t.Cleanup(func() { m.Close() })
+	h := newDeliveryHook(m, "token")
+	t.Cleanup(func() { h.Stop() })
+
+	publish := func(id string, props ...packets.UserProperty) packets.Packet {
+		return packets.Packet{
+			FixedHeader: packets.FixedHeader{Type: packets.Publish, Qos: 1},
+			TopicName:   "notice",
+			PacketID:    1,
+			Properties:  packets.Properties{User: append([]packets.UserProperty{{Key: PropMessageID, Val: id}}, props...)},
+		}
+	}
+	puback := packets.Packet{FixedHeader: packets.FixedHeader{Type: packets.Puback}, PacketID: 1}
+
+	// Client ID 含 / 时，断开 a 不影响 a/b 的等待记录
+	a := &mqtt.Client{ID: "a"}
+	ab := &mqtt.Client{ID: "a/b"}
+	h.OnQosPublish(a, publish("7"), 0, 0)
+	h.OnQosPublish(ab, publish("7"), 0, 0)
+	h.OnDisconnect(a, nil, false)
+	h.OnQosComplete(ab, puback)
+
+	// 更新事件不记录回执
+	h.OnQosPublish(a, publish("8", packets.UserProperty{Key: PropUpdated, Val: "true"}), 0, 0)
+	h.OnQosComplete(a, puback)
+	h.flush()
+
+	got, err := m.Deliveries("token", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := map[string]string{}
+	for _, d := range got {
+		status[d.ClientID] = d.Status
+	}
+	if status["a"] != store.DeliveryQueued || status["a/b"] != store.DeliveryDelivered {
+		t.Errorf("回执状态 = %v，期望 a 等待确认、a/b 已确认", status)
+	}
+
+	if got, err := m.Deliveries("token", 8); err != nil || len(got) != 0 {
+		t.Errorf("更新事件的回执 = %+v, %v，期望为空", got, err)
+	}
+}
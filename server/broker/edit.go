@@ -0,0 +1,91 @@
+package broker
+
+import (
+	"errors"
+	"time"
+
+	"notice-server/logger"
+	"notice-server/store"
+)
+
+// ErrMessageRecalled 消息已被撤回
+var ErrMessageRecalled = errors.New("消息已撤回")
+
+// EditResult 更新消息的结果
+type EditResult struct {
+	ID      uint64 // 消息 ID
+	Created bool   // 指定的 Key 尚无消息，作为新消息发布
+	Edits   int    // 该消息的编辑历史条数
+}
+
+// Edit 更新已发布的消息：替换存储中的标题和内容（原版本追加到编辑历史），并向原主题发布更新事件
+// id 大于 0 时按 ID 更新，消息不存在返回 store.ErrNotFound；否则按 msg.Key 查找，
+// 尚无该 Key 的消息时作为新消息发布到 topic。按 ID 更新需启用存储；
+// 未启用存储时按 Key 的消息直接发布，客户端仍可按 key 原地替换
+// priority 为 nil 时保留原优先级，作为新消息发布时使用 msg.Priority
+func (b *Broker) Edit(topic string, id uint64, msg Message, priority *Priority) (EditResult, error) {
+	if b.storeManager == nil || !b.storeManager.IsEnabled() {
+		if id > 0 {
+			return EditResult{}, store.ErrDisabled
+		}
+		id, err := b.Publish(topic, msg)
+		return EditResult{ID: id, Created: true}, err
+	}
+
+	b.editMu.Lock()
+	defer b.editMu.Unlock()
+
+	if id == 0 {
+		existing, err := b.storeManager.GetByKey(b.config.AuthToken, msg.Key)
+		if errors.Is(err, store.ErrNotFound) {
+			id, err := b.Publish(topic, msg)
+			return EditResult{ID: id, Created: true}, err
+		}
+		if err != nil {
+			return EditResult{}, err
+		}
+		id = existing.ID
+	}
+
+	now := time.Now()
+	recalled := false
+	saved, err := b.storeManager.Update(b.config.AuthToken, id, func(m *store.Message) {
+		if recalled = m.Recalled(); !recalled {
+			m.ApplyEdit(msg.Title, msg.Content, msg.Extra, (*string)(priority), now)
+		}
+	})
+	if err != nil {
+		return EditResult{}, err
+	}
+	if recalled {
+		return EditResult{}, ErrMessageRecalled
+	}
+
+	// 更新事件携带完整的新版本，发布到原消息的主题（已含优先级后缀）
+	event := Message{
+		ID:        saved.ID,
+		Title:     saved.Title,
+		Content:   saved.Content,
+		Extra:     saved.Extra,
+		Timestamp: now,
+		Client:    msg.Client,
+		Priority:  Priority(saved.Priority),
+		GroupKey:  saved.GroupKey,
+		Tags:      saved.Tags,
+		Key:       saved.Key,
+		Updated:   true,
+	}
+	if err := b.publishMessage(saved.Topic, event); err != nil {
+		return EditResult{}, err
+	}
+	logger.Debug("消息已更新", "id", saved.ID, "key", saved.Key, "edits", len(saved.Edits))
+	return EditResult{ID: saved.ID, Edits: len(saved.Edits)}, nil
+}
+
+// MessageByKey 按 Key 查找已保存的消息，未启用存储时返回 store.ErrDisabled
+func (b *Broker) MessageByKey(key string) (*store.Message, error) {
+	if b.storeManager == nil || !b.storeManager.IsEnabled() {
+		return nil, store.ErrDisabled
+	}
+	return b.storeManager.GetByKey(b.config.AuthToken, key)
+}
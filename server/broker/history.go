@@ -0,0 +1,225 @@
+package broker
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+
+	"notice-server/logger"
+)
+
+const (
+	// historyPrefix 订阅时回放历史的主题过滤器前缀：$history/<n>/<filter>
+	historyPrefix = "$history/"
+	// historySubProp 订阅包的用户属性，值为回放条数，对包内所有过滤器生效（MQTT 5）
+	historySubProp = "history"
+
+	historyMaxReplay = 100  // 单个过滤器最多回放的消息数
+	historyMaxScan   = 5000 // 查找匹配消息时最多检查的历史消息数
+)
+
+// HistoryHook 订阅时按需回放消息历史
+// 客户端以 $history/<n>/<filter> 订阅，或在订阅包中携带 history=<n> 用户属性时，
+// 订阅成功后立即收到该过滤器匹配的最近 n 条历史消息，消息带有 replay 标记以区别于实时消息
+type HistoryHook struct {
+	mqtt.HookBase
+	broker  *Broker
+	pending map[string][]int // 客户端 ID -> 各过滤器的回放条数，OnSubscribe 记录、OnSubscribed 取出
+	mu      sync.Mutex
+}
+
+func newHistoryHook(b *Broker) *HistoryHook {
+	return &HistoryHook{
+		broker:  b,
+		pending: make(map[string][]int),
+	}
+}
+
+func (h *HistoryHook) ID() string {
+	return "history"
+}
+
+func (h *HistoryHook) Provides(b byte) bool {
+	return b == mqtt.OnSubscribe ||
+		b == mqtt.OnSubscribed ||
+		b == mqtt.OnDisconnect
+}
+
+// OnSubscribe 解析回放请求，并将 $history/<n>/ 前缀还原为实际的主题过滤器
+func (h *HistoryHook) OnSubscribe(cl *mqtt.Client, pk packets.Packet) packets.Packet {
+	defaultCount := 0
+	if v := userProperty(pk.Properties, historySubProp); v != "" {
+		defaultCount = parseHistoryCount(v)
+	}
+
+	counts := make([]int, len(pk.Filters))
+	replay := false
+	for i := range pk.Filters {
+		filter, n, ok := parseHistoryFilter(pk.Filters[i].Filter)
+		if ok {
+			pk.Filters[i].Filter = filter
+		} else {
+			n = defaultCount
+		}
+		// 共享订阅的消息只投递给组内一个成员，不回放
+		if n > 0 && !mqtt.IsSharedFilter(pk.Filters[i].Filter) {
+			counts[i] = n
+			replay = true
+		}
+	}
+
+	if replay {
+		h.mu.Lock()
+		h.pending[cl.ID] = counts
+		h.mu.Unlock()
+	}
+	return pk
+}
+
+// OnSubscribed 订阅成功的过滤器按请求回放历史
+func (h *HistoryHook) OnSubscribed(cl *mqtt.Client, pk packets.Packet, reasonCodes []byte) {
+	h.mu.Lock()
+	counts, ok := h.pending[cl.ID]
+	delete(h.pending, cl.ID)
+	h.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	for i, sub := range pk.Filters {
+		if i >= len(counts) || i >= len(reasonCodes) || counts[i] == 0 || reasonCodes[i] >= packets.ErrUnspecifiedError.Code {
+			continue
+		}
+		h.replay(cl, sub, counts[i])
+	}
+}
+
+// OnDisconnect 清理未处理的回放请求
+func (h *HistoryHook) OnDisconnect(cl *mqtt.Client, err error, expire bool) {
+	h.mu.Lock()
+	delete(h.pending, cl.ID)
+	h.mu.Unlock()
+}
+
+// replay 向客户端下发过滤器匹配的最近 n 条历史消息
+func (h *HistoryHook) replay(cl *mqtt.Client, sub packets.Subscription, n int) {
+	b := h.broker
+	if b.storeManager == nil || !b.storeManager.IsEnabled() {
+		logger.Debug("未启用存储，跳过历史回放", "client_id", cl.ID, "filter", sub.Filter)
+		return
+	}
+
+	msgs, err := b.storeManager.Recent(b.config.AuthToken, n, historyMaxScan, func(topic string) bool {
+		return matchTopic(sub.Filter, topic)
+	})
+	if err != nil {
+		logger.Warn("读取历史消息失败", "client_id", cl.ID, "filter", sub.Filter, "error", err)
+		return
+	}
+
+	sent := 0
+	for _, m := range msgs {
+		if m.Recalled() {
+			continue
+		}
+		msg := Message{
+			ID:        m.ID,
+			Title:     m.Title,
+			Content:   m.Content,
+			Extra:     m.Extra,
+			Timestamp: m.Timestamp,
+			Priority:  Priority(m.Priority),
+			GroupKey:  m.GroupKey,
+			Tags:      m.Tags,
+			Key:       m.Key,
+			Replayed:  true,
+		}
+		payload, err := json.Marshal(msg)
+		if err != nil {
+			continue
+		}
+
+		props := messageProperties(msg)
+		setMessageID(&props, msg.ID)
+		setUserProperty(&props, PropReplay, "true")
+
+		if err := b.deliverTo(cl, packets.Packet{
+			FixedHeader: packets.FixedHeader{
+				Type: packets.Publish,
+				Qos:  min(sub.Qos, 1),
+			},
+			TopicName:  m.Topic,
+			Payload:    payload,
+			Properties: props,
+		}); err != nil {
+			logger.Warn("历史回放中断", "client_id", cl.ID, "filter", sub.Filter, "sent", sent, "error", err)
+			return
+		}
+		sent++
+	}
+	logger.Info("MQTT 历史回放", "client_id", cl.ID, "filter", sub.Filter, "requested", n, "sent", sent)
+}
+
+// deliverTo 直接向单个客户端下发消息，QoS 1 消息进入客户端会话的飞行队列，断线重连后重发
+func (b *Broker) deliverTo(cl *mqtt.Client, pk packets.Packet) error {
+	if cl.Closed() {
+		return packets.CodeDisconnect
+	}
+
+	pk.Created = time.Now().Unix()
+	if b.config.MessageExpiry > 0 {
+		pk.Expiry = pk.Created + int64(b.config.MessageExpiry)
+	}
+
+	if pk.FixedHeader.Qos > 0 {
+		if cl.State.Inflight.Len() >= int(b.server.Options.Capabilities.MaximumInflight) {
+			return packets.ErrQuotaExceeded
+		}
+		id, err := cl.NextPacketID()
+		if err != nil {
+			return packets.ErrQuotaExceeded
+		}
+		pk.PacketID = uint16(id)
+		if cl.State.Inflight.Set(pk) {
+			atomic.AddInt64(&b.server.Info.Inflight, 1)
+			cl.State.Inflight.DecreaseSendQuota()
+			if b.storageHook != nil {
+				b.storageHook.OnQosPublish(cl, pk, pk.Created, 0)
+			}
+		}
+	}
+
+	return cl.WritePacket(pk)
+}
+
+// parseHistoryFilter 解析 $history/<n>/<filter>，返回实际过滤器和回放条数
+func parseHistoryFilter(filter string) (string, int, bool) {
+	rest, ok := strings.CutPrefix(filter, historyPrefix)
+	if !ok {
+		return filter, 0, false
+	}
+	count, real, ok := strings.Cut(rest, "/")
+	if !ok || real == "" {
+		return filter, 0, false
+	}
+	n := parseHistoryCount(count)
+	if n == 0 {
+		return filter, 0, false
+	}
+	return real, n, true
+}
+
+// parseHistoryCount 解析回放条数，无效时返回 0，超过上限时取上限
+func parseHistoryCount(s string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || n < 1 {
+		return 0
+	}
+	return min(n, historyMaxReplay)
+}
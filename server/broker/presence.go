@@ -0,0 +1,237 @@
+package broker
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+
+	"notice-server/logger"
+)
+
+// ClientInfo 客户端在线状态
+type ClientInfo struct {
+	ClientID        string     `json:"client_id"`
+	Online          bool       `json:"online"`
+	Remote          string     `json:"remote,omitempty"`           // 远端地址
+	Listener        string     `json:"listener,omitempty"`         // 监听器：tcp / ws
+	ProtocolVersion byte       `json:"protocol_version,omitempty"` // MQTT 协议版本：3 / 4 / 5
+	ConnectedAt     *time.Time `json:"connected_at,omitempty"`
+	DisconnectedAt  *time.Time `json:"disconnected_at,omitempty"`
+	LastSeen        *time.Time `json:"last_seen,omitempty"` // 最后一次收到该客户端数据包的时间
+	Subscriptions   []string   `json:"subscriptions"`
+}
+
+// PresenceEvent 上线/下线事件，发布到 <presence_topic>/<client_id>
+type PresenceEvent struct {
+	ClientID        string    `json:"client_id"`
+	Online          bool      `json:"online"`
+	Remote          string    `json:"remote,omitempty"`
+	Listener        string    `json:"listener,omitempty"`
+	ProtocolVersion byte      `json:"protocol_version,omitempty"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+// presence 单个客户端的在线记录
+type presence struct {
+	online         bool
+	remote         string
+	listener       string
+	version        byte
+	connectedAt    time.Time
+	disconnectedAt time.Time
+	lastSeen       time.Time
+}
+
+// PresenceHook 客户端在线状态跟踪钩子
+type PresenceHook struct {
+	mqtt.HookBase
+	broker  *Broker
+	topic   string // 在线事件主题前缀，为空则不发布事件
+	clients map[string]*presence
+	mu      sync.RWMutex
+}
+
+// newPresenceHook 创建在线状态跟踪钩子
+func newPresenceHook(b *Broker, topic string) *PresenceHook {
+	return &PresenceHook{
+		broker:  b,
+		topic:   topic,
+		clients: make(map[string]*presence),
+	}
+}
+
+func (h *PresenceHook) ID() string {
+	return "presence"
+}
+
+func (h *PresenceHook) Provides(b byte) bool {
+	return b == mqtt.OnSessionEstablished ||
+		b == mqtt.OnDisconnect ||
+		b == mqtt.OnPacketRead ||
+		b == mqtt.OnClientExpired
+}
+
+// OnSessionEstablished 客户端认证通过并建立会话
+func (h *PresenceHook) OnSessionEstablished(cl *mqtt.Client, pk packets.Packet) {
+	if cl.Net.Inline {
+		return
+	}
+
+	now := time.Now()
+	h.mu.Lock()
+	h.clients[cl.ID] = &presence{
+		online:      true,
+		remote:      cl.Net.Remote,
+		listener:    cl.Net.Listener,
+		version:     cl.Properties.ProtocolVersion,
+		connectedAt: now,
+		lastSeen:    now,
+	}
+	h.mu.Unlock()
+
+	h.publish(cl, true, now, true)
+}
+
+// OnDisconnect 客户端断开
+func (h *PresenceHook) OnDisconnect(cl *mqtt.Client, err error, expire bool) {
+	// 会话被同一 Client ID 的新连接接管时，新连接已上线，不记为下线
+	if cl.Net.Inline || cl.IsTakenOver() {
+		return
+	}
+
+	now := time.Now()
+	h.mu.Lock()
+	if expire {
+		// 非持久会话，断开即清除
+		delete(h.clients, cl.ID)
+	} else if p, ok := h.clients[cl.ID]; ok {
+		p.online = false
+		p.disconnectedAt = now
+	}
+	h.mu.Unlock()
+
+	// 非持久会话随断开结束，下线事件不保留，并清除该客户端的保留事件
+	h.publish(cl, false, now, !expire)
+	if expire {
+		h.clear(cl.ID)
+	}
+}
+
+// OnPacketRead 更新最后活跃时间
+func (h *PresenceHook) OnPacketRead(cl *mqtt.Client, pk packets.Packet) (packets.Packet, error) {
+	h.mu.Lock()
+	if p, ok := h.clients[cl.ID]; ok {
+		p.lastSeen = time.Now()
+	}
+	h.mu.Unlock()
+	return pk, nil
+}
+
+// OnClientExpired 持久会话过期
+func (h *PresenceHook) OnClientExpired(cl *mqtt.Client) {
+	h.mu.Lock()
+	delete(h.clients, cl.ID)
+	h.mu.Unlock()
+
+	h.clear(cl.ID)
+}
+
+// publish 发布上线/下线事件，retain 时以保留消息发布，新订阅者可立即获取当前状态
+func (h *PresenceHook) publish(cl *mqtt.Client, online bool, ts time.Time, retain bool) {
+	if h.topic == "" {
+		return
+	}
+
+	payload, err := json.Marshal(PresenceEvent{
+		ClientID:        cl.ID,
+		Online:          online,
+		Remote:          cl.Net.Remote,
+		Listener:        cl.Net.Listener,
+		ProtocolVersion: cl.Properties.ProtocolVersion,
+		Timestamp:       ts,
+	})
+	if err != nil {
+		return
+	}
+
+	topic := h.topic + "/" + cl.ID
+	if err := h.broker.server.Publish(topic, payload, retain, 0); err != nil {
+		logger.Warn("在线事件发布失败", "topic", topic, "error", err)
+	}
+}
+
+// clear 会话结束后发布空的保留消息，清除该客户端的保留事件
+func (h *PresenceHook) clear(clientID string) {
+	if h.topic == "" {
+		return
+	}
+	topic := h.topic + "/" + clientID
+	if err := h.broker.server.Publish(topic, nil, true, 0); err != nil {
+		logger.Warn("在线事件清除失败", "topic", topic, "error", err)
+	}
+}
+
+// get 获取客户端的在线记录副本
+func (h *PresenceHook) get(id string) (presence, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	p, ok := h.clients[id]
+	if !ok {
+		return presence{}, false
+	}
+	return *p, true
+}
+
+// Clients 获取所有已知客户端（在线及保留会话的离线客户端）的状态，按 Client ID 排序
+func (b *Broker) Clients() []ClientInfo {
+	list := []ClientInfo{}
+	for _, cl := range b.server.Clients.GetAll() {
+		if cl.Net.Inline {
+			continue
+		}
+		list = append(list, b.clientInfo(cl))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ClientID < list[j].ClientID
+	})
+	return list
+}
+
+// clientInfo 汇总 mochi 客户端状态与在线记录
+func (b *Broker) clientInfo(cl *mqtt.Client) ClientInfo {
+	info := ClientInfo{
+		ClientID:        cl.ID,
+		Online:          !cl.Closed(),
+		Remote:          cl.Net.Remote,
+		Listener:        cl.Net.Listener,
+		ProtocolVersion: cl.Properties.ProtocolVersion,
+		Subscriptions:   []string{},
+	}
+	for filter := range cl.State.Subscriptions.GetAll() {
+		info.Subscriptions = append(info.Subscriptions, filter)
+	}
+	sort.Strings(info.Subscriptions)
+
+	if b.presence == nil {
+		return info
+	}
+	// 重启后从持久化存储恢复的会话没有在线记录
+	if p, ok := b.presence.get(cl.ID); ok {
+		info.ConnectedAt = timePtr(p.connectedAt)
+		info.DisconnectedAt = timePtr(p.disconnectedAt)
+		info.LastSeen = timePtr(p.lastSeen)
+	}
+	return info
+}
+
+// timePtr 零值时间返回 nil，便于 JSON 省略
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
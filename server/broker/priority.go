@@ -0,0 +1,227 @@
+package broker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+// Priority 消息优先级：min / low / default / high / urgent
+// 默认优先级以空字符串表示，序列化时省略，与未指定优先级的旧消息一致
+type Priority string
+
+const (
+	PriorityMin     Priority = "min"
+	PriorityLow     Priority = "low"
+	PriorityDefault Priority = ""
+	PriorityHigh    Priority = "high"
+	PriorityUrgent  Priority = "urgent"
+)
+
+// priorityLevels 数字等级 1-5 与名称的对应
+var priorityLevels = []Priority{PriorityMin, PriorityLow, PriorityDefault, PriorityHigh, PriorityUrgent}
+
+// ParsePriority 解析优先级，支持名称（不区分大小写）和数字等级 1-5，空字符串为默认优先级
+func ParsePriority(s string) (Priority, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "", "default":
+		return PriorityDefault, nil
+	case string(PriorityMin), string(PriorityLow), string(PriorityHigh), string(PriorityUrgent):
+		return Priority(s), nil
+	}
+	if n, err := strconv.Atoi(s); err == nil && n >= 1 && n <= len(priorityLevels) {
+		return priorityLevels[n-1], nil
+	}
+	return PriorityDefault, fmt.Errorf("priority 无效: %s，可选 min / low / default / high / urgent 或 1-5", s)
+}
+
+// UnmarshalJSON 支持字符串和数字等级
+func (p *Priority) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, []byte("null")) {
+		*p = PriorityDefault
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		var n json.Number
+		if err := json.Unmarshal(b, &n); err != nil {
+			return fmt.Errorf("priority 无效: %s", b)
+		}
+		s = n.String()
+	}
+	parsed, err := ParsePriority(s)
+	if err != nil {
+		return err
+	}
+	*p = parsed
+	return nil
+}
+
+// String 返回优先级名称，默认优先级为 "default"
+func (p Priority) String() string {
+	if p == PriorityDefault {
+		return "default"
+	}
+	return string(p)
+}
+
+// qos 服务端发布消息使用的 QoS：紧急消息使用 QoS 2，其余为 QoS 1
+// 实际下发的 QoS 仍受订阅时授予的 QoS 限制
+func (p Priority) qos() byte {
+	if p == PriorityUrgent {
+		return 2
+	}
+	return 1
+}
+
+// topic 启用优先级主题时非默认优先级的消息发布到 <topic>/<priority>
+func (p Priority) topic(topic string, enabled bool) string {
+	if !enabled || p == PriorityDefault {
+		return topic
+	}
+	return topic + "/" + string(p)
+}
+
+// packetPriority 读取消息的优先级：优先取用户属性，其次取 JSON 负载中的 priority 字段
+func packetPriority(pk packets.Packet) (Priority, error) {
+	if v := userProperty(pk.Properties, PropPriority); v != "" {
+		return ParsePriority(v)
+	}
+	if !isJSONContent(pk.Properties) || !bytes.Contains(pk.Payload, []byte(`"priority"`)) {
+		return PriorityDefault, nil
+	}
+	var fields struct {
+		Priority json.RawMessage `json:"priority"`
+	}
+	if err := json.Unmarshal(pk.Payload, &fields); err != nil || fields.Priority == nil {
+		return PriorityDefault, nil
+	}
+	var p Priority
+	err := p.UnmarshalJSON(fields.Priority)
+	return p, err
+}
+
+// PriorityHook 消息优先级
+// 客户端直接发布的消息将 JSON 中的 priority 写入用户属性，便于存储和订阅端按属性过滤；
+// 离线队列和保留消息按 message_expiry 过期由本钩子检查（mochi 不再强制最大过期时间），
+// 紧急消息在离线队列中不受 message_expiry 限制，保留到会话过期
+type PriorityHook struct {
+	mqtt.HookBase
+	broker   *Broker
+	expiry   int64 // 消息过期时间（秒），0 表示不过期
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func newPriorityHook(b *Broker) *PriorityHook {
+	return &PriorityHook{
+		broker: b,
+		expiry: int64(b.config.MessageExpiry),
+		done:   make(chan struct{}),
+	}
+}
+
+func (h *PriorityHook) ID() string {
+	return "priority"
+}
+
+func (h *PriorityHook) Provides(b byte) bool {
+	return b == mqtt.OnPublish
+}
+
+// Init 启用消息过期时启动过期检查
+func (h *PriorityHook) Init(config any) error {
+	if h.expiry > 0 {
+		go h.expireLoop()
+	}
+	return nil
+}
+
+// Stop 停止过期检查
+func (h *PriorityHook) Stop() error {
+	h.stopOnce.Do(func() { close(h.done) })
+	return nil
+}
+
+// OnPublish 规范化优先级用户属性，无效的优先级按默认处理（严格模式下由校验钩子拒绝）
+func (h *PriorityHook) OnPublish(cl *mqtt.Client, pk packets.Packet) (packets.Packet, error) {
+	if len(pk.TopicName) > 0 && pk.TopicName[0] == '$' {
+		return pk, nil
+	}
+
+	p, err := packetPriority(pk)
+	if err != nil || p == PriorityDefault {
+		removeUserProperty(&pk.Properties, PropPriority)
+		return pk, nil
+	}
+	setUserProperty(&pk.Properties, PropPriority, string(p))
+	return pk, nil
+}
+
+// expireLoop 每秒检查一次过期消息，与 mochi 清理过期消息的间隔相同
+func (h *PriorityHook) expireLoop() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-ticker.C:
+			h.expire(time.Now().Unix())
+		}
+	}
+}
+
+// expire 清理存在时间超过 message_expiry 的离线消息和保留消息，紧急消息除外
+// 发布者通过 v5 属性指定的消息过期时间仍由 mochi 处理
+func (h *PriorityHook) expire(now int64) {
+	b := h.broker
+	for _, cl := range b.server.Clients.GetAll() {
+		for _, pk := range cl.State.Inflight.GetAll(false) {
+			if now-pk.Created <= h.expiry || urgentPacket(pk) {
+				continue
+			}
+			b.dropInflight(cl, pk)
+		}
+	}
+
+	for filter, pk := range b.server.Topics.Retained.GetAll() {
+		if now-pk.Created <= h.expiry {
+			continue
+		}
+		b.server.Topics.Retained.Delete(filter)
+		if b.storageHook != nil {
+			b.storageHook.OnRetainedExpired(filter)
+		}
+	}
+}
+
+// urgentPacket 是否为紧急消息
+func urgentPacket(pk packets.Packet) bool {
+	return pk.FixedHeader.Type == packets.Publish && Priority(userProperty(pk.Properties, PropPriority)) == PriorityUrgent
+}
+
+// dropInflight 从客户端的离线队列中移除消息，并像 mochi 清理过期消息一样通知持久化和投递回执
+func (b *Broker) dropInflight(cl *mqtt.Client, pk packets.Packet) bool {
+	if !cl.State.Inflight.Delete(pk.PacketID) {
+		return false
+	}
+	atomic.AddInt64(&b.server.Info.Inflight, -1)
+	if b.storageHook != nil {
+		b.storageHook.OnQosDropped(cl, pk)
+	}
+	if b.delivery != nil {
+		b.delivery.OnQosDropped(cl, pk)
+	}
+	return true
+}
@@ -0,0 +1,144 @@
+package broker
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+// MQTT v5 用户属性键，便于轻量订阅端和桥接按元数据路由而无需解析 JSON
+const (
+	PropTitle     = "title"      // 消息标题
+	PropClient    = "client"     // 发送端标识
+	PropPriority  = "priority"   // 消息优先级
+	PropGroupKey  = "group_key"  // 去重分组键
+	PropTags      = "tags"       // 标签，逗号分隔
+	PropMessageID = "message_id" // 存储中的消息 ID
+	PropBridge    = "bridge"     // 经桥接转发时的桥接名称，用于防止消息循环
+	PropReplay    = "replay"     // 订阅时回放的历史消息
+	PropUpdated   = "updated"    // 对已发布消息的更新
+	PropRecalled  = "recalled"   // 撤回事件，值为被撤回的消息 ID
+)
+
+const (
+	// ContentTypeJSON 服务端发布消息的内容类型
+	ContentTypeJSON = "application/json"
+)
+
+// reservedProps 有专门含义的用户属性，不会作为 extra 元数据存储
+var reservedProps = map[string]bool{
+	PropTitle:     true,
+	PropClient:    true,
+	PropPriority:  true,
+	PropGroupKey:  true,
+	PropTags:      true,
+	PropMessageID: true,
+	PropBridge:    true,
+	PropReplay:    true,
+	PropUpdated:   true,
+	PropRecalled:  true,
+}
+
+// messageProperties 根据消息构建 MQTT v5 属性
+func messageProperties(msg Message) packets.Properties {
+	props := packets.Properties{
+		ContentType:       ContentTypeJSON,
+		PayloadFormat:     1, // UTF-8 编码
+		PayloadFormatFlag: true,
+	}
+	if msg.Title != "" {
+		props.User = append(props.User, packets.UserProperty{Key: PropTitle, Val: msg.Title})
+	}
+	if msg.Client != "" {
+		props.User = append(props.User, packets.UserProperty{Key: PropClient, Val: msg.Client})
+	}
+	if msg.Priority != PriorityDefault {
+		props.User = append(props.User, packets.UserProperty{Key: PropPriority, Val: string(msg.Priority)})
+	}
+	if msg.GroupKey != "" {
+		props.User = append(props.User, packets.UserProperty{Key: PropGroupKey, Val: msg.GroupKey})
+	}
+	if len(msg.Tags) > 0 {
+		props.User = append(props.User, packets.UserProperty{Key: PropTags, Val: strings.Join(msg.Tags, ",")})
+	}
+	if msg.Updated {
+		props.User = append(props.User, packets.UserProperty{Key: PropUpdated, Val: "true"})
+	}
+	if msg.Recalled {
+		props.User = append(props.User, packets.UserProperty{Key: PropRecalled, Val: strconv.FormatUint(msg.ID, 10)})
+	}
+	return props
+}
+
+// userProperty 获取指定用户属性的值（取第一个）
+func userProperty(props packets.Properties, key string) string {
+	for _, p := range props.User {
+		if p.Key == key {
+			return p.Val
+		}
+	}
+	return ""
+}
+
+// setUserProperty 设置用户属性，已存在则覆盖
+func setUserProperty(props *packets.Properties, key, val string) {
+	for i := range props.User {
+		if props.User[i].Key == key {
+			props.User[i].Val = val
+			return
+		}
+	}
+	props.User = append(props.User, packets.UserProperty{Key: key, Val: val})
+}
+
+// removeUserProperty 删除指定用户属性
+func removeUserProperty(props *packets.Properties, key string) {
+	props.User = slices.DeleteFunc(props.User, func(p packets.UserProperty) bool {
+		return p.Key == key
+	})
+}
+
+// splitTags 解析逗号分隔的标签，忽略空白项
+func splitTags(s string) []string {
+	var tags []string
+	for t := range strings.SplitSeq(s, ",") {
+		if t = strings.TrimSpace(t); t != "" && !slices.Contains(tags, t) {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// setMessageID 将存储消息 ID 写入用户属性
+func setMessageID(props *packets.Properties, id uint64) {
+	setUserProperty(props, PropMessageID, strconv.FormatUint(id, 10))
+}
+
+// metadataProperties 提取非保留的用户属性作为元数据，没有则返回 nil
+func metadataProperties(props packets.Properties) map[string]string {
+	var meta map[string]string
+	for _, p := range props.User {
+		if reservedProps[p.Key] {
+			continue
+		}
+		if meta == nil {
+			meta = make(map[string]string)
+		}
+		meta[p.Key] = p.Val
+	}
+	return meta
+}
+
+// isJSONContent 根据 content-type 判断负载是否可能为 JSON（未声明时视为可能）
+func isJSONContent(props packets.Properties) bool {
+	ct := strings.TrimSpace(strings.ToLower(props.ContentType))
+	if ct == "" {
+		return true
+	}
+	if i := strings.Index(ct, ";"); i >= 0 {
+		ct = strings.TrimSpace(ct[:i])
+	}
+	return ct == ContentTypeJSON || strings.HasSuffix(ct, "+json")
+}
@@ -0,0 +1,52 @@
+package broker
+
+import (
+	"time"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+
+	"notice-server/logger"
+	"notice-server/ratelimit"
+)
+
+// PublishLimitHook 客户端发布限流钩子
+// 按客户端认证使用的凭据和来源 IP 限制，额度与使用同一凭据或来自同一 IP 的 Webhook 请求共享
+type PublishLimitHook struct {
+	mqtt.HookBase
+	limiter *ratelimit.PublishLimiter
+	auth    *AuthHook
+}
+
+func (h *PublishLimitHook) ID() string {
+	return "publish-limit"
+}
+
+func (h *PublishLimitHook) Provides(b byte) bool {
+	return b == mqtt.OnPublish
+}
+
+// OnPublish 超出限额的消息不投递也不存储，MQTT 5 的 QoS 1/2 消息以 Quota Exceeded (0x97) 确认
+func (h *PublishLimitHook) OnPublish(cl *mqtt.Client, pk packets.Packet) (packets.Packet, error) {
+	// 内置客户端的消息（Webhook、桥接）已在入口处限流或不受限
+	if cl.Net.Inline {
+		return pk, nil
+	}
+
+	ip := ratelimit.RemoteIP(cl.Net.Remote)
+	credential := h.auth.credential(cl.ID)
+	res := h.limiter.Allow(credential, ip)
+	if res.Allowed {
+		return pk, nil
+	}
+
+	logger.Warn("MQTT 发布超出限额",
+		"client_id", cl.ID,
+		"credential", credential,
+		"ip", ip,
+		"topic", pk.TopicName,
+		"daily_quota", res.Quota,
+		"retry_after", res.RetryAfter.Round(time.Second).String(),
+	)
+	return pk, rejectPublish(cl, pk, packets.ErrQuotaExceeded)
+}
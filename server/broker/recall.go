@@ -0,0 +1,110 @@
+package broker
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/mochi-mqtt/server/v2/packets"
+
+	"notice-server/logger"
+	"notice-server/store"
+)
+
+// ErrRecallForbidden 撤回其他凭据发布的消息
+var ErrRecallForbidden = errors.New("只能撤回自己发布的消息")
+
+// RecallResult 撤回消息的结果
+type RecallResult struct {
+	ID         uint64    `json:"id"`
+	RecalledAt time.Time `json:"recalled_at"`
+	Purged     int       `json:"purged"` // 从离线队列中移除的数量
+}
+
+// Recall 撤回已发布的消息：标记存储中的消息为已撤回，向原主题发布撤回事件，
+// 并从离线客户端的队列中移除尚未下发的原消息。需启用存储，消息不存在返回 store.ErrNotFound
+// 重复撤回时保留首次撤回时间，重新发布撤回事件
+// credential 为撤回使用的凭据名称：管理员可撤回任意消息，其他凭据只能撤回自己发布的消息，否则返回 ErrRecallForbidden
+func (b *Broker) Recall(id uint64, credential string) (RecallResult, error) {
+	if b.storeManager == nil || !b.storeManager.IsEnabled() {
+		return RecallResult{}, store.ErrDisabled
+	}
+
+	// 与编辑串行，避免撤回后又被更新
+	b.editMu.Lock()
+	defer b.editMu.Unlock()
+
+	existing, err := b.storeManager.Get(b.config.AuthToken, id)
+	if err != nil {
+		return RecallResult{}, err
+	}
+	if credential != CredentialAdmin && existing.Publisher != credential {
+		return RecallResult{}, ErrRecallForbidden
+	}
+
+	now := time.Now()
+	saved, err := b.storeManager.Update(b.config.AuthToken, id, func(m *store.Message) {
+		if !m.Recalled() {
+			m.RecalledAt = now
+		}
+	})
+	if err != nil {
+		return RecallResult{}, err
+	}
+
+	// 撤回事件保留原标题，不识别撤回事件的客户端也能看出是哪条消息被撤回
+	event := Message{
+		ID:        saved.ID,
+		Title:     saved.Title,
+		Content:   "此消息已被撤回",
+		Timestamp: now,
+		Priority:  Priority(saved.Priority),
+		Key:       saved.Key,
+		Recalled:  true,
+	}
+	if err := b.publishMessage(saved.Topic, event); err != nil {
+		return RecallResult{}, err
+	}
+
+	purged := b.purgeRecalled(saved.ID)
+	logger.Info("消息已撤回", "id", saved.ID, "topic", saved.Topic, "purged", purged)
+	return RecallResult{ID: saved.ID, RecalledAt: saved.RecalledAt, Purged: purged}, nil
+}
+
+// purgeRecalled 从离线客户端的队列中移除被撤回的消息，返回移除的原消息数量
+// 这些客户端从未收到原消息，撤回事件也一并移除；在线客户端可能已显示原消息，保留其队列由撤回事件处理
+// 移除的原消息由投递回执钩子记为未送达
+func (b *Broker) purgeRecalled(id uint64) int {
+	idStr := strconv.FormatUint(id, 10)
+	purged := 0
+	for _, cl := range b.server.Clients.GetAll() {
+		if cl.Net.Inline || !cl.Closed() {
+			continue
+		}
+
+		var original, events []packets.Packet
+		for _, pk := range cl.State.Inflight.GetAll(false) {
+			if pk.FixedHeader.Type != packets.Publish {
+				continue
+			}
+			if msgID, ok := packetMessageID(pk); ok && msgID == id {
+				original = append(original, pk)
+			} else if userProperty(pk.Properties, PropRecalled) == idStr {
+				events = append(events, pk)
+			}
+		}
+		if len(original) == 0 {
+			continue
+		}
+
+		for _, pk := range original {
+			if b.dropInflight(cl, pk) {
+				purged++
+			}
+		}
+		for _, pk := range events {
+			b.dropInflight(cl, pk)
+		}
+	}
+	return purged
+}
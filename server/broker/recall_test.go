@@ -0,0 +1,67 @@
+package broker
+
+import (
+	"errors"
+	"testing"
+
+	"notice-server/store"
+)
+
+func TestRecall(t *testing.T) {
+	b, addr := newDeliveryTestBroker(t)
+
+	// 持久会话断开后，消息进入离线队列
+	c := dialTestSession(t, addr, "phone", false)
+	c.subscribe("notice")
+	c.conn.Close()
+	waitFor(t, "客户端断开", func() bool {
+		cl, ok := b.server.Clients.Get("phone")
+		return ok && cl.Closed()
+	})
+
+	id, err := b.Publish("notice", Message{Title: "t", Content: "c", Publisher: CredentialToken})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl, _ := b.server.Clients.Get("phone")
+	if n := cl.State.Inflight.Len(); n != 1 {
+		t.Fatalf("离线队列长度 = %d，期望 1", n)
+	}
+
+	// 其他凭据不能撤回
+	if _, err := b.Recall(id, "github"); !errors.Is(err, ErrRecallForbidden) {
+		t.Fatalf("Recall(github) error = %v，期望 ErrRecallForbidden", err)
+	}
+	if msg, err := b.storeManager.Get("token", id); err != nil || msg.Recalled() {
+		t.Fatalf("被拒绝的撤回不应标记消息: %+v, %v", msg, err)
+	}
+
+	result, err := b.Recall(id, CredentialToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Purged != 1 {
+		t.Errorf("Purged = %d，期望 1", result.Purged)
+	}
+	// 原消息和撤回事件都从离线队列中移除
+	if n := cl.State.Inflight.Len(); n != 0 {
+		t.Errorf("撤回后离线队列长度 = %d，期望 0", n)
+	}
+
+	got, err := b.Deliveries(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ClientID != "phone" || got[0].Status != store.DeliveryDropped {
+		t.Errorf("Deliveries() = %+v，期望 phone 未送达", got)
+	}
+
+	// 管理员可撤回任意凭据发布的消息
+	id, err = b.Publish("notice", Message{Title: "t", Content: "c", Publisher: "github"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Recall(id, CredentialAdmin); err != nil {
+		t.Errorf("Recall(admin) error = %v", err)
+	}
+}
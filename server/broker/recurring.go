@@ -0,0 +1,407 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"notice-server/logger"
+	"notice-server/store"
+)
+
+// recurringMaxMissed 统计错过次数的上限，避免 @every 1s 之类的表达式在长时间停机后空转
+const recurringMaxMissed = 10000
+
+// recurringClient 周期消息的发送端标识
+const recurringClient = "recurring"
+
+var recurringNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// ErrInvalidRecurring 周期消息定义无效（名称、cron 表达式、时区或模板）
+var ErrInvalidRecurring = errors.New("周期消息定义无效")
+
+// ErrRecurringReadOnly 配置文件定义的周期消息不能通过接口修改或删除
+var ErrRecurringReadOnly = errors.New("配置文件定义的周期消息不能通过接口修改")
+
+// RecurringConfig 周期消息配置
+type RecurringConfig struct {
+	Name     string // 名称，唯一
+	Cron     string // cron 表达式（分 时 日 月 周），支持 @daily、@every 1h 和 CRON_TZ= 前缀
+	Timezone string // 时区，默认服务器本地时区
+	Topic    string // 发布主题，为空则使用默认主题
+	Title    string // 标题模板
+	Content  string // 内容模板
+	Priority string // 优先级：min / low / default / high / urgent 或 1-5
+	CatchUp  bool   // 停机期间错过的执行是否在启动后补发一次
+}
+
+// RecurringData 标题和内容模板可用的数据
+type RecurringData struct {
+	Name   string    // 周期消息名称
+	Time   time.Time // 本次计划执行时间（所在时区）
+	Missed int       // 补发时停机期间错过的次数，正常执行为 0
+}
+
+// RecurringInfo 周期消息及下次执行时间
+type RecurringInfo struct {
+	store.Recurring
+	NextRun time.Time `json:"next_run,omitzero"`
+}
+
+// recurringJob 已解析的周期消息
+type recurringJob struct {
+	def      store.Recurring
+	sched    cron.Schedule
+	loc      *time.Location
+	title    *template.Template
+	content  *template.Template
+	priority Priority
+	next     time.Time // 下次计划执行时间
+	missed   int       // 下次执行需补发的错过次数
+}
+
+// compileRecurring 校验并解析周期消息定义
+func compileRecurring(def store.Recurring) (*recurringJob, error) {
+	if !recurringNamePattern.MatchString(def.Name) {
+		return nil, errors.New("名称只能包含字母、数字、_ . -，长度 1-64")
+	}
+	if strings.TrimSpace(def.Content) == "" {
+		return nil, errors.New("内容模板不能为空")
+	}
+	priority, err := ParsePriority(def.Priority)
+	if err != nil {
+		return nil, err
+	}
+	def.Priority = string(priority)
+
+	loc := time.Local
+	if def.Timezone != "" {
+		l, err := time.LoadLocation(def.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("时区无效: %s", def.Timezone)
+		}
+		loc = l
+	}
+
+	spec := strings.TrimSpace(def.Cron)
+	if def.Timezone != "" && !strings.HasPrefix(spec, "CRON_TZ=") && !strings.HasPrefix(spec, "TZ=") {
+		spec = "CRON_TZ=" + def.Timezone + " " + spec
+	}
+	sched, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("cron 表达式无效: %v", err)
+	}
+
+	title, err := template.New("title").Option("missingkey=error").Parse(def.Title)
+	if err != nil {
+		return nil, fmt.Errorf("标题模板无效: %v", err)
+	}
+	content, err := template.New("content").Option("missingkey=error").Parse(def.Content)
+	if err != nil {
+		return nil, fmt.Errorf("内容模板无效: %v", err)
+	}
+
+	return &recurringJob{
+		def:      def,
+		sched:    sched,
+		loc:      loc,
+		title:    title,
+		content:  content,
+		priority: priority,
+	}, nil
+}
+
+// plan 根据上次执行时间计算下次执行，处理停机期间错过的执行
+// catch_up 时立即补发一次（携带错过次数），否则跳过并记录到 SkippedUntil
+func (j *recurringJob) plan(now time.Time) {
+	ref := j.def.CreatedAt
+	for _, t := range []time.Time{j.def.LastRun, j.def.SkippedUntil} {
+		if t.After(ref) {
+			ref = t
+		}
+	}
+
+	var last time.Time
+	missed := 0
+	for t := j.sched.Next(ref); !t.IsZero() && !t.After(now) && missed < recurringMaxMissed; t = j.sched.Next(t) {
+		last = t
+		missed++
+	}
+
+	j.missed = 0
+	j.next = j.sched.Next(now)
+	if missed == 0 {
+		return
+	}
+	if j.def.CatchUp {
+		j.next = last
+		j.missed = missed
+		return
+	}
+	j.def.SkippedUntil = last
+	logger.Info("跳过停机期间错过的周期消息", "name", j.def.Name, "missed", missed)
+}
+
+// render 渲染标题和内容模板
+func (j *recurringJob) render(data RecurringData) (title, content string, err error) {
+	var sb strings.Builder
+	if err := j.title.Execute(&sb, data); err != nil {
+		return "", "", err
+	}
+	title = sb.String()
+	sb.Reset()
+	if err := j.content.Execute(&sb, data); err != nil {
+		return "", "", err
+	}
+	return title, sb.String(), nil
+}
+
+// loadRecurring 将配置文件中的周期消息同步到存储，并加载所有周期消息
+// 配置中已删除的条目从存储中移除，已有条目保留执行状态
+func (s *scheduler) loadRecurring(list []RecurringConfig) {
+	b := s.broker
+	token := b.config.AuthToken
+
+	stored, err := b.storeManager.ListRecurring(token)
+	if err != nil {
+		logger.Error("读取周期消息失败", "error", err)
+		return
+	}
+	existing := make(map[string]store.Recurring, len(stored))
+	for _, r := range stored {
+		existing[r.Name] = r
+	}
+
+	configured := make(map[string]bool, len(list))
+	for _, c := range list {
+		def := store.Recurring{
+			Name:     c.Name,
+			Cron:     c.Cron,
+			Timezone: c.Timezone,
+			Topic:    c.Topic,
+			Title:    c.Title,
+			Content:  c.Content,
+			Priority: c.Priority,
+			CatchUp:  c.CatchUp,
+			Source:   store.RecurringSourceConfig,
+		}
+		if configured[def.Name] {
+			logger.Warn("周期消息名称重复，已忽略", "name", def.Name)
+			continue
+		}
+		if _, err := compileRecurring(def); err != nil {
+			logger.Error("周期消息配置无效", "name", def.Name, "error", err)
+			continue
+		}
+		configured[def.Name] = true
+
+		if old, ok := existing[def.Name]; ok {
+			def.LastRun = old.LastRun
+			def.LastID = old.LastID
+			def.SkippedUntil = old.SkippedUntil
+			def.CreatedAt = old.CreatedAt
+			if old.Cron != def.Cron || old.Timezone != def.Timezone || old.Topic != def.Topic ||
+				old.Title != def.Title || old.Content != def.Content || old.Priority != def.Priority || old.CatchUp != def.CatchUp || old.Source != def.Source {
+				def.UpdatedAt = time.Now()
+			} else {
+				def.UpdatedAt = old.UpdatedAt
+			}
+		}
+		if err := b.storeManager.SaveRecurring(token, &def); err != nil {
+			logger.Error("周期消息保存失败", "name", def.Name, "error", err)
+			continue
+		}
+		existing[def.Name] = def
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, def := range existing {
+		if def.Source == store.RecurringSourceConfig && !configured[name] {
+			if err := b.storeManager.DeleteRecurring(token, name); err != nil && !errors.Is(err, store.ErrNotFound) {
+				logger.Error("周期消息删除失败", "name", name, "error", err)
+			}
+			logger.Info("周期消息已从配置中移除", "name", name)
+			continue
+		}
+
+		job, err := compileRecurring(def)
+		if err != nil {
+			logger.Error("周期消息无效，已跳过", "name", name, "error", err)
+			continue
+		}
+		job.plan(now)
+		if job.missed == 0 && !job.def.SkippedUntil.Equal(def.SkippedUntil) {
+			s.saveRecurring(job)
+		}
+		s.jobs[name] = job
+	}
+	if len(s.jobs) > 0 {
+		logger.Info("周期消息已加载", "count", len(s.jobs))
+	}
+}
+
+// saveRecurring 保存周期消息执行状态，调用方需持有锁
+func (s *scheduler) saveRecurring(job *recurringJob) {
+	b := s.broker
+	def := job.def
+	if err := b.storeManager.SaveRecurring(b.config.AuthToken, &def); err != nil {
+		logger.Error("周期消息状态保存失败", "name", def.Name, "error", err)
+	}
+}
+
+// runRecurring 执行所有到期的周期消息，返回距下一次执行的时间
+func (s *scheduler) runRecurring(now time.Time) time.Duration {
+	b := s.broker
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wait := schedulerMaxWait
+	for _, job := range s.jobs {
+		if job.next.IsZero() {
+			continue
+		}
+		if job.next.After(now) {
+			wait = min(wait, job.next.Sub(now))
+			continue
+		}
+
+		data := RecurringData{Name: job.def.Name, Time: job.next.In(job.loc), Missed: job.missed}
+		title, content, err := job.render(data)
+		if err != nil {
+			logger.Error("周期消息模板渲染失败", "name", job.def.Name, "error", err)
+		} else {
+			topic := job.def.Topic
+			if topic == "" {
+				topic = b.topic
+			}
+			id, err := b.Publish(topic, Message{
+				Title:     title,
+				Content:   content,
+				Extra:     job.def.Extra,
+				Timestamp: time.Now(),
+				Client:    recurringClient,
+				Priority:  job.priority,
+			})
+			if err != nil {
+				// 发布失败时不推进，下次循环重试
+				logger.Error("周期消息发布失败", "name", job.def.Name, "error", err)
+				continue
+			}
+			job.def.LastID = id
+			logger.Info("周期消息已发送", "name", job.def.Name, "id", id, "topic", topic, "missed", job.missed)
+		}
+
+		job.def.LastRun = job.next
+		job.missed = 0
+		job.next = job.sched.Next(now)
+		s.saveRecurring(job)
+		if !job.next.IsZero() {
+			wait = min(wait, job.next.Sub(now))
+		}
+	}
+	return max(wait, 0)
+}
+
+// Recurring 获取所有周期消息及下次执行时间，按名称排序
+func (b *Broker) Recurring() ([]RecurringInfo, error) {
+	if b.scheduler == nil {
+		return []RecurringInfo{}, nil
+	}
+	list, err := b.storeManager.ListRecurring(b.config.AuthToken)
+	if err != nil {
+		return nil, err
+	}
+
+	s := b.scheduler
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	infos := make([]RecurringInfo, 0, len(list))
+	for _, r := range list {
+		info := RecurringInfo{Recurring: r}
+		if job, ok := s.jobs[r.Name]; ok {
+			info.NextRun = job.next
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// SaveRecurring 通过接口创建或更新周期消息，定义无效时返回校验错误
+// 更新已有周期消息时保留执行状态，从当前时间开始计划下次执行
+func (b *Broker) SaveRecurring(def store.Recurring) (*RecurringInfo, error) {
+	if b.scheduler == nil {
+		return nil, ErrSchedulerDisabled
+	}
+
+	def.Source = store.RecurringSourceAPI
+	def.LastRun = time.Time{}
+	def.LastID = 0
+	def.SkippedUntil = time.Time{}
+	def.CreatedAt = time.Time{}
+	def.UpdatedAt = time.Time{}
+	job, err := compileRecurring(def)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRecurring, err)
+	}
+
+	s := b.scheduler
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	old, err := b.storeManager.GetRecurring(b.config.AuthToken, def.Name)
+	switch {
+	case err == nil:
+		if old.Source == store.RecurringSourceConfig {
+			return nil, ErrRecurringReadOnly
+		}
+		job.def.LastRun = old.LastRun
+		job.def.LastID = old.LastID
+		job.def.CreatedAt = old.CreatedAt
+		job.def.UpdatedAt = now
+	case errors.Is(err, store.ErrNotFound):
+		job.def.CreatedAt = now
+	default:
+		return nil, err
+	}
+
+	job.next = job.sched.Next(now)
+	def = job.def
+	if err := b.storeManager.SaveRecurring(b.config.AuthToken, &def); err != nil {
+		return nil, err
+	}
+	s.jobs[def.Name] = job
+	s.notify()
+	return &RecurringInfo{Recurring: def, NextRun: job.next}, nil
+}
+
+// DeleteRecurring 删除通过接口创建的周期消息，不存在时返回 store.ErrNotFound
+func (b *Broker) DeleteRecurring(name string) error {
+	if b.scheduler == nil {
+		return store.ErrNotFound
+	}
+
+	s := b.scheduler
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, err := b.storeManager.GetRecurring(b.config.AuthToken, name)
+	if err != nil {
+		return err
+	}
+	if old.Source == store.RecurringSourceConfig {
+		return ErrRecurringReadOnly
+	}
+	if err := b.storeManager.DeleteRecurring(b.config.AuthToken, name); err != nil {
+		return err
+	}
+	delete(s.jobs, name)
+	return nil
+}
@@ -0,0 +1,500 @@
+package broker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+
+	"notice-server/logger"
+	"notice-server/ratelimit"
+)
+
+// RuleConfig 消息路由规则
+type RuleConfig struct {
+	Name     string    // 规则名称
+	Match    RuleMatch // 匹配条件，全部满足才命中
+	Topic    string    // 改写主题，支持模板
+	Topics   []string  // 分发到多个主题，支持模板，与 Topic 二选一
+	Priority string    // 设置优先级，为空则不修改
+	Tags     []string  // 追加标签
+	Drop     bool      // 丢弃消息
+	Continue bool      // 命中后继续匹配后续规则
+}
+
+// RuleMatch 路由规则的匹配条件，为空的条件不参与匹配
+type RuleMatch struct {
+	Topic      string            // 主题正则
+	Title      string            // 标题正则
+	Content    string            // 内容正则
+	Client     []string          // 发送端标识，任一相同即满足
+	Extra      map[string]string // extra 字段（点号分隔的路径）-> 正则
+	IP         []string          // 来源 IP 或 CIDR
+	Credential []string          // 凭据名称，如 token
+}
+
+// RouteInput 路由的输入
+type RouteInput struct {
+	Topic      string  // 请求指定或默认的主题
+	Message    Message // 待发布的消息
+	IP         string  // 来源 IP
+	Credential string  // 发布使用的凭据名称
+}
+
+// RouteResult 路由结果
+type RouteResult struct {
+	Rules   []string `json:"rules"`   // 命中的规则名称，按匹配顺序
+	Dropped bool     `json:"dropped"` // 消息被规则丢弃
+	Topics  []string `json:"topics"`  // 发布主题，丢弃时为空
+	Message Message  `json:"message"` // 规则修改后的消息（优先级、标签）
+}
+
+// RuleData 主题模板可用的数据
+type RuleData struct {
+	Topic      string            // 当前主题
+	Title      string            // 标题
+	Content    string            // 内容
+	Client     string            // 发送端标识
+	Priority   string            // 优先级名称
+	Extra      any               // 额外数据
+	IP         string            // 来源 IP
+	Credential string            // 凭据名称
+	Match      map[string]string // 正则中的命名分组，如 (?P<host>\w+) 可用 {{.Match.host}}
+}
+
+// rule 已解析的路由规则
+type rule struct {
+	def        RuleConfig
+	topic      *regexp.Regexp
+	title      *regexp.Regexp
+	content    *regexp.Regexp
+	extra      map[string]*regexp.Regexp
+	prefixes   []netip.Prefix
+	topics     []*template.Template
+	priority   Priority
+	priorityOK bool // 是否设置优先级
+}
+
+// compileRules 校验并解析路由规则，任一规则无效时返回错误
+func compileRules(list []RuleConfig) ([]*rule, error) {
+	rules := make([]*rule, 0, len(list))
+	for i, def := range list {
+		if def.Name == "" {
+			def.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		r, err := compileRule(def)
+		if err != nil {
+			return nil, fmt.Errorf("路由规则 %s: %w", def.Name, err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+func compileRule(def RuleConfig) (*rule, error) {
+	r := &rule{def: def}
+
+	var err error
+	if r.topic, err = compileMatch("topic", def.Match.Topic); err != nil {
+		return nil, err
+	}
+	if r.title, err = compileMatch("title", def.Match.Title); err != nil {
+		return nil, err
+	}
+	if r.content, err = compileMatch("content", def.Match.Content); err != nil {
+		return nil, err
+	}
+	if len(def.Match.Extra) > 0 {
+		r.extra = make(map[string]*regexp.Regexp, len(def.Match.Extra))
+		for path, expr := range def.Match.Extra {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("extra.%s 正则无效: %v", path, err)
+			}
+			r.extra[path] = re
+		}
+	}
+	for _, s := range def.Match.IP {
+		p, err := parsePrefix(s)
+		if err != nil {
+			return nil, err
+		}
+		r.prefixes = append(r.prefixes, p)
+	}
+
+	if def.Topic != "" && len(def.Topics) > 0 {
+		return nil, fmt.Errorf("topic 与 topics 只能指定一个")
+	}
+	targets := def.Topics
+	if def.Topic != "" {
+		targets = []string{def.Topic}
+	}
+	for _, t := range targets {
+		tmpl, err := template.New("topic").Option("missingkey=zero").Parse(t)
+		if err != nil {
+			return nil, fmt.Errorf("主题模板无效: %v", err)
+		}
+		r.topics = append(r.topics, tmpl)
+	}
+
+	for _, t := range def.Tags {
+		if strings.TrimSpace(t) == "" || strings.Contains(t, ",") {
+			return nil, fmt.Errorf("标签不能为空或包含逗号: %q", t)
+		}
+	}
+
+	if def.Priority != "" {
+		if r.priority, err = ParsePriority(def.Priority); err != nil {
+			return nil, err
+		}
+		r.priorityOK = true
+	}
+	return r, nil
+}
+
+// compileMatch 编译匹配条件中的正则，为空时返回 nil
+func compileMatch(name, expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%s 正则无效: %v", name, err)
+	}
+	return re, nil
+}
+
+// parsePrefix 解析 IP 或 CIDR，单个 IP 视为完整前缀
+func parsePrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("ip 无效: %s", s)
+		}
+		return p.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("ip 无效: %s", s)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// match 判断消息是否满足规则的匹配条件，满足时返回正则中的命名分组
+func (r *rule) match(topic string, in RouteInput) (map[string]string, bool) {
+	m := in.Message
+	groups := map[string]string{}
+
+	if !matchRegexp(r.topic, topic, groups) ||
+		!matchRegexp(r.title, m.Title, groups) ||
+		!matchRegexp(r.content, m.Content, groups) {
+		return nil, false
+	}
+	if len(r.def.Match.Client) > 0 && !slices.Contains(r.def.Match.Client, m.Client) {
+		return nil, false
+	}
+	if len(r.def.Match.Credential) > 0 && !slices.Contains(r.def.Match.Credential, in.Credential) {
+		return nil, false
+	}
+	if len(r.prefixes) > 0 {
+		addr, err := netip.ParseAddr(in.IP)
+		if err != nil {
+			return nil, false
+		}
+		addr = addr.Unmap()
+		if !slices.ContainsFunc(r.prefixes, func(p netip.Prefix) bool { return p.Contains(addr) }) {
+			return nil, false
+		}
+	}
+	for path, re := range r.extra {
+		v, ok := extraField(m.Extra, path)
+		if !ok || !matchRegexp(re, v, groups) {
+			return nil, false
+		}
+	}
+	return groups, true
+}
+
+// matchRegexp 正则为 nil 时视为满足，匹配时收集命名分组
+func matchRegexp(re *regexp.Regexp, s string, groups map[string]string) bool {
+	if re == nil {
+		return true
+	}
+	sub := re.FindStringSubmatch(s)
+	if sub == nil {
+		return false
+	}
+	for i, name := range re.SubexpNames() {
+		if name != "" {
+			groups[name] = sub[i]
+		}
+	}
+	return true
+}
+
+// extraField 按点号分隔的路径读取 extra 中的字段，转为字符串
+func extraField(extra any, path string) (string, bool) {
+	v := extra
+	for key := range strings.SplitSeq(path, ".") {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return "", false
+		}
+		if v, ok = obj[key]; !ok {
+			return "", false
+		}
+	}
+	switch v := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return v, true
+	case map[string]any, []any:
+		return "", false
+	default:
+		return fmt.Sprint(v), true
+	}
+}
+
+// renderTopics 渲染规则的目标主题，含通配符或为空的主题被忽略
+func (r *rule) renderTopics(data RuleData) []string {
+	var topics []string
+	for _, tmpl := range r.topics {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			logger.Warn("路由规则主题渲染失败", "rule", r.def.Name, "error", err)
+			continue
+		}
+		t := strings.Trim(strings.TrimSpace(buf.String()), "/")
+		if t == "" || strings.ContainsAny(t, "+#") || strings.HasPrefix(t, "$") {
+			logger.Warn("路由规则生成的主题无效，已忽略", "rule", r.def.Name, "topic", t)
+			continue
+		}
+		if !slices.Contains(topics, t) {
+			topics = append(topics, t)
+		}
+	}
+	return topics
+}
+
+// Route 按路由规则处理待发布的消息，返回发布主题和修改后的消息
+// 规则按顺序匹配，命中后停止，除非规则设置了 continue；未命中任何规则时原样发布到 in.Topic
+func (b *Broker) Route(in RouteInput) RouteResult {
+	res := RouteResult{
+		Rules:   []string{},
+		Topics:  []string{in.Topic},
+		Message: in.Message,
+	}
+	res.Message.Tags = slices.Clone(in.Message.Tags)
+	for _, r := range b.rules {
+		in.Message = res.Message
+		groups, ok := r.match(res.Topics[0], in)
+		if !ok {
+			continue
+		}
+		res.Rules = append(res.Rules, r.def.Name)
+
+		if r.def.Drop {
+			res.Dropped = true
+			res.Topics = []string{}
+			return res
+		}
+
+		if r.priorityOK {
+			res.Message.Priority = r.priority
+		}
+		for _, t := range r.def.Tags {
+			if !slices.Contains(res.Message.Tags, t) {
+				res.Message.Tags = append(res.Message.Tags, t)
+			}
+		}
+		if len(r.topics) > 0 {
+			m := res.Message
+			topics := r.renderTopics(RuleData{
+				Topic:      res.Topics[0],
+				Title:      m.Title,
+				Content:    m.Content,
+				Client:     m.Client,
+				Priority:   m.Priority.String(),
+				Extra:      m.Extra,
+				IP:         in.IP,
+				Credential: in.Credential,
+				Match:      groups,
+			})
+			if len(topics) > 0 {
+				res.Topics = topics
+			}
+		}
+
+		if !r.def.Continue {
+			break
+		}
+	}
+	return res
+}
+
+// RulesHook 对客户端直接发布的消息应用路由规则，与 Webhook 使用同一组规则
+// 丢弃的消息照常确认后不投递也不存储；改写主题时消息发布到第一个目标主题，
+// 其余目标主题由内置客户端发布副本；优先级和标签同时写入用户属性和 JSON 负载
+type RulesHook struct {
+	mqtt.HookBase
+	broker *Broker
+	auth   *AuthHook
+}
+
+func (h *RulesHook) ID() string {
+	return "rules"
+}
+
+func (h *RulesHook) Provides(b byte) bool {
+	return b == mqtt.OnPublish
+}
+
+// OnPublish 按路由规则处理消息（须在优先级钩子之后、消息存储钩子之前）
+func (h *RulesHook) OnPublish(cl *mqtt.Client, pk packets.Packet) (packets.Packet, error) {
+	// 内置客户端的消息（Webhook、规则生成的副本等）已在入口路由；$ 主题为系统消息
+	if cl.Net.Inline || (len(pk.TopicName) > 0 && pk.TopicName[0] == '$') {
+		return pk, nil
+	}
+
+	b := h.broker
+	title, content, extra := parsePayload(pk)
+	priority, _ := packetPriority(pk) // 已由优先级钩子规范化
+	client, tags := packetSender(pk)
+	msg := Message{
+		Title:    title,
+		Content:  content,
+		Extra:    extra,
+		Client:   client,
+		Priority: priority,
+		Tags:     tags,
+	}
+	route := b.Route(RouteInput{
+		Topic:      pk.TopicName,
+		Message:    msg,
+		IP:         ratelimit.RemoteIP(cl.Net.Remote),
+		Credential: h.auth.credential(cl.ID),
+	})
+	if len(route.Rules) == 0 {
+		return pk, nil
+	}
+
+	if route.Dropped {
+		logger.Info("消息已按规则丢弃", "client_id", cl.ID, "topic", pk.TopicName, "rules", route.Rules)
+		return pk, packets.CodeSuccessIgnore
+	}
+	logger.Debug("消息命中路由规则", "client_id", cl.ID, "rules", route.Rules, "topics", route.Topics)
+
+	m := route.Message
+	if m.Priority != msg.Priority || !slices.Equal(m.Tags, msg.Tags) {
+		if m.Priority == PriorityDefault {
+			removeUserProperty(&pk.Properties, PropPriority)
+		} else {
+			setUserProperty(&pk.Properties, PropPriority, string(m.Priority))
+		}
+		if len(m.Tags) > 0 {
+			setUserProperty(&pk.Properties, PropTags, strings.Join(m.Tags, ","))
+		}
+		pk.Payload = routedPayload(pk, m)
+	}
+
+	pk.TopicName = route.Topics[0]
+	for _, topic := range route.Topics[1:] {
+		if err := b.injectCopy(topic, pk); err != nil {
+			logger.Warn("路由规则副本发布失败", "topic", topic, "error", err)
+		}
+	}
+	return pk, nil
+}
+
+// packetSender 读取消息的发送端标识和标签：优先取用户属性，其次取 JSON 负载中的 client、tags 字段
+func packetSender(pk packets.Packet) (client string, tags []string) {
+	client = userProperty(pk.Properties, PropClient)
+	tags = splitTags(userProperty(pk.Properties, PropTags))
+	if (client != "" && tags != nil) || !isJSONContent(pk.Properties) {
+		return client, tags
+	}
+
+	var fields struct {
+		Client string   `json:"client"`
+		Tags   []string `json:"tags"`
+	}
+	if err := json.Unmarshal(pk.Payload, &fields); err != nil {
+		return client, tags
+	}
+	if client == "" {
+		client = fields.Client
+	}
+	if tags == nil {
+		tags = splitTags(strings.Join(fields.Tags, ","))
+	}
+	return client, tags
+}
+
+// routedPayload 将规则设置的优先级和标签写入 JSON 负载，非 JSON 对象的负载原样返回
+func routedPayload(pk packets.Packet, m Message) []byte {
+	if !isJSONContent(pk.Properties) {
+		return pk.Payload
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(pk.Payload, &fields); err != nil || fields == nil {
+		return pk.Payload
+	}
+
+	delete(fields, "priority")
+	if m.Priority != PriorityDefault {
+		fields["priority"], _ = json.Marshal(m.Priority)
+	}
+	if len(m.Tags) > 0 {
+		fields["tags"], _ = json.Marshal(m.Tags)
+	}
+	payload, err := json.Marshal(fields)
+	if err != nil {
+		return pk.Payload
+	}
+	return payload
+}
+
+// injectCopy 以内置客户端身份将消息副本发布到规则的其他目标主题
+func (b *Broker) injectCopy(topic string, pk packets.Packet) error {
+	cl, ok := b.server.Clients.Get(mqtt.InlineClientId)
+	if !ok {
+		return mqtt.ErrInlineClientNotEnabled
+	}
+
+	props := pk.Properties.Copy(false)
+	removeUserProperty(&props, PropMessageID)
+	return b.server.InjectPacket(cl, packets.Packet{
+		FixedHeader: packets.FixedHeader{
+			Type:   packets.Publish,
+			Qos:    pk.FixedHeader.Qos,
+			Retain: pk.FixedHeader.Retain,
+		},
+		TopicName:  topic,
+		Payload:    pk.Payload,
+		Properties: props,
+		PacketID:   1,
+	})
+}
+
+// loadRules 解析配置中的路由规则
+func (b *Broker) loadRules() error {
+	rules, err := compileRules(b.config.Rules)
+	if err != nil {
+		return err
+	}
+	b.rules = rules
+	if len(rules) > 0 {
+		logger.Info("路由规则已加载", "count", len(rules))
+	}
+	return nil
+}
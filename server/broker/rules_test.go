@@ -0,0 +1,108 @@
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+func TestRulesHook(t *testing.T) {
+	b, rec := newTestBroker(t, Config{Rules: []RuleConfig{
+		{Name: "drop-debug", Match: RuleMatch{Title: "^debug"}, Drop: true},
+		{Name: "disk", Match: RuleMatch{Content: `(?P<host>\w+) disk`}, Priority: "high", Tags: []string{"disk"}, Topics: []string{"ops/{{.Match.host}}", "ops/all"}},
+		{Name: "lan", Match: RuleMatch{IP: []string{"192.168.0.0/16"}, Client: []string{"cli"}}, Topic: "notice/lan"},
+	}})
+	if err := b.loadRules(); err != nil {
+		t.Fatal(err)
+	}
+	h := &RulesHook{broker: b, auth: &AuthHook{}}
+
+	tests := []struct {
+		name     string
+		remote   string
+		topic    string
+		payload  string
+		dropped  bool
+		topic2   string   // 处理后的主题
+		priority string   // 用户属性中的优先级
+		tags     []string // JSON 负载中的标签
+		copies   int      // 内置客户端发布的副本数
+	}{
+		{"未命中", "10.0.0.1:1000", "notice", `{"title":"a","content":"b"}`, false, "notice", "", nil, 0},
+		{"丢弃", "10.0.0.1:1000", "notice", `{"title":"debug info","content":"b"}`, true, "notice", "", nil, 0},
+		{"改写并分发", "10.0.0.1:1000", "notice", `{"title":"告警","content":"web1 disk full","tags":["prod"]}`, false, "ops/web1", "high", []string{"prod", "disk"}, 1},
+		{"按来源和发送端", "192.168.1.5:1000", "notice", `{"title":"a","content":"b","client":"cli"}`, false, "notice/lan", "", nil, 0},
+		{"发送端不符", "192.168.1.5:1000", "notice", `{"title":"a","content":"b","client":"web"}`, false, "notice", "", nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := rec.count()
+			cl := &mqtt.Client{ID: "phone", Net: mqtt.ClientConnection{Remote: tt.remote}}
+			pk := packets.Packet{
+				FixedHeader: packets.FixedHeader{Type: packets.Publish, Qos: 1},
+				TopicName:   tt.topic,
+				Payload:     []byte(tt.payload),
+			}
+
+			got, err := h.OnPublish(cl, pk)
+			if dropped := errors.Is(err, packets.CodeSuccessIgnore); dropped != tt.dropped {
+				t.Fatalf("OnPublish() error = %v, 期望丢弃 %v", err, tt.dropped)
+			}
+			if tt.dropped {
+				return
+			}
+			if err != nil {
+				t.Fatalf("OnPublish() error = %v", err)
+			}
+
+			if got.TopicName != tt.topic2 {
+				t.Errorf("主题 = %q, 期望 %q", got.TopicName, tt.topic2)
+			}
+			if p := userProperty(got.Properties, PropPriority); p != tt.priority {
+				t.Errorf("优先级 = %q, 期望 %q", p, tt.priority)
+			}
+			var fields struct {
+				Priority string   `json:"priority"`
+				Tags     []string `json:"tags"`
+			}
+			if err := json.Unmarshal(got.Payload, &fields); err != nil {
+				t.Fatal(err)
+			}
+			if fields.Priority != tt.priority || !slices.Equal(fields.Tags, tt.tags) {
+				t.Errorf("负载 = %s, 期望优先级 %q 标签 %v", got.Payload, tt.priority, tt.tags)
+			}
+			if n := rec.count() - before; n != tt.copies {
+				t.Errorf("副本数 = %d, 期望 %d", n, tt.copies)
+			}
+			if tt.copies > 0 && rec.last() != string(got.Payload) {
+				t.Errorf("副本负载 = %s, 期望 %s", rec.last(), got.Payload)
+			}
+		})
+	}
+}
+
+func TestRulesHookSkip(t *testing.T) {
+	b, _ := newTestBroker(t, Config{Rules: []RuleConfig{{Name: "all", Drop: true}}})
+	if err := b.loadRules(); err != nil {
+		t.Fatal(err)
+	}
+	h := &RulesHook{broker: b, auth: &AuthHook{}}
+
+	// 内置客户端和系统主题的消息不经过规则
+	for _, tc := range []struct {
+		cl    *mqtt.Client
+		topic string
+	}{
+		{&mqtt.Client{ID: mqtt.InlineClientId, Net: mqtt.ClientConnection{Inline: true}}, "notice"},
+		{&mqtt.Client{ID: "phone"}, "$SYS/notice/stats"},
+	} {
+		pk := packets.Packet{FixedHeader: packets.FixedHeader{Type: packets.Publish}, TopicName: tc.topic, Payload: []byte("x")}
+		if _, err := h.OnPublish(tc.cl, pk); err != nil {
+			t.Errorf("%s %s: OnPublish() error = %v", tc.cl.ID, tc.topic, err)
+		}
+	}
+}
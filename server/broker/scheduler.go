@@ -0,0 +1,217 @@
+package broker
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"notice-server/logger"
+	"notice-server/store"
+)
+
+// schedulerMaxWait 调度器最长休眠时间，防止系统时间调整后错过发送
+const schedulerMaxWait = time.Minute
+
+// 定时消息发布失败后按指数退避重试，用尽次数后标记为失败，保留在列表中等待取消
+const (
+	scheduledRetryBase = 30 * time.Second
+	scheduledRetryMax  = time.Hour
+	scheduledMaxTries  = 10
+)
+
+// ErrSchedulerDisabled 未启用持久化存储时无法保存定时消息和周期消息
+var ErrSchedulerDisabled = errors.New("定时消息需要启用持久化存储")
+
+// scheduler 定时消息和周期消息调度器
+// 定时消息保存在消息存储中，到期后通过 Publish 发布并删除，服务重启后继续调度；
+// 周期消息的定义和执行状态同样保存在存储中，见 recurring.go
+type scheduler struct {
+	broker *Broker
+	jobs   map[string]*recurringJob // 周期消息名称 -> 已解析的周期消息
+	mu     sync.Mutex
+	wake   chan struct{}
+	done   chan struct{}
+}
+
+func newScheduler(b *Broker) *scheduler {
+	return &scheduler{
+		broker: b,
+		jobs:   make(map[string]*recurringJob),
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+}
+
+// notify 唤醒调度器重新计算下次发送时间
+func (s *scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *scheduler) close() {
+	close(s.done)
+}
+
+func (s *scheduler) run() {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.wake:
+		case <-timer.C:
+		}
+
+		now := time.Now()
+		wait := min(s.publishDue(now), s.runRecurring(now))
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+	}
+}
+
+// publishDue 发布所有到期的定时消息，返回距下一条到期的时间
+// 单条发布失败只推迟该条的重试，不影响其他定时消息
+func (s *scheduler) publishDue(now time.Time) time.Duration {
+	b := s.broker
+	list, err := b.storeManager.ListScheduled(b.config.AuthToken)
+	if err != nil {
+		logger.Error("读取定时消息失败", "error", err)
+		return schedulerMaxWait
+	}
+
+	wait := schedulerMaxWait
+	for _, sm := range list {
+		if sm.Failed {
+			continue
+		}
+		if due := sm.DueAt(); due.After(now) {
+			wait = min(wait, due.Sub(now))
+			continue
+		}
+
+		// 先发布后删除：发布后、删除前服务中断时重启会再次发送，但不会丢失
+		id, err := b.Publish(sm.Topic, Message{
+			Title:     sm.Title,
+			Content:   sm.Content,
+			Extra:     sm.Extra,
+			Timestamp: time.Now(),
+			Client:    sm.Client,
+			Priority:  Priority(sm.Priority),
+			GroupKey:  sm.GroupKey,
+			Tags:      sm.Tags,
+			Publisher: sm.Publisher,
+		})
+		if err != nil {
+			if retry := s.retryScheduled(&sm, now, err); retry > 0 {
+				wait = min(wait, retry)
+			}
+			continue
+		}
+		if err := b.storeManager.DeleteScheduled(b.config.AuthToken, sm.ID); err != nil && !errors.Is(err, store.ErrNotFound) {
+			logger.Error("定时消息删除失败", "scheduled_id", sm.ID, "error", err)
+		}
+		logger.Info("定时消息已发送", "scheduled_id", sm.ID, "id", id, "topic", sm.Topic, "delay", now.Sub(sm.SendAt).Round(time.Millisecond))
+	}
+	return wait
+}
+
+// retryScheduled 记录定时消息发布失败，返回距下次重试的时间；重试次数用尽时标记为失败并返回 0
+func (s *scheduler) retryScheduled(sm *store.ScheduledMessage, now time.Time, cause error) time.Duration {
+	b := s.broker
+	sm.Attempts++
+	sm.LastError = cause.Error()
+
+	var backoff time.Duration
+	if sm.Attempts >= scheduledMaxTries {
+		sm.Failed = true
+		sm.RetryAt = nil
+		logger.Error("定时消息发布失败，不再重试", "scheduled_id", sm.ID, "attempts", sm.Attempts, "error", cause)
+	} else {
+		backoff = scheduledBackoff(sm.Attempts)
+		retryAt := now.Add(backoff)
+		sm.RetryAt = &retryAt
+		logger.Warn("定时消息发布失败，稍后重试", "scheduled_id", sm.ID, "attempts", sm.Attempts, "retry_in", backoff, "error", cause)
+	}
+
+	// 期间被取消时不再写回
+	if err := b.storeManager.UpdateScheduled(b.config.AuthToken, sm); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return 0
+		}
+		logger.Error("定时消息状态保存失败", "scheduled_id", sm.ID, "error", err)
+	}
+	return backoff
+}
+
+// scheduledBackoff 第 attempts 次失败后距下次重试的时间
+func scheduledBackoff(attempts int) time.Duration {
+	return min(scheduledRetryBase<<(attempts-1), scheduledRetryMax)
+}
+
+// Schedule 保存定时消息，到 sendAt 时发布到 topic
+func (b *Broker) Schedule(topic string, msg Message, sendAt time.Time) (*store.ScheduledMessage, error) {
+	if b.scheduler == nil {
+		return nil, ErrSchedulerDisabled
+	}
+
+	sm := &store.ScheduledMessage{
+		Topic:     topic,
+		Title:     msg.Title,
+		Content:   msg.Content,
+		Extra:     msg.Extra,
+		Client:    msg.Client,
+		Priority:  string(msg.Priority),
+		GroupKey:  msg.GroupKey,
+		Tags:      msg.Tags,
+		Publisher: msg.Publisher,
+		SendAt:    sendAt,
+	}
+	if err := b.storeManager.SaveScheduled(b.config.AuthToken, sm); err != nil {
+		return nil, err
+	}
+	b.scheduler.notify()
+	return sm, nil
+}
+
+// ScheduledMessages 获取等待发送的定时消息，按发送时间排序
+func (b *Broker) ScheduledMessages() ([]store.ScheduledMessage, error) {
+	if b.scheduler == nil {
+		return []store.ScheduledMessage{}, nil
+	}
+	return b.storeManager.ListScheduled(b.config.AuthToken)
+}
+
+// CancelScheduled 取消定时消息，不存在（或已发送）时返回 store.ErrNotFound
+func (b *Broker) CancelScheduled(id uint64) error {
+	if b.scheduler == nil {
+		return store.ErrNotFound
+	}
+	if err := b.storeManager.DeleteScheduled(b.config.AuthToken, id); err != nil {
+		return err
+	}
+	b.scheduler.notify()
+	return nil
+}
+
+// startScheduler 启用存储时启动定时消息和周期消息调度
+func (b *Broker) startScheduler() {
+	if b.storeManager == nil || !b.storeManager.IsEnabled() {
+		if len(b.config.Recurring) > 0 {
+			logger.Warn("周期消息需要启用持久化存储，已忽略", "count", len(b.config.Recurring))
+		}
+		return
+	}
+	b.scheduler = newScheduler(b)
+	b.scheduler.loadRecurring(b.config.Recurring)
+	go b.scheduler.run()
+	logger.Info("定时消息调度已启用")
+}
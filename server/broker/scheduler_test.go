@@ -0,0 +1,129 @@
+package broker
+
+import (
+	"testing"
+	"time"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+
+	"notice-server/store"
+)
+
+// newTestScheduler 创建启用存储的 Broker 和未启动的调度器，由测试直接调用 publishDue
+func newTestScheduler(t *testing.T) (*scheduler, *publishRecorder) {
+	t.Helper()
+	b, rec := newTestBroker(t, Config{AuthToken: "test-token"})
+	b.storeManager = store.NewManager(t.TempDir(), true)
+	t.Cleanup(func() { b.storeManager.Close() })
+	b.scheduler = newScheduler(b)
+	return b.scheduler, rec
+}
+
+func TestSchedulerRetry(t *testing.T) {
+	s, rec := newTestScheduler(t)
+	b := s.broker
+	now := time.Now()
+
+	for _, title := range []string{"a", "b"} {
+		if _, err := b.Schedule("notice", Message{Title: title, Content: "内容"}, now.Add(-time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	later, err := b.Schedule("notice", Message{Title: "later", Content: "内容"}, now.Add(10*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 内置客户端不可用时每条消息都记录失败，而不是在第一条处停止
+	inline, _ := b.server.Clients.Get(mqtt.InlineClientId)
+	b.server.Clients.Delete(mqtt.InlineClientId)
+	if wait := s.publishDue(now); wait != 10*time.Second {
+		t.Errorf("publishDue() = %v, 应等待到下一条定时消息", wait)
+	}
+
+	list, _ := b.ScheduledMessages()
+	if len(list) != 3 {
+		t.Fatalf("发布失败的消息应保留，实际: %d", len(list))
+	}
+	for _, sm := range list {
+		if sm.ID == later.ID {
+			if sm.Attempts != 0 {
+				t.Errorf("未到期的消息不应尝试发布: %+v", sm)
+			}
+			continue
+		}
+		if sm.Attempts != 1 || sm.LastError == "" || sm.RetryAt == nil || !sm.RetryAt.Equal(now.Add(scheduledRetryBase)) {
+			t.Errorf("应记录失败并在 %v 后重试: %+v", scheduledRetryBase, sm)
+		}
+	}
+
+	// 恢复后到期的消息全部发送，重试中的消息按 RetryAt 发送
+	b.server.Clients.Add(inline)
+	if wait := s.publishDue(now.Add(15 * time.Second)); wait != 15*time.Second {
+		t.Errorf("publishDue() = %v, 应等待到重试时间", wait)
+	}
+	if rec.count() != 1 {
+		t.Fatalf("应发送 1 条，实际: %d", rec.count())
+	}
+	s.publishDue(now.Add(scheduledRetryBase))
+	if rec.count() != 3 {
+		t.Fatalf("应发送 3 条，实际: %d", rec.count())
+	}
+	if list, _ := b.ScheduledMessages(); len(list) != 0 {
+		t.Errorf("发送后应删除定时消息，剩余: %d", len(list))
+	}
+}
+
+func TestSchedulerFailed(t *testing.T) {
+	s, rec := newTestScheduler(t)
+	b := s.broker
+	now := time.Now()
+
+	sm, err := b.Schedule("notice", Message{Title: "a", Content: "内容"}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm.Attempts = scheduledMaxTries - 1
+	if err := b.storeManager.UpdateScheduled(b.config.AuthToken, sm); err != nil {
+		t.Fatal(err)
+	}
+
+	inline, _ := b.server.Clients.Get(mqtt.InlineClientId)
+	b.server.Clients.Delete(mqtt.InlineClientId)
+	s.publishDue(now)
+	b.server.Clients.Add(inline)
+
+	list, _ := b.ScheduledMessages()
+	if len(list) != 1 || !list[0].Failed || list[0].RetryAt != nil {
+		t.Fatalf("重试次数用尽后应标记为失败: %+v", list)
+	}
+
+	// 失败的消息不再发送，可以取消
+	if wait := s.publishDue(now.Add(time.Hour)); wait != schedulerMaxWait {
+		t.Errorf("publishDue() = %v, 失败的消息不应影响等待时间", wait)
+	}
+	if rec.count() != 0 {
+		t.Errorf("失败的消息不应发送，实际: %d", rec.count())
+	}
+	if err := b.CancelScheduled(sm.ID); err != nil {
+		t.Errorf("CancelScheduled() error = %v", err)
+	}
+}
+
+func TestScheduledBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{5, 8 * time.Minute},
+		{8, time.Hour},
+		{9, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := scheduledBackoff(tt.attempts); got != tt.want {
+			t.Errorf("第 %d 次失败后等待 %v，期望 %v", tt.attempts, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package broker
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+
+	"notice-server/logger"
+)
+
+// ErrClientNotFound 客户端或会话不存在
+var ErrClientNotFound = errors.New("客户端不存在")
+
+// SessionInfo 持久会话信息
+type SessionInfo struct {
+	ClientInfo
+	Pending        int        `json:"pending"`              // 待投递（离线队列 + 未确认）消息数
+	ExpiryInterval uint32     `json:"expiry_interval"`      // 会话过期时间（秒）
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"` // 离线会话的过期时间
+}
+
+// Sessions 获取所有持久会话（非 clean session），按 Client ID 排序
+func (b *Broker) Sessions() []SessionInfo {
+	list := []SessionInfo{}
+	for _, cl := range b.server.Clients.GetAll() {
+		if cl.Net.Inline || !isPersistent(cl) {
+			continue
+		}
+
+		info := SessionInfo{
+			ClientInfo:     b.clientInfo(cl),
+			Pending:        cl.State.Inflight.Len(),
+			ExpiryInterval: b.sessionExpiry(cl),
+		}
+		if stopped := cl.StopTime(); stopped > 0 {
+			info.ExpiresAt = timePtr(time.Unix(stopped+int64(info.ExpiryInterval), 0))
+		}
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ClientID < list[j].ClientID
+	})
+	return list
+}
+
+// Disconnect 断开在线客户端，保留其会话
+func (b *Broker) Disconnect(id string) error {
+	cl, ok := b.getClient(id)
+	if !ok || cl.Closed() {
+		return ErrClientNotFound
+	}
+
+	logger.Info("管理员断开客户端", "client_id", id)
+	b.disconnect(cl)
+	return nil
+}
+
+// expireWait 等待在线客户端断开流程完成的最长时间
+const expireWait = 5 * time.Second
+
+// ExpireSession 立即过期会话：断开连接并清除订阅、离线消息和持久化记录
+func (b *Broker) ExpireSession(id string) error {
+	cl, ok := b.getClient(id)
+	if !ok {
+		return ErrClientNotFound
+	}
+
+	logger.Info("管理员过期会话", "client_id", id, "pending", cl.State.Inflight.Len())
+
+	if !cl.Closed() {
+		// 客户端属性由其连接协程读取，不能在这里修改；断开后由 expireHook 在断开流程中清理
+		req := &expireRequest{cl: cl, done: make(chan struct{})}
+		b.expirer.pending.Store(id, req)
+		b.disconnect(cl)
+
+		select {
+		case <-req.done:
+			return nil
+		case <-time.After(expireWait):
+		}
+		// 断开流程未经过 expireHook（如客户端恰好在请求前自行断开），由这里清理
+		if !b.expirer.pending.CompareAndDelete(id, req) {
+			<-req.done
+			return nil
+		}
+	}
+
+	b.expireOffline(cl)
+	return nil
+}
+
+// expireOffline 清除已断开客户端的会话
+func (b *Broker) expireOffline(cl *mqtt.Client) {
+	if b.delivery != nil {
+		b.delivery.OnClientExpired(cl)
+	}
+	cl.ClearInflights()
+	b.server.UnsubscribeClient(cl)
+	if b.storageHook != nil {
+		b.storageHook.OnClientExpired(cl)
+	}
+	if b.presence != nil {
+		b.presence.OnClientExpired(cl)
+	}
+	b.server.Clients.Delete(cl.ID)
+}
+
+// expireRequest 管理员对在线客户端的会话过期请求
+type expireRequest struct {
+	cl   *mqtt.Client
+	done chan struct{} // 会话清理完成后关闭
+}
+
+// expireHook 在客户端的断开流程中完成管理员请求的会话过期
+// 须在其他钩子之后添加，使其他钩子先按持久会话处理断开，再统一清理
+type expireHook struct {
+	mqtt.HookBase
+	broker  *Broker
+	pending sync.Map // client_id -> *expireRequest
+}
+
+func (h *expireHook) ID() string {
+	return "session-expire"
+}
+
+func (h *expireHook) Provides(b byte) bool {
+	return b == mqtt.OnDisconnect
+}
+
+// OnDisconnect 清除被请求过期的会话，非持久会话已由 mochi 清理
+func (h *expireHook) OnDisconnect(cl *mqtt.Client, err error, expire bool) {
+	v, ok := h.pending.Load(cl.ID)
+	if !ok {
+		return
+	}
+	req := v.(*expireRequest)
+	if req.cl != cl || !h.pending.CompareAndDelete(cl.ID, req) {
+		return
+	}
+	if !expire && !cl.IsTakenOver() {
+		h.broker.expireOffline(cl)
+	}
+	close(req.done)
+}
+
+// PurgeQueue 清空会话的待投递消息，返回清除的数量
+func (b *Broker) PurgeQueue(id string) (int, error) {
+	cl, ok := b.getClient(id)
+	if !ok {
+		return 0, ErrClientNotFound
+	}
+
+	n := cl.State.Inflight.Len()
+	cl.ClearInflights()
+	logger.Info("管理员清空离线消息", "client_id", id, "purged", n)
+	return n, nil
+}
+
+// getClient 按 Client ID 获取客户端（排除内置客户端）
+func (b *Broker) getClient(id string) (*mqtt.Client, bool) {
+	cl, ok := b.server.Clients.Get(id)
+	if !ok || cl.Net.Inline {
+		return nil, false
+	}
+	return cl, true
+}
+
+// disconnect 以管理操作原因断开客户端
+func (b *Broker) disconnect(cl *mqtt.Client) {
+	// 原因码 >= 0x80 时 DisconnectClient 会将其作为 error 返回，这里无需处理
+	_ = b.server.DisconnectClient(cl, packets.ErrAdministrativeAction)
+}
+
+// sessionExpiry 计算会话过期时间，与 mochi 清理过期会话的逻辑一致
+func (b *Broker) sessionExpiry(cl *mqtt.Client) uint32 {
+	expiry := b.config.SessionExpiry
+	if cl.Properties.ProtocolVersion == 5 && cl.Properties.Props.SessionExpiryIntervalFlag {
+		expiry = cl.Properties.Props.SessionExpiryInterval
+	}
+	return expiry
+}
+
+// isPersistent 客户端是否为持久会话（断开后保留订阅和离线消息）
+func isPersistent(cl *mqtt.Client) bool {
+	if cl.Properties.ProtocolVersion == 5 {
+		return cl.Properties.Props.SessionExpiryInterval > 0
+	}
+	return !cl.Properties.Clean
+}
@@ -0,0 +1,92 @@
+package broker
+
+import (
+	"slices"
+	"strings"
+	"sync"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+// sharedPrefix 共享订阅过滤器前缀：$share/<group>/<filter>
+const sharedPrefix = "$share/"
+
+// SharedSubHook 共享订阅的成员选择
+// 同一组（$share/<group>/<filter>）的每条消息只投递给一个成员，按轮询在在线成员间分摊；
+// 全部离线时仍选出一个成员，消息进入其离线队列，重连后送达
+type SharedSubHook struct {
+	mqtt.HookBase
+	server *mqtt.Server
+	next   map[string]int // 共享过滤器 -> 下次轮询位置
+	mu     sync.Mutex
+}
+
+func newSharedSubHook(server *mqtt.Server) *SharedSubHook {
+	return &SharedSubHook{
+		server: server,
+		next:   make(map[string]int),
+	}
+}
+
+func (h *SharedSubHook) ID() string {
+	return "shared-sub"
+}
+
+func (h *SharedSubHook) Provides(b byte) bool {
+	return b == mqtt.OnSelectSubscribers
+}
+
+// OnSelectSubscribers 为每个共享订阅组选出一个成员
+func (h *SharedSubHook) OnSelectSubscribers(subs *mqtt.Subscribers, pk packets.Packet) *mqtt.Subscribers {
+	if len(subs.Shared) == 0 {
+		return subs
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	subs.SharedSelected = make(map[string]packets.Subscription, len(subs.Shared))
+	for filter, members := range subs.Shared {
+		ids := make([]string, 0, len(members))
+		for id := range members {
+			ids = append(ids, id)
+		}
+		slices.Sort(ids)
+
+		chosen := h.pick(filter, ids)
+		sub := members[chosen]
+		if prev, ok := subs.SharedSelected[chosen]; ok {
+			sub = prev.Merge(sub)
+		}
+		subs.SharedSelected[chosen] = sub
+	}
+	return subs
+}
+
+// pick 从 next 位置开始轮询，优先选择在线成员，调用方需持有锁
+func (h *SharedSubHook) pick(filter string, ids []string) string {
+	start := h.next[filter] % len(ids)
+	for i := range ids {
+		j := (start + i) % len(ids)
+		if cl, ok := h.server.Clients.Get(ids[j]); ok && !cl.Closed() {
+			h.next[filter] = j + 1
+			return ids[j]
+		}
+	}
+	h.next[filter] = start + 1
+	return ids[start]
+}
+
+// sharedFilter 拆分共享订阅过滤器，返回组名和实际过滤器；非共享订阅时 group 为空
+func sharedFilter(filter string) (group, topic string) {
+	rest, ok := strings.CutPrefix(filter, sharedPrefix)
+	if !ok {
+		return "", filter
+	}
+	group, topic, ok = strings.Cut(rest, "/")
+	if !ok {
+		return "", filter
+	}
+	return group, topic
+}
@@ -0,0 +1,107 @@
+package broker
+
+import (
+	"encoding/json"
+	"strconv"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/system"
+
+	"notice-server/logger"
+)
+
+const (
+	// sysTopicPrefix Notice 统计主题前缀
+	sysTopicPrefix = "$SYS/notice"
+)
+
+// Stats Broker 统计快照，发布到 $SYS/notice/stats
+type Stats struct {
+	Clients          int64          `json:"clients"`           // 当前连接的客户端数
+	ClientsTotal     int64          `json:"clients_total"`     // 已知客户端数（含离线持久会话）
+	Inflight         int64          `json:"inflight"`          // 飞行中（含离线待发送）消息数
+	MessagesReceived int64          `json:"messages_received"` // 累计收到的消息数
+	MessagesSent     int64          `json:"messages_sent"`     // 累计发出的消息数
+	MessagesDropped  int64          `json:"messages_dropped"`  // 累计丢弃的消息数
+	BytesReceived    int64          `json:"bytes_received"`    // 累计接收字节数
+	BytesSent        int64          `json:"bytes_sent"`        // 累计发送字节数
+	Subscriptions    int64          `json:"subscriptions"`     // 当前订阅数
+	Uptime           int64          `json:"uptime"`            // 运行时间（秒）
+	Store            map[string]int `json:"store,omitempty"`   // 各租户（token hash）存储的消息数
+	Bridges          []BridgeStatus `json:"bridges,omitempty"` // 上游桥接状态
+}
+
+// SysHook 定期发布 Broker 统计到 $SYS/notice/...
+// 发布周期由 mochi 的 SysTopicResendInterval 驱动
+type SysHook struct {
+	mqtt.HookBase
+	broker *Broker
+}
+
+func (h *SysHook) ID() string {
+	return "sys-stats"
+}
+
+func (h *SysHook) Provides(b byte) bool {
+	return b == mqtt.OnSysInfoTick
+}
+
+// OnSysInfoTick 发布统计主题
+func (h *SysHook) OnSysInfoTick(info *system.Info) {
+	stats := h.broker.stats(info)
+
+	topics := map[string]string{
+		sysTopicPrefix + "/clients/connected": strconv.FormatInt(stats.Clients, 10),
+		sysTopicPrefix + "/clients/total":     strconv.FormatInt(stats.ClientsTotal, 10),
+		sysTopicPrefix + "/messages/inflight": strconv.FormatInt(stats.Inflight, 10),
+		sysTopicPrefix + "/messages/received": strconv.FormatInt(stats.MessagesReceived, 10),
+		sysTopicPrefix + "/messages/sent":     strconv.FormatInt(stats.MessagesSent, 10),
+		sysTopicPrefix + "/messages/dropped":  strconv.FormatInt(stats.MessagesDropped, 10),
+		sysTopicPrefix + "/bytes/received":    strconv.FormatInt(stats.BytesReceived, 10),
+		sysTopicPrefix + "/bytes/sent":        strconv.FormatInt(stats.BytesSent, 10),
+		sysTopicPrefix + "/subscriptions":     strconv.FormatInt(stats.Subscriptions, 10),
+		sysTopicPrefix + "/uptime":            strconv.FormatInt(stats.Uptime, 10),
+	}
+	for tenant, count := range stats.Store {
+		topics[sysTopicPrefix+"/store/"+tenant+"/messages"] = strconv.Itoa(count)
+	}
+	for _, br := range stats.Bridges {
+		topics[sysTopicPrefix+"/bridges/"+br.Name+"/connected"] = strconv.FormatBool(br.Connected)
+	}
+
+	for topic, payload := range topics {
+		if err := h.broker.server.Publish(topic, []byte(payload), false, 0); err != nil {
+			logger.Debug("$SYS 统计发布失败", "topic", topic, "error", err)
+		}
+	}
+
+	// 汇总快照，便于客户端一次订阅获取全部指标
+	if payload, err := json.Marshal(stats); err == nil {
+		if err := h.broker.server.Publish(sysTopicPrefix+"/stats", payload, false, 0); err != nil {
+			logger.Debug("$SYS 统计发布失败", "topic", sysTopicPrefix+"/stats", "error", err)
+		}
+	}
+}
+
+// stats 根据 mochi 系统信息生成统计快照
+func (b *Broker) stats(info *system.Info) Stats {
+	stats := Stats{
+		Clients:          int64(b.ClientCount()),
+		ClientsTotal:     info.ClientsTotal,
+		Inflight:         info.Inflight,
+		MessagesReceived: info.MessagesReceived,
+		MessagesSent:     info.MessagesSent,
+		MessagesDropped:  info.MessagesDropped,
+		BytesReceived:    info.BytesReceived,
+		BytesSent:        info.BytesSent,
+		Subscriptions:    info.Subscriptions,
+		Uptime:           info.Uptime,
+	}
+	if b.storeManager != nil && b.storeManager.IsEnabled() {
+		stats.Store = b.storeManager.Stats()
+	}
+	if len(b.bridges) > 0 {
+		stats.Bridges = b.Bridges()
+	}
+	return stats
+}
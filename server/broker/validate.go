@@ -0,0 +1,194 @@
+package broker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+
+	"notice-server/logger"
+)
+
+// ValidateHook 校验客户端直接发布的消息
+// 与 Webhook 使用相同的标题和内容长度限制，另支持负载字节上限和严格 JSON 模式
+type ValidateHook struct {
+	mqtt.HookBase
+	maxTitleLength   int
+	maxContentLength int
+	maxPayloadBytes  int
+	strictJSON       bool
+	truncate         bool
+}
+
+// newValidateHook 根据 Broker 配置创建校验钩子
+func newValidateHook(cfg Config) *ValidateHook {
+	return &ValidateHook{
+		maxTitleLength:   cfg.MaxTitleLength,
+		maxContentLength: cfg.MaxContentLength,
+		maxPayloadBytes:  cfg.MaxPayloadBytes,
+		strictJSON:       cfg.StrictJSON,
+		truncate:         cfg.Truncate,
+	}
+}
+
+func (h *ValidateHook) ID() string {
+	return "validate"
+}
+
+func (h *ValidateHook) Provides(b byte) bool {
+	return b == mqtt.OnPublish
+}
+
+// OnPublish 校验失败的消息不投递也不存储
+func (h *ValidateHook) OnPublish(cl *mqtt.Client, pk packets.Packet) (packets.Packet, error) {
+	// 内置客户端的消息已在 Webhook 入口校验；$ 主题为系统消息
+	if cl.Net.Inline || (len(pk.TopicName) > 0 && pk.TopicName[0] == '$') {
+		return pk, nil
+	}
+
+	npk, err := h.validate(pk)
+	if err == nil {
+		return npk, nil
+	}
+
+	var code packets.Code
+	errors.As(err, &code)
+	logger.Warn("MQTT 消息校验失败", "client_id", cl.ID, "topic", pk.TopicName, "code", code.Code, "reason", code.Reason)
+	return pk, rejectPublish(cl, pk, code)
+}
+
+// validate 校验消息，截断模式下返回修正后的消息
+func (h *ValidateHook) validate(pk packets.Packet) (packets.Packet, error) {
+	if h.maxPayloadBytes > 0 && len(pk.Payload) > h.maxPayloadBytes {
+		return pk, reasonCode(packets.ErrImplementationSpecificError, fmt.Sprintf("负载不能超过 %d 字节", h.maxPayloadBytes))
+	}
+	// 声明为 UTF-8 的负载必须是合法 UTF-8 [MQTT-3.3.2-4]
+	if pk.Properties.PayloadFormatFlag && pk.Properties.PayloadFormat == 1 && !utf8.Valid(pk.Payload) {
+		return pk, packets.ErrPayloadFormatInvalid
+	}
+	if h.strictJSON {
+		if err := strictMessage(pk); err != nil {
+			return pk, reasonCode(packets.ErrPayloadFormatInvalid, err.Error())
+		}
+	}
+
+	title, content, fields := messageFields(pk)
+	titleOver := h.maxTitleLength > 0 && utf8.RuneCountInString(title) > h.maxTitleLength
+	contentOver := h.maxContentLength > 0 && utf8.RuneCountInString(content) > h.maxContentLength
+	if !titleOver && !contentOver {
+		return pk, nil
+	}
+
+	if !h.truncate {
+		if titleOver {
+			return pk, reasonCode(packets.ErrImplementationSpecificError, fmt.Sprintf("title 长度不能超过 %d 字符", h.maxTitleLength))
+		}
+		return pk, reasonCode(packets.ErrImplementationSpecificError, fmt.Sprintf("content 长度不能超过 %d 字符", h.maxContentLength))
+	}
+
+	// 截断模式：JSON 消息改写对应字段，原始负载截断负载本身，标题取自用户属性
+	if titleOver {
+		title = truncateRunes(title, h.maxTitleLength)
+		if fields != nil {
+			fields["title"] = title
+		} else {
+			setUserProperty(&pk.Properties, PropTitle, title)
+		}
+	}
+	if contentOver {
+		content = truncateRunes(content, h.maxContentLength)
+		if fields != nil {
+			fields["content"] = content
+		} else {
+			pk.Payload = []byte(content)
+		}
+	}
+	if fields != nil {
+		payload, err := json.Marshal(fields)
+		if err != nil {
+			return pk, reasonCode(packets.ErrPayloadFormatInvalid, err.Error())
+		}
+		pk.Payload = payload
+	}
+	return pk, nil
+}
+
+// publishedMessage 客户端可直接发布的通知字段
+// id、key、updated、recalled 等由服务端设置，客户端据此更新或撤回消息，不能由发布者伪造
+type publishedMessage struct {
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	Extra     any       `json:"extra,omitempty"`
+	Priority  Priority  `json:"priority,omitempty"`
+	Client    string    `json:"client,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// strictMessage 严格模式：负载必须是只包含通知字段的 JSON 对象，且 content 非空
+func strictMessage(pk packets.Packet) error {
+	if !isJSONContent(pk.Properties) {
+		return errors.New("仅接受 JSON 消息")
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(pk.Payload))
+	dec.DisallowUnknownFields()
+	var msg publishedMessage
+	if err := dec.Decode(&msg); err != nil {
+		return fmt.Errorf("JSON 格式无效: %w", err)
+	}
+	if dec.More() {
+		return errors.New("JSON 格式无效: 存在多余内容")
+	}
+	if msg.Content == "" {
+		return errors.New("content 不能为空")
+	}
+	return nil
+}
+
+// messageFields 按 parsePayload 的规则提取标题和内容
+// 负载为通知格式的 JSON 时同时返回解析后的字段，便于改写后重新编码
+func messageFields(pk packets.Packet) (title, content string, fields map[string]any) {
+	if isJSONContent(pk.Properties) {
+		dec := json.NewDecoder(bytes.NewReader(pk.Payload))
+		dec.UseNumber() // 保留 extra 中数字的原始精度
+		if err := dec.Decode(&fields); err == nil && fields != nil {
+			title, _ = fields["title"].(string)
+			content, _ = fields["content"].(string)
+			if title != "" || content != "" {
+				return title, content, fields
+			}
+		}
+	}
+	return userProperty(pk.Properties, PropTitle), string(pk.Payload), nil
+}
+
+// truncateRunes 按字符截断字符串
+func truncateRunes(s string, n int) string {
+	i := 0
+	for pos := range s {
+		if i == n {
+			return s[:pos]
+		}
+		i++
+	}
+	return s
+}
+
+// reasonCode 携带自定义原因说明的原因码，MQTT 5 客户端可在确认包的 Reason String 中看到
+func reasonCode(code packets.Code, reason string) packets.Code {
+	return packets.Code{Code: code.Code, Reason: reason}
+}
+
+// rejectPublish 拒绝客户端发布的消息
+// MQTT 5 的 QoS 1/2 消息以原因码确认；其余情况照常确认后丢弃，避免 3.1.1 客户端反复重发
+func rejectPublish(cl *mqtt.Client, pk packets.Packet, code packets.Code) error {
+	if cl.Properties.ProtocolVersion == 5 && pk.FixedHeader.Qos > 0 {
+		return code
+	}
+	return packets.CodeSuccessIgnore
+}
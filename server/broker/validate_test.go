@@ -0,0 +1,134 @@
+package broker
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+func TestStrictMessage(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		ct      string
+		wantErr bool
+	}{
+		{"title and content", `{"title":"t","content":"c"}`, "", false},
+		{"all fields", `{"title":"t","content":"c","extra":{"a":1},"priority":"high","client":"cli","timestamp":"2026-01-01T00:00:00Z"}`, "", false},
+		{"content type json", `{"content":"c"}`, "application/json; charset=utf-8", false},
+		{"empty content", `{"title":"t"}`, "", true},
+		{"unknown field", `{"content":"c","foo":1}`, "", true},
+		{"forged id", `{"content":"c","id":42}`, "", true},
+		{"forged key", `{"content":"c","key":"backup"}`, "", true},
+		{"forged updated", `{"content":"c","id":42,"updated":true}`, "", true},
+		{"forged recalled", `{"content":"c","id":42,"recalled":true}`, "", true},
+		{"forged replayed", `{"content":"c","replayed":true}`, "", true},
+		{"invalid priority", `{"content":"c","priority":"loud"}`, "", true},
+		{"trailing data", `{"content":"c"}{}`, "", true},
+		{"not json", `hello`, "", true},
+		{"plain content type", `{"content":"c"}`, "text/plain", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pk := packets.Packet{Payload: []byte(tt.payload)}
+			pk.Properties.ContentType = tt.ct
+			err := strictMessage(pk)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("strictMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateHookValidate(t *testing.T) {
+	long := strings.Repeat("长", 11)
+
+	tests := []struct {
+		name     string
+		hook     ValidateHook
+		payload  string
+		title    string // 用户属性 title
+		wantCode byte   // 0 表示通过
+		want     string // 通过时期望的负载，为空表示不变
+	}{
+		{"within limits", ValidateHook{maxTitleLength: 10, maxContentLength: 10}, `{"title":"t","content":"c"}`, "", 0, ""},
+		{"payload too large", ValidateHook{maxPayloadBytes: 8}, `{"content":"0123456789"}`, "", packets.ErrImplementationSpecificError.Code, ""},
+		{"json title too long", ValidateHook{maxTitleLength: 10}, `{"title":"` + long + `","content":"c"}`, "", packets.ErrImplementationSpecificError.Code, ""},
+		{"json content too long", ValidateHook{maxContentLength: 10}, `{"content":"` + long + `"}`, "", packets.ErrImplementationSpecificError.Code, ""},
+		{"raw content too long", ValidateHook{maxContentLength: 10}, long, "", packets.ErrImplementationSpecificError.Code, ""},
+		{"property title too long", ValidateHook{maxTitleLength: 10}, "raw", long, packets.ErrImplementationSpecificError.Code, ""},
+		{"truncate json", ValidateHook{maxContentLength: 10, truncate: true}, `{"content":"` + long + `","n":1}`, "", 0, `{"content":"` + strings.Repeat("长", 10) + `","n":1}`},
+		{"truncate raw", ValidateHook{maxContentLength: 10, truncate: true}, long, "", 0, strings.Repeat("长", 10)},
+		{"strict rejects forged event", ValidateHook{strictJSON: true}, `{"content":"c","id":1,"recalled":true}`, "", packets.ErrPayloadFormatInvalid.Code, ""},
+		{"strict accepts message", ValidateHook{strictJSON: true}, `{"content":"c"}`, "", 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pk := packets.Packet{Payload: []byte(tt.payload)}
+			if tt.title != "" {
+				pk.Properties.User = []packets.UserProperty{{Key: PropTitle, Val: tt.title}}
+			}
+
+			npk, err := tt.hook.validate(pk)
+			if tt.wantCode != 0 {
+				var code packets.Code
+				if !errors.As(err, &code) || code.Code != tt.wantCode {
+					t.Fatalf("validate() error = %v, want code 0x%x", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("validate() error = %v", err)
+			}
+			want := tt.want
+			if want == "" {
+				want = tt.payload
+			}
+			if string(npk.Payload) != want {
+				t.Errorf("payload = %s, want %s", npk.Payload, want)
+			}
+		})
+	}
+}
+
+func TestValidateHookInvalidUTF8(t *testing.T) {
+	pk := packets.Packet{Payload: []byte{0xff, 0xfe}}
+	pk.Properties.PayloadFormatFlag = true
+	pk.Properties.PayloadFormat = 1
+	h := ValidateHook{}
+	if _, err := h.validate(pk); !errors.Is(err, packets.ErrPayloadFormatInvalid) {
+		t.Errorf("validate() error = %v, want ErrPayloadFormatInvalid", err)
+	}
+}
+
+func TestRejectPublish(t *testing.T) {
+	code := reasonCode(packets.ErrPayloadFormatInvalid, "bad")
+	tests := []struct {
+		name    string
+		version byte
+		qos     byte
+		want    byte
+	}{
+		{"v5 qos1", 5, 1, packets.ErrPayloadFormatInvalid.Code},
+		{"v5 qos0", 5, 0, packets.CodeSuccessIgnore.Code},
+		{"v3 qos1", 4, 1, packets.CodeSuccessIgnore.Code},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cl := new(mqtt.Client)
+			cl.Properties.ProtocolVersion = tt.version
+			pk := packets.Packet{}
+			pk.FixedHeader.Qos = tt.qos
+			var got packets.Code
+			errors.As(rejectPublish(cl, pk, code), &got)
+			if got.Code != tt.want {
+				t.Errorf("rejectPublish() = 0x%x, want 0x%x", got.Code, tt.want)
+			}
+		})
+	}
+}
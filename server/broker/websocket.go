@@ -0,0 +1,165 @@
+package broker
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/mochi-mqtt/server/v2/listeners"
+
+	"notice-server/logger"
+	"notice-server/ratelimit"
+)
+
+// websocketListener 挂载在 HTTP 服务上的 MQTT over WebSocket 监听器
+// 与独立端口的 WebSocket 监听器行为一致，但不自行监听端口，由 HTTP 服务转交连接
+type websocketListener struct {
+	id        string
+	path      string
+	upgrader  websocket.Upgrader
+	establish listeners.EstablishFn
+	done      chan struct{}
+	closeOnce sync.Once
+	mu        sync.RWMutex
+}
+
+func newWebsocketListener(id, path string) *websocketListener {
+	return &websocketListener{
+		id:   id,
+		path: path,
+		upgrader: websocket.Upgrader{
+			Subprotocols: []string{"mqtt"},
+			CheckOrigin: func(r *http.Request) bool {
+				return true
+			},
+		},
+		done: make(chan struct{}),
+	}
+}
+
+func (l *websocketListener) ID() string {
+	return l.id
+}
+
+func (l *websocketListener) Address() string {
+	return l.path
+}
+
+func (l *websocketListener) Protocol() string {
+	return "ws"
+}
+
+func (l *websocketListener) Init(*slog.Logger) error {
+	return nil
+}
+
+// Serve 记录连接建立回调，阻塞直到监听器关闭
+func (l *websocketListener) Serve(establish listeners.EstablishFn) {
+	l.mu.Lock()
+	l.establish = establish
+	l.mu.Unlock()
+	<-l.done
+}
+
+// Close 停止接受新连接并关闭已有客户端
+func (l *websocketListener) Close(closeClients listeners.CloseFn) {
+	l.closeOnce.Do(func() {
+		l.mu.Lock()
+		l.establish = nil
+		l.mu.Unlock()
+		close(l.done)
+	})
+	closeClients(l.id)
+}
+
+// ServeHTTP 升级为 WebSocket 连接并交给 MQTT 服务处理，直到连接断开
+func (l *websocketListener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.mu.RLock()
+	establish := l.establish
+	l.mu.RUnlock()
+	if establish == nil {
+		http.Error(w, "MQTT 服务不可用", http.StatusServiceUnavailable)
+		return
+	}
+
+	c, err := l.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade 已写入错误响应
+		return
+	}
+	defer c.Close()
+
+	conn := &wsConn{Conn: c.UnderlyingConn(), c: c, remote: clientAddr(r)}
+	if err := establish(l.id, conn); err != nil {
+		logger.Debug("MQTT WebSocket 连接结束", "remote", r.RemoteAddr, "error", err)
+	}
+}
+
+// wsConn 将 WebSocket 连接适配为 net.Conn，MQTT 数据包以二进制帧传输
+type wsConn struct {
+	net.Conn
+	c *websocket.Conn
+	r io.Reader // 当前正在读取的帧
+	// 经可信反向代理转发时的客户端地址，为 nil 时使用连接的远端地址
+	remote net.Addr
+}
+
+// clientAddr 经可信反向代理转发的连接以代理请求头中的客户端 IP 作为远端地址，
+// 使认证失败限流和发布限流按真实客户端统计
+func clientAddr(r *http.Request) net.Addr {
+	ip := ratelimit.GetClientIP(r)
+	if ip == ratelimit.RemoteIP(r.RemoteAddr) {
+		return nil
+	}
+	return &net.TCPAddr{IP: net.ParseIP(ip)}
+}
+
+func (ws *wsConn) RemoteAddr() net.Addr {
+	if ws.remote != nil {
+		return ws.remote
+	}
+	return ws.Conn.RemoteAddr()
+}
+
+func (ws *wsConn) Read(p []byte) (int, error) {
+	if ws.r == nil {
+		op, r, err := ws.c.NextReader()
+		if err != nil {
+			return 0, err
+		}
+		if op != websocket.BinaryMessage {
+			return 0, listeners.ErrInvalidMessage
+		}
+		ws.r = r
+	}
+
+	var n int
+	for n < len(p) {
+		br, err := ws.r.Read(p[n:])
+		n += br
+		if err != nil {
+			// 任何错误都视为当前帧结束
+			ws.r = nil
+			if errors.Is(err, io.EOF) {
+				err = nil
+			}
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (ws *wsConn) Write(p []byte) (int, error) {
+	if err := ws.c.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (ws *wsConn) Close() error {
+	return ws.Conn.Close()
+}
@@ -2,11 +2,13 @@ package config
 
 import (
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/hex"
 	"fmt"
 	"os"
 	"reflect"
 	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -14,19 +16,114 @@ import (
 
 // Config 应用配置
 type Config struct {
-	HTTP      HTTPConfig      `yaml:"http"`
-	MQTT      MQTTConfig      `yaml:"mqtt"`
-	Auth      AuthConfig      `yaml:"auth"`
-	RateLimit RateLimitConfig `yaml:"rate_limit"`
-	Log       LogConfig       `yaml:"log"`
-	Storage   StorageConfig   `yaml:"storage"`
-	Message   MessageConfig   `yaml:"message"`
+	HTTP      HTTPConfig        `yaml:"http"`
+	MQTT      MQTTConfig        `yaml:"mqtt"`
+	Auth      AuthConfig        `yaml:"auth"`
+	RateLimit RateLimitConfig   `yaml:"rate_limit"`
+	Log       LogConfig         `yaml:"log"`
+	Storage   StorageConfig     `yaml:"storage"`
+	Message   MessageConfig     `yaml:"message"`
+	Recurring []RecurringConfig `yaml:"recurring"` // 周期消息，也可通过接口创建
+	Rules     []RuleConfig      `yaml:"rules"`     // 消息路由规则，作用于 Webhook 和 MQTT 直接发布（仅支持配置文件）
+	Inbound   InboundConfig     `yaml:"inbound"`   // 第三方平台 Webhook 接入（仅支持配置文件）
+}
+
+// InboundConfig 第三方平台 Webhook 接入配置
+type InboundConfig struct {
+	GitHub GitWebhookConfig `yaml:"github"` // POST /webhook/github
+	GitLab GitWebhookConfig `yaml:"gitlab"` // POST /webhook/gitlab
+	Gitea  GitWebhookConfig `yaml:"gitea"`  // POST /webhook/gitea
+
+	Alertmanager AlertmanagerConfig `yaml:"alertmanager"` // POST /webhook/alertmanager
+
+	Custom []CustomWebhookConfig `yaml:"custom"` // POST /webhook/custom/{name}
+}
+
+// CustomWebhookConfig 自定义 Webhook 端点，从任意请求体中提取消息字段
+// 表达式以 $ 开头时为 JSONPath（如 $.alerts[0].labels.name），否则为 Go 模板（如 {{.monitor.name}}）
+type CustomWebhookConfig struct {
+	Name     string            `yaml:"name"`     // 端点名称，路径为 /webhook/custom/<name>
+	Secret   string            `yaml:"secret"`   // 专用 Token，为空时使用 auth.token（及 auth.signing）
+	Signing  SigningConfig     `yaml:"signing"`  // 专用 Token 的请求签名，密钥默认为 secret
+	Client   string            `yaml:"client"`   // 发送端标识，默认为端点名称
+	Title    string            `yaml:"title"`    // 标题表达式
+	Content  string            `yaml:"content"`  // 内容表达式（必填），结果为空时拒绝请求
+	Topic    string            `yaml:"topic"`    // 主题表达式，结果为空时使用 mqtt.topic
+	Priority string            `yaml:"priority"` // 优先级表达式，结果无效时为默认优先级
+	Extra    map[string]string `yaml:"extra"`    // extra 字段 -> 表达式，JSONPath 保留原始类型
+}
+
+// AlertmanagerConfig Prometheus Alertmanager 接入配置
+type AlertmanagerConfig struct {
+	// 专用 Token，Alertmanager 通过 http_config.authorization 或 URL 的 ?token= 携带，
+	// 为空时使用 auth.token
+	Secret string `yaml:"secret"`
+	// 发布主题，Go 模板，可用 {{.GroupLabels.<name>}}、{{.Labels.<name>}}、{{.Receiver}} 等，
+	// 渲染为空时使用 mqtt.topic
+	Topic string `yaml:"topic"`
+	// 取优先级的标签名，默认 severity
+	SeverityLabel string `yaml:"severity_label"`
+	// 标签值 -> 优先级，未列出的值为默认优先级；为空时使用内置映射
+	// （critical: urgent，error / warning: high，info: low）
+	Severity map[string]string `yaml:"severity"`
+	// 告警恢复时除更新原消息外，另发布一条恢复通知
+	ResolvedNotice bool `yaml:"resolved_notice"`
+}
+
+// GitWebhookConfig 代码托管平台 Webhook 配置
+type GitWebhookConfig struct {
+	// 平台 Webhook 中填写的 secret，配置后校验签名（GitLab 为 X-Gitlab-Token），
+	// 为空时要求请求携带 Token（如 ?token=）
+	Secret string            `yaml:"secret"`
+	Topic  string            `yaml:"topic"`  // 默认发布主题，为空则使用 mqtt.topic
+	Topics map[string]string `yaml:"topics"` // 按事件指定主题：push / pull_request / pipeline / release / issue
+}
+
+// RuleConfig 消息路由规则，按顺序匹配，默认命中第一条后停止
+type RuleConfig struct {
+	Name     string          `yaml:"name"`     // 规则名称，用于日志和测试结果
+	Match    RuleMatchConfig `yaml:"match"`    // 匹配条件，全部满足才命中，为空时匹配所有消息
+	Topic    string          `yaml:"topic"`    // 改写主题，支持模板
+	Topics   []string        `yaml:"topics"`   // 分发到多个主题，支持模板，与 topic 二选一
+	Priority string          `yaml:"priority"` // 设置优先级
+	Tags     []string        `yaml:"tags"`     // 追加标签
+	Drop     bool            `yaml:"drop"`     // 丢弃消息
+	Continue bool            `yaml:"continue"` // 命中后继续匹配后续规则
+}
+
+// RuleMatchConfig 路由规则的匹配条件
+type RuleMatchConfig struct {
+	Topic      string            `yaml:"topic"`      // 主题正则
+	Title      string            `yaml:"title"`      // 标题正则
+	Content    string            `yaml:"content"`    // 内容正则
+	Client     []string          `yaml:"client"`     // 发送端标识，任一相同即满足
+	Extra      map[string]string `yaml:"extra"`      // extra 字段（点号分隔的路径）-> 正则
+	IP         []string          `yaml:"ip"`         // 来源 IP 或 CIDR
+	Credential []string          `yaml:"credential"` // 凭据名称
+}
+
+// RecurringConfig 周期消息配置
+type RecurringConfig struct {
+	Name     string `yaml:"name"`     // 名称，唯一
+	Cron     string `yaml:"cron"`     // cron 表达式（分 时 日 月 周），支持 @daily、@every 1h 等
+	Timezone string `yaml:"timezone"` // 时区，如 Asia/Shanghai，默认服务器本地时区
+	Topic    string `yaml:"topic"`    // 发布主题，默认 mqtt.topic
+	Title    string `yaml:"title"`    // 标题模板
+	Content  string `yaml:"content"`  // 内容模板
+	Priority string `yaml:"priority"` // 优先级：min / low / default / high / urgent
+	CatchUp  bool   `yaml:"catch_up"` // 服务停机期间错过的执行是否在启动后补发一次
 }
 
 // MessageConfig 消息配置
 type MessageConfig struct {
-	MaxTitleLength   int `yaml:"max_title_length" env:"MESSAGE_MAX_TITLE_LENGTH"`     // 标题最大长度
-	MaxContentLength int `yaml:"max_content_length" env:"MESSAGE_MAX_CONTENT_LENGTH"` // 内容最大长度
+	MaxTitleLength   int  `yaml:"max_title_length" env:"MESSAGE_MAX_TITLE_LENGTH"`     // 标题最大长度
+	MaxContentLength int  `yaml:"max_content_length" env:"MESSAGE_MAX_CONTENT_LENGTH"` // 内容最大长度
+	MaxPayloadBytes  int  `yaml:"max_payload_bytes" env:"MESSAGE_MAX_PAYLOAD_BYTES"`   // 消息负载（Webhook 请求体）最大字节数
+	StrictJSON       bool `yaml:"strict_json" env:"MESSAGE_STRICT_JSON"`               // MQTT 直接发布只接受通知格式的 JSON
+	Truncate         bool `yaml:"truncate" env:"MESSAGE_TRUNCATE"`                     // MQTT 直接发布超长时截断而非拒绝
+	PriorityTopics   bool `yaml:"priority_topics" env:"MESSAGE_PRIORITY_TOPICS"`       // 非默认优先级的消息发布到 <topic>/<priority>
+	DedupWindow      int  `yaml:"dedup_window" env:"MESSAGE_DEDUP_WINDOW"`             // Webhook 重复消息合并窗口（秒），0 表示不合并
+	DedupSummary     bool `yaml:"dedup_summary" env:"MESSAGE_DEDUP_SUMMARY"`           // 窗口结束时发布重复次数汇总
 }
 
 // StorageConfig 持久化存储配置
@@ -38,21 +135,71 @@ type StorageConfig struct {
 // HTTPConfig HTTP 服务配置
 type HTTPConfig struct {
 	Port string `yaml:"port" env:"HTTP_PORT"`
+	// 可信反向代理（IP 或 CIDR），只读取来自这些地址的 X-Forwarded-For / X-Real-IP
+	TrustedProxies []string `yaml:"trusted_proxies" env:"HTTP_TRUSTED_PROXIES"`
 }
 
 // MQTTConfig MQTT Broker 配置
 type MQTTConfig struct {
-	TCPPort       string `yaml:"tcp_port" env:"MQTT_TCP_PORT"`
-	WSPort        string `yaml:"ws_port" env:"MQTT_WS_PORT"`
-	Topic         string `yaml:"topic" env:"MQTT_TOPIC"`
-	SessionExpiry uint32 `yaml:"session_expiry" env:"MQTT_SESSION_EXPIRY"`
-	MessageExpiry uint32 `yaml:"message_expiry" env:"MQTT_MESSAGE_EXPIRY"`
+	TCPPort       string         `yaml:"tcp_port" env:"MQTT_TCP_PORT"`
+	WSPort        string         `yaml:"ws_port" env:"MQTT_WS_PORT"` // 独立 WebSocket 端口，为空或 0 表示不监听
+	WSPath        string         `yaml:"ws_path" env:"MQTT_WS_PATH"` // HTTP 端口上的 WebSocket 路径，为空表示不挂载
+	Topic         string         `yaml:"topic" env:"MQTT_TOPIC"`
+	SessionExpiry uint32         `yaml:"session_expiry" env:"MQTT_SESSION_EXPIRY"`
+	MessageExpiry uint32         `yaml:"message_expiry" env:"MQTT_MESSAGE_EXPIRY"`
+	SysInterval   int64          `yaml:"sys_interval" env:"MQTT_SYS_INTERVAL"`     // $SYS 统计发布间隔（秒），0 表示关闭
+	PresenceTopic string         `yaml:"presence_topic" env:"MQTT_PRESENCE_TOPIC"` // 在线事件主题前缀，为空则不发布
+	Bridges       []BridgeConfig `yaml:"bridges"`                                  // 上游 MQTT broker 桥接（仅支持配置文件）
+}
+
+// BridgeConfig 上游 MQTT broker 桥接配置
+type BridgeConfig struct {
+	Name            string              `yaml:"name"`             // 桥接名称，用于日志和防环标记
+	Address         string              `yaml:"address"`          // 上游地址 host:port
+	TLS             bool                `yaml:"tls"`              // 是否使用 TLS 连接
+	ClientID        string              `yaml:"client_id"`        // 连接上游使用的 Client ID
+	Username        string              `yaml:"username"`         // 上游用户名
+	Password        string              `yaml:"password"`         // 上游密码
+	ProtocolVersion byte                `yaml:"protocol_version"` // MQTT 协议版本：4 (3.1.1) 或 5
+	Keepalive       uint16              `yaml:"keepalive"`        // 心跳间隔（秒）
+	CleanSession    bool                `yaml:"clean_session"`    // 是否使用 clean session
+	RetryMin        int                 `yaml:"retry_min"`        // 重连最小间隔（秒）
+	RetryMax        int                 `yaml:"retry_max"`        // 重连最大间隔（秒）
+	Topics          []BridgeTopicConfig `yaml:"topics"`           // 主题映射
+}
+
+// BridgeTopicConfig 桥接主题映射
+type BridgeTopicConfig struct {
+	Filter       string `yaml:"filter"`        // 主题过滤器（相对于前缀）
+	Direction    string `yaml:"direction"`     // 方向：in / out / both
+	Qos          byte   `yaml:"qos"`           // QoS 级别
+	LocalPrefix  string `yaml:"local_prefix"`  // 本地主题前缀
+	RemotePrefix string `yaml:"remote_prefix"` // 上游主题前缀
 }
 
 // AuthConfig 认证配置
 type AuthConfig struct {
-	Token     string `yaml:"token" env:"AUTH_TOKEN"`
-	Generated bool   `yaml:"-"` // Token 是否自动生成（内部字段）
+	Token      string `yaml:"token" env:"AUTH_TOKEN"`
+	AdminToken string `yaml:"admin_token" env:"AUTH_ADMIN_TOKEN"` // 管理员令牌，为空则 Token 即管理员
+	Generated  bool   `yaml:"-"`                                  // Token 是否自动生成（内部字段）
+
+	Signing SigningConfig `yaml:"signing"` // Webhook 请求签名，密钥默认为 token
+}
+
+// SigningConfig 请求签名配置：发送方以共享密钥对时间戳、nonce 和请求体计算 HMAC-SHA256，
+// 请求不再携带 Token 本身
+type SigningConfig struct {
+	Secret   string `yaml:"secret" env:"AUTH_SIGNING_SECRET"`     // 签名密钥，为空时使用凭据的 Token
+	Required bool   `yaml:"required" env:"AUTH_SIGNING_REQUIRED"` // 只接受签名请求，拒绝直接携带 Token 的请求
+	MaxSkew  int    `yaml:"max_skew" env:"AUTH_SIGNING_MAX_SKEW"` // 时间戳允许的最大偏差（秒），默认 300
+}
+
+// Window 时间戳允许的最大偏差，同一 nonce 在此期间内不能重复使用
+func (s SigningConfig) Window() time.Duration {
+	if s.MaxSkew <= 0 {
+		return 5 * time.Minute
+	}
+	return time.Duration(s.MaxSkew) * time.Second
 }
 
 // RateLimitConfig 限流配置
@@ -60,6 +207,17 @@ type RateLimitConfig struct {
 	MaxFailures int `yaml:"max_failures" env:"RATE_LIMIT_MAX_FAILURES"`
 	BlockTime   int `yaml:"block_time" env:"RATE_LIMIT_BLOCK_TIME"`
 	WindowTime  int `yaml:"window_time" env:"RATE_LIMIT_WINDOW_TIME"`
+
+	// 发布限流（令牌桶 + 每日配额），按凭据和来源 IP 分别计算，0 表示不限制
+	// 凭据：Token、管理员 Token 或配置独立密钥的接入端点名称，MQTT 与 Webhook 共享额度
+	CredentialRate       int `yaml:"credential_rate" env:"RATE_LIMIT_CREDENTIAL_RATE"`               // 每个凭据每周期消息数
+	CredentialPeriod     int `yaml:"credential_period" env:"RATE_LIMIT_CREDENTIAL_PERIOD"`           // 周期（秒）
+	CredentialBurst      int `yaml:"credential_burst" env:"RATE_LIMIT_CREDENTIAL_BURST"`             // 突发容量，0 表示等于 rate
+	CredentialDailyQuota int `yaml:"credential_daily_quota" env:"RATE_LIMIT_CREDENTIAL_DAILY_QUOTA"` // 每个凭据每日消息上限
+	IPRate               int `yaml:"ip_rate" env:"RATE_LIMIT_IP_RATE"`                               // 每个 IP 每周期消息数
+	IPPeriod             int `yaml:"ip_period" env:"RATE_LIMIT_IP_PERIOD"`                           // 周期（秒）
+	IPBurst              int `yaml:"ip_burst" env:"RATE_LIMIT_IP_BURST"`                             // 突发容量，0 表示等于 rate
+	IPDailyQuota         int `yaml:"ip_daily_quota" env:"RATE_LIMIT_IP_DAILY_QUOTA"`                 // 每个 IP 每日消息上限
 }
 
 // LogConfig 日志配置
@@ -77,6 +235,55 @@ func (c *Config) HasAuth() bool {
 	return c.Auth.Token != ""
 }
 
+// IsAdmin 判断 Token 是否具有管理员权限
+// 未配置 AdminToken 时，普通 Token 即管理员
+func (c *Config) IsAdmin(token string) bool {
+	if token == "" {
+		return false
+	}
+	if c.Auth.AdminToken == "" {
+		return TokenEqual(token, c.Auth.Token)
+	}
+	return TokenEqual(token, c.Auth.AdminToken)
+}
+
+// reservedPaths HTTP 服务注册的路由前缀，WebSocket 路径不能与之重叠（须与 main.go 中的路由保持一致）
+var reservedPaths = []string{"/webhook", "/health", "/status", "/messages", "/clients", "/scheduled", "/recurring", "/rules", "/sessions"}
+
+// Validate 校验启动前必须满足的配置项
+func (c *Config) Validate() error {
+	return validateWSPath(c.MQTT.WSPath)
+}
+
+// validateWSPath 校验 HTTP 端口上的 WebSocket 路径：为空表示不挂载，
+// 否则必须以 / 开头、不能是 / 本身，也不能与已注册的路由重叠，避免注册路由时 panic 或覆盖其他接口
+func validateWSPath(p string) error {
+	if p == "" {
+		return nil
+	}
+	if !strings.HasPrefix(p, "/") {
+		return fmt.Errorf("mqtt.ws_path 必须以 / 开头: %q", p)
+	}
+	if strings.ContainsAny(p, " \t{}") {
+		return fmt.Errorf("mqtt.ws_path 不能包含空白或 {}: %q", p)
+	}
+	trimmed := strings.TrimSuffix(p, "/")
+	if trimmed == "" {
+		return fmt.Errorf("mqtt.ws_path 不能是 /，会覆盖 Web 控制台")
+	}
+	for _, r := range reservedPaths {
+		if trimmed == r || strings.HasPrefix(trimmed, r+"/") || strings.HasPrefix(r, trimmed+"/") {
+			return fmt.Errorf("mqtt.ws_path %q 与 HTTP 接口 %s 冲突", p, r)
+		}
+	}
+	return nil
+}
+
+// TokenEqual 以常量时间比较 Token，避免通过响应耗时逐字节猜测
+func TokenEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
 // defaultConfig 返回默认配置
 func defaultConfig() *Config {
 	return &Config{
@@ -86,9 +293,12 @@ func defaultConfig() *Config {
 		MQTT: MQTTConfig{
 			TCPPort:       "9091",
 			WSPort:        "9092",
+			WSPath:        "/mqtt",
 			Topic:         "notice",
 			SessionExpiry: 86400,
 			MessageExpiry: 86400,
+			SysInterval:   10,
+			PresenceTopic: "$notice/presence",
 		},
 		Auth: AuthConfig{
 			Token: "",
@@ -97,6 +307,9 @@ func defaultConfig() *Config {
 			MaxFailures: 5,
 			BlockTime:   900,
 			WindowTime:  300,
+
+			CredentialPeriod: 60,
+			IPPeriod:         60,
 		},
 		Log: LogConfig{
 			ConsoleLevel: "info",
@@ -111,8 +324,9 @@ func defaultConfig() *Config {
 			Path:    "data",
 		},
 		Message: MessageConfig{
-			MaxTitleLength:   50,  // 标题最大 50 字符
-			MaxContentLength: 1024, // 内容最大 1024 字符
+			MaxTitleLength:   50,    // 标题最大 50 字符
+			MaxContentLength: 1024,  // 内容最大 1024 字符
+			MaxPayloadBytes:  65536, // 负载最大 64 KB
 		},
 	}
 }
@@ -231,6 +445,19 @@ func setFieldValue(field reflect.Value, value string) error {
 		}
 		field.SetFloat(v)
 
+	case reflect.Slice:
+		// 字符串列表以逗号分隔
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("不支持的类型: %s", field.Type())
+		}
+		var list []string
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				list = append(list, s)
+			}
+		}
+		field.Set(reflect.ValueOf(list))
+
 	default:
 		return fmt.Errorf("不支持的类型: %s", field.Kind())
 	}
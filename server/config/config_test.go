@@ -4,7 +4,9 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestDefaultConfig(t *testing.T) {
@@ -22,6 +24,9 @@ func TestDefaultConfig(t *testing.T) {
 	if cfg.MQTT.WSPort != "9092" {
 		t.Errorf("MQTT.WSPort = %s, want 9092", cfg.MQTT.WSPort)
 	}
+	if cfg.MQTT.WSPath != "/mqtt" {
+		t.Errorf("MQTT.WSPath = %s, want /mqtt", cfg.MQTT.WSPath)
+	}
 	if cfg.MQTT.Topic != "notice" {
 		t.Errorf("MQTT.Topic = %s, want notice", cfg.MQTT.Topic)
 	}
@@ -31,6 +36,12 @@ func TestDefaultConfig(t *testing.T) {
 	if cfg.MQTT.MessageExpiry != 86400 {
 		t.Errorf("MQTT.MessageExpiry = %d, want 86400", cfg.MQTT.MessageExpiry)
 	}
+	if cfg.MQTT.SysInterval != 10 {
+		t.Errorf("MQTT.SysInterval = %d, want 10", cfg.MQTT.SysInterval)
+	}
+	if cfg.MQTT.PresenceTopic != "$notice/presence" {
+		t.Errorf("MQTT.PresenceTopic = %s, want $notice/presence", cfg.MQTT.PresenceTopic)
+	}
 
 	// Auth
 	if cfg.Auth.Token != "" {
@@ -47,6 +58,24 @@ func TestDefaultConfig(t *testing.T) {
 	if cfg.RateLimit.WindowTime != 300 {
 		t.Errorf("RateLimit.WindowTime = %d, want 300", cfg.RateLimit.WindowTime)
 	}
+	// 发布限流默认关闭
+	if cfg.RateLimit.CredentialRate != 0 || cfg.RateLimit.IPRate != 0 {
+		t.Errorf("发布限流默认应关闭: credential_rate=%d, ip_rate=%d", cfg.RateLimit.CredentialRate, cfg.RateLimit.IPRate)
+	}
+	if cfg.RateLimit.CredentialPeriod != 60 || cfg.RateLimit.IPPeriod != 60 {
+		t.Errorf("发布限流周期默认应为 60: credential_period=%d, ip_period=%d", cfg.RateLimit.CredentialPeriod, cfg.RateLimit.IPPeriod)
+	}
+
+	// Message
+	if cfg.Message.MaxPayloadBytes != 65536 {
+		t.Errorf("Message.MaxPayloadBytes = %d, want 65536", cfg.Message.MaxPayloadBytes)
+	}
+	if cfg.Message.DedupWindow != 0 || cfg.Message.DedupSummary {
+		t.Errorf("重复消息合并默认应关闭: dedup_window=%d, dedup_summary=%v", cfg.Message.DedupWindow, cfg.Message.DedupSummary)
+	}
+	if cfg.Message.StrictJSON || cfg.Message.Truncate || cfg.Message.PriorityTopics {
+		t.Errorf("严格 JSON、截断与优先级主题默认应关闭: strict_json=%v, truncate=%v, priority_topics=%v", cfg.Message.StrictJSON, cfg.Message.Truncate, cfg.Message.PriorityTopics)
+	}
 
 	// Log
 	if cfg.Log.ConsoleLevel != "info" {
@@ -135,6 +164,223 @@ func TestLoadFromFileNotExist(t *testing.T) {
 	}
 }
 
+func TestLoadBridges(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	yamlContent := `
+mqtt:
+  bridges:
+    - name: "ha"
+      address: "192.168.1.10:1883"
+      username: "notice"
+      password: "secret"
+      protocol_version: 5
+      topics:
+        - filter: "#"
+          direction: "in"
+          qos: 1
+          remote_prefix: "homeassistant/notify/"
+          local_prefix: "notice/ha/"
+        - filter: "alert/#"
+          direction: "out"
+`
+	if err := os.WriteFile(configPath, []byte(yamlContent), 0644); err != nil {
+		t.Fatalf("写入配置文件失败: %v", err)
+	}
+
+	cfg := defaultConfig()
+	if err := loadFromFile(configPath, cfg); err != nil {
+		t.Fatalf("加载配置文件失败: %v", err)
+	}
+
+	if len(cfg.MQTT.Bridges) != 1 {
+		t.Fatalf("Bridges 数量 = %d, want 1", len(cfg.MQTT.Bridges))
+	}
+	br := cfg.MQTT.Bridges[0]
+	if br.Name != "ha" || br.Address != "192.168.1.10:1883" {
+		t.Errorf("Bridge = %s %s, want ha 192.168.1.10:1883", br.Name, br.Address)
+	}
+	if br.ProtocolVersion != 5 {
+		t.Errorf("Bridge.ProtocolVersion = %d, want 5", br.ProtocolVersion)
+	}
+	if len(br.Topics) != 2 {
+		t.Fatalf("Bridge.Topics 数量 = %d, want 2", len(br.Topics))
+	}
+	if br.Topics[0].RemotePrefix != "homeassistant/notify/" || br.Topics[0].LocalPrefix != "notice/ha/" {
+		t.Errorf("Topics[0] 前缀不匹配: %+v", br.Topics[0])
+	}
+	if br.Topics[1].Direction != "out" || br.Topics[1].Filter != "alert/#" {
+		t.Errorf("Topics[1] 不匹配: %+v", br.Topics[1])
+	}
+
+	// 未配置桥接时保持为空，且其他默认值不受影响
+	if cfg.MQTT.Topic != "notice" {
+		t.Errorf("MQTT.Topic = %s, want notice", cfg.MQTT.Topic)
+	}
+}
+
+func TestLoadRecurring(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	yamlContent := `
+recurring:
+  - name: "oncall"
+    cron: "0 10 * * 1"
+    timezone: "Asia/Shanghai"
+    title: "值班交接"
+    content: "{{.Time.Format \"2006-01-02\"}} 值班交接"
+    catch_up: true
+  - name: "report"
+    cron: "@weekly"
+`
+	if err := os.WriteFile(configPath, []byte(yamlContent), 0644); err != nil {
+		t.Fatalf("写入配置文件失败: %v", err)
+	}
+
+	cfg := defaultConfig()
+	if err := loadFromFile(configPath, cfg); err != nil {
+		t.Fatalf("加载配置文件失败: %v", err)
+	}
+
+	if len(cfg.Recurring) != 2 {
+		t.Fatalf("Recurring 数量 = %d, want 2", len(cfg.Recurring))
+	}
+	r := cfg.Recurring[0]
+	if r.Name != "oncall" || r.Cron != "0 10 * * 1" || r.Timezone != "Asia/Shanghai" || !r.CatchUp {
+		t.Errorf("Recurring[0] 不匹配: %+v", r)
+	}
+	if r.Content != `{{.Time.Format "2006-01-02"}} 值班交接` {
+		t.Errorf("Recurring[0].Content = %s", r.Content)
+	}
+	if cfg.Recurring[1].CatchUp {
+		t.Error("catch_up 默认应为 false")
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	yamlContent := `
+rules:
+  - name: "disk"
+    match:
+      title: "(?i)disk"
+      client: ["zabbix", "grafana"]
+      extra:
+        labels.severity: "critical"
+      ip: ["10.0.0.0/8"]
+    topics: ["ops/disk", "oncall"]
+    priority: "high"
+    tags: ["ops"]
+    continue: true
+  - name: "noise"
+    match:
+      content: "^heartbeat$"
+    drop: true
+`
+	if err := os.WriteFile(configPath, []byte(yamlContent), 0644); err != nil {
+		t.Fatalf("写入配置文件失败: %v", err)
+	}
+
+	cfg := defaultConfig()
+	if err := loadFromFile(configPath, cfg); err != nil {
+		t.Fatalf("加载配置文件失败: %v", err)
+	}
+
+	if len(cfg.Rules) != 2 {
+		t.Fatalf("Rules 数量 = %d, want 2", len(cfg.Rules))
+	}
+	r := cfg.Rules[0]
+	if r.Name != "disk" || r.Match.Title != "(?i)disk" || len(r.Match.Client) != 2 || r.Match.IP[0] != "10.0.0.0/8" {
+		t.Errorf("Rules[0].Match 不匹配: %+v", r.Match)
+	}
+	if r.Match.Extra["labels.severity"] != "critical" {
+		t.Errorf("Rules[0].Match.Extra = %v", r.Match.Extra)
+	}
+	if len(r.Topics) != 2 || r.Priority != "high" || r.Tags[0] != "ops" || !r.Continue || r.Drop {
+		t.Errorf("Rules[0] 动作不匹配: %+v", r)
+	}
+	if !cfg.Rules[1].Drop || cfg.Rules[1].Continue {
+		t.Errorf("Rules[1] 不匹配: %+v", cfg.Rules[1])
+	}
+}
+
+func TestLoadInbound(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "config.yaml")
+
+	yamlContent := `
+inbound:
+  github:
+    secret: "gh-secret"
+    topic: "dev/github"
+    topics:
+      pipeline: "dev/ci"
+  gitlab:
+    secret: "gl-token"
+  alertmanager:
+    topic: "alerts/{{.GroupLabels.team}}"
+    severity:
+      page: "urgent"
+    resolved_notice: true
+  custom:
+    - name: kuma
+      secret: "kuma-token"
+      signing:
+        required: true
+        max_skew: 60
+      title: "{{.monitor.name}}"
+      content: "$.msg"
+      extra:
+        status: "$.heartbeat.status"
+`
+	if err := os.WriteFile(configPath, []byte(yamlContent), 0644); err != nil {
+		t.Fatalf("写入配置文件失败: %v", err)
+	}
+
+	cfg := defaultConfig()
+	if err := loadFromFile(configPath, cfg); err != nil {
+		t.Fatalf("加载配置文件失败: %v", err)
+	}
+
+	gh := cfg.Inbound.GitHub
+	if gh.Secret != "gh-secret" || gh.Topic != "dev/github" || gh.Topics["pipeline"] != "dev/ci" {
+		t.Errorf("Inbound.GitHub 不匹配: %+v", gh)
+	}
+	if cfg.Inbound.GitLab.Secret != "gl-token" || cfg.Inbound.GitLab.Topic != "" {
+		t.Errorf("Inbound.GitLab 不匹配: %+v", cfg.Inbound.GitLab)
+	}
+	am := cfg.Inbound.Alertmanager
+	if am.Topic != "alerts/{{.GroupLabels.team}}" || am.Severity["page"] != "urgent" || !am.ResolvedNotice || am.SeverityLabel != "" {
+		t.Errorf("Inbound.Alertmanager 不匹配: %+v", am)
+	}
+	if len(cfg.Inbound.Custom) != 1 {
+		t.Fatalf("Inbound.Custom 数量 = %d, want 1", len(cfg.Inbound.Custom))
+	}
+	c := cfg.Inbound.Custom[0]
+	if c.Name != "kuma" || c.Secret != "kuma-token" || c.Title != "{{.monitor.name}}" || c.Content != "$.msg" || c.Extra["status"] != "$.heartbeat.status" {
+		t.Errorf("Inbound.Custom[0] 不匹配: %+v", c)
+	}
+	if !c.Signing.Required || c.Signing.Window() != time.Minute || c.Signing.Secret != "" {
+		t.Errorf("Inbound.Custom[0].Signing 不匹配: %+v", c.Signing)
+	}
+	if cfg.Inbound.Gitea.Secret != "" {
+		t.Errorf("Inbound.Gitea.Secret = %q, want 空", cfg.Inbound.Gitea.Secret)
+	}
+}
+
+func TestSigningWindow(t *testing.T) {
+	if w := (SigningConfig{}).Window(); w != 5*time.Minute {
+		t.Errorf("默认 Window() = %v, want 5m", w)
+	}
+	if w := (SigningConfig{MaxSkew: 30}).Window(); w != 30*time.Second {
+		t.Errorf("Window() = %v, want 30s", w)
+	}
+}
+
 func TestApplyEnvOverrides(t *testing.T) {
 	// 保存原始环境变量
 	originalEnv := map[string]string{
@@ -144,6 +390,7 @@ func TestApplyEnvOverrides(t *testing.T) {
 		"AUTH_TOKEN":             os.Getenv("AUTH_TOKEN"),
 		"RATE_LIMIT_MAX_FAILURES": os.Getenv("RATE_LIMIT_MAX_FAILURES"),
 		"LOG_PRETTY":             os.Getenv("LOG_PRETTY"),
+		"HTTP_TRUSTED_PROXIES":   os.Getenv("HTTP_TRUSTED_PROXIES"),
 	}
 	defer func() {
 		for k, v := range originalEnv {
@@ -162,6 +409,7 @@ func TestApplyEnvOverrides(t *testing.T) {
 	os.Setenv("AUTH_TOKEN", "env-token")
 	os.Setenv("RATE_LIMIT_MAX_FAILURES", "20")
 	os.Setenv("LOG_PRETTY", "false")
+	os.Setenv("HTTP_TRUSTED_PROXIES", "127.0.0.1, 10.0.0.0/8,")
 
 	cfg := defaultConfig()
 	applyEnvOverrides(cfg)
@@ -185,6 +433,9 @@ func TestApplyEnvOverrides(t *testing.T) {
 	if cfg.Log.Pretty != false {
 		t.Errorf("Log.Pretty = %v, want false", cfg.Log.Pretty)
 	}
+	if got := strings.Join(cfg.HTTP.TrustedProxies, ","); got != "127.0.0.1,10.0.0.0/8" {
+		t.Errorf("HTTP.TrustedProxies = %v, want [127.0.0.1 10.0.0.0/8]", cfg.HTTP.TrustedProxies)
+	}
 }
 
 func TestApplyEnvOverridesInvalidValue(t *testing.T) {
@@ -334,6 +585,47 @@ func TestHasAuth(t *testing.T) {
 	}
 }
 
+func TestIsAdmin(t *testing.T) {
+	cfg := &Config{}
+	cfg.Auth.Token = "user-token"
+
+	// 未配置管理员 Token 时，普通 Token 即管理员
+	if !cfg.IsAdmin("user-token") {
+		t.Error("IsAdmin(user-token) = false, want true (未配置 admin_token)")
+	}
+	if cfg.IsAdmin("") {
+		t.Error("IsAdmin(\"\") = true, want false")
+	}
+
+	// 配置管理员 Token 后，普通 Token 不再是管理员
+	cfg.Auth.AdminToken = "admin-token"
+	if cfg.IsAdmin("user-token") {
+		t.Error("IsAdmin(user-token) = true, want false")
+	}
+	if !cfg.IsAdmin("admin-token") {
+		t.Error("IsAdmin(admin-token) = false, want true")
+	}
+}
+
+func TestTokenEqual(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"token", "token", true},
+		{"token", "tokem", false},
+		{"token", "token2", false},
+		{"", "", true},
+		{"", "token", false},
+	}
+
+	for _, tt := range tests {
+		if got := TokenEqual(tt.a, tt.b); got != tt.want {
+			t.Errorf("TokenEqual(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
 func TestGetConfigPath(t *testing.T) {
 	// 保存原始环境变量和参数
 	originalArgs := os.Args
@@ -470,3 +762,34 @@ func TestLoad(t *testing.T) {
 		}
 	})
 }
+
+func TestValidateWSPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		wantErr bool
+	}{
+		{"", false},
+		{"/mqtt", false},
+		{"/ws/mqtt", false},
+		{"/mqtt/", false},
+		{"/webhooks", false},
+		{"mqtt", true},
+		{"/", true},
+		{"/webhook", true},
+		{"/webhook/", true},
+		{"/webhook/mqtt", true},
+		{"/rules", true},
+		{"/sessions/x", true},
+		{"GET /mqtt", true},
+		{"/mqtt/{id}", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			cfg := defaultConfig()
+			cfg.MQTT.WSPath = tt.path
+			if err := cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
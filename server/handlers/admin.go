@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"notice-server/broker"
+	"notice-server/config"
+	"notice-server/logger"
+)
+
+// SessionsHandler 列出持久会话及其待投递消息数（需要管理员 Token）
+// GET /sessions
+func SessionsHandler(b *broker.Broker, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !requireAdmin(w, r, cfg) {
+			return
+		}
+
+		sessions := b.Sessions()
+		pending := 0
+		for _, s := range sessions {
+			pending += s.Pending
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"success": true,
+			"data": map[string]any{
+				"sessions": sessions,
+				"total":    len(sessions),
+				"pending":  pending,
+			},
+		})
+	}
+}
+
+// DisconnectClientHandler 断开在线客户端，会话保留（需要管理员 Token）
+// POST /clients/{id}/disconnect
+func DisconnectClientHandler(b *broker.Broker, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !requireAdmin(w, r, cfg) {
+			return
+		}
+
+		if err := b.Disconnect(r.PathValue("id")); err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"success": true,
+			"message": "客户端已断开",
+		})
+	}
+}
+
+// ExpireSessionHandler 立即过期会话，清除订阅和离线消息（需要管理员 Token）
+// DELETE /sessions/{id}
+func ExpireSessionHandler(b *broker.Broker, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !requireAdmin(w, r, cfg) {
+			return
+		}
+
+		if err := b.ExpireSession(r.PathValue("id")); err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"success": true,
+			"message": "会话已过期",
+		})
+	}
+}
+
+// PurgeQueueHandler 清空会话的离线消息队列（需要管理员 Token）
+// DELETE /sessions/{id}/queue
+func PurgeQueueHandler(b *broker.Broker, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !requireAdmin(w, r, cfg) {
+			return
+		}
+
+		n, err := b.PurgeQueue(r.PathValue("id"))
+		if err != nil {
+			writeAdminError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"success": true,
+			"message": "离线消息已清空",
+			"data":    map[string]any{"purged": n},
+		})
+	}
+}
+
+// requireAdmin 校验管理员 Token，失败时写入错误响应并返回 false
+func requireAdmin(w http.ResponseWriter, r *http.Request, cfg *config.Config) bool {
+	token := ExtractToken(r)
+	if cfg.IsAdmin(token) {
+		return true
+	}
+
+	if isAuthorized(token, cfg) {
+		logger.Warn("非管理员访问管理接口", "path", r.URL.Path)
+		writeJSON(w, http.StatusForbidden, map[string]any{
+			"success": false,
+			"message": "需要管理员权限",
+		})
+		return false
+	}
+
+	writeJSON(w, http.StatusUnauthorized, map[string]any{
+		"success": false,
+		"message": "认证失败",
+	})
+	return false
+}
+
+// writeAdminError 将 broker 错误转换为响应
+func writeAdminError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, broker.ErrClientNotFound) {
+		status = http.StatusNotFound
+	}
+	writeJSON(w, status, map[string]any{
+		"success": false,
+		"message": err.Error(),
+	})
+}
+
+// writeJSON 写入 JSON 响应
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
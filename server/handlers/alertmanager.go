@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"notice-server/broker"
+	"notice-server/logger"
+	"notice-server/ratelimit"
+)
+
+// alertResolved 告警已恢复的状态，另一状态为 firing
+const alertResolved = "resolved"
+
+// defaultAlertSeverity 未配置 severity 时的标签值到优先级映射
+var defaultAlertSeverity = map[string]string{
+	"critical": "urgent",
+	"error":    "high",
+	"warning":  "high",
+	"info":     "low",
+}
+
+// alertPayload Alertmanager Webhook 负载（version 4）
+type alertPayload struct {
+	Receiver          string            `json:"receiver"`
+	Status            string            `json:"status"`
+	GroupKey          string            `json:"groupKey"`
+	GroupLabels       map[string]string `json:"groupLabels"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	ExternalURL       string            `json:"externalURL"`
+	Alerts            []alert           `json:"alerts"`
+}
+
+type alert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+// AlertData 告警主题模板可用的数据
+type AlertData struct {
+	Receiver     string            // 接收者名称
+	Status       string            // 告警状态：firing / resolved
+	GroupLabels  map[string]string // 分组标签
+	CommonLabels map[string]string // 组内告警的公共标签
+	Labels       map[string]string // 当前告警的标签
+	Annotations  map[string]string // 当前告警的注解
+}
+
+// AlertResult 单条告警的处理结果
+type AlertResult struct {
+	Fingerprint string `json:"fingerprint"`
+	Status      string `json:"status"`
+	ID          uint64 `json:"id,omitempty"`        // 告警对应的消息 ID
+	Updated     bool   `json:"updated,omitempty"`   // 已更新原消息
+	Unchanged   bool   `json:"unchanged,omitempty"` // 状态未变化（Alertmanager 重复通知），未发布
+	Dropped     bool   `json:"dropped,omitempty"`   // 被路由规则丢弃
+	NoticeID    uint64 `json:"notice_id,omitempty"` // 恢复通知的消息 ID
+	Error       string `json:"error,omitempty"`
+}
+
+// AlertmanagerResponse Alertmanager 接入的响应
+type AlertmanagerResponse struct {
+	Success bool          `json:"success"`
+	Message string        `json:"message"`
+	Alerts  []AlertResult `json:"alerts,omitempty"`
+}
+
+// AlertmanagerHandler Prometheus Alertmanager 接入：每个告警（按 fingerprint）对应一条消息，
+// 恢复时更新同一条消息。主题模板无效时返回错误
+// POST /webhook/alertmanager
+func (h *WebhookHandler) AlertmanagerHandler() (http.HandlerFunc, error) {
+	cfg := h.config.Inbound.Alertmanager
+	var topic *template.Template
+	if cfg.Topic != "" {
+		var err error
+		if topic, err = template.New("topic").Option("missingkey=zero").Parse(cfg.Topic); err != nil {
+			return nil, fmt.Errorf("alertmanager 主题模板无效: %v", err)
+		}
+	}
+	severity := cfg.Severity
+	if len(severity) == 0 {
+		severity = defaultAlertSeverity
+	}
+	priorities := make(map[string]broker.Priority, len(severity))
+	for value, name := range severity {
+		p, err := broker.ParsePriority(name)
+		if err != nil {
+			return nil, fmt.Errorf("alertmanager severity.%s: %w", value, err)
+		}
+		priorities[value] = p
+	}
+	severityLabel := cfg.SeverityLabel
+	if severityLabel == "" {
+		severityLabel = "severity"
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		c := h.tokenCredential()
+		if cfg.Secret != "" {
+			c = credential{name: "alertmanager", token: cfg.Secret}
+		}
+		body, credential, ok := h.inbound(w, r, c)
+		if !ok {
+			return
+		}
+		var p alertPayload
+		if err := json.Unmarshal(body, &p); err != nil {
+			logger.Warn("Alertmanager 负载解析失败", "error", err)
+			h.sendError(w, http.StatusBadRequest, "JSON 解析失败: "+err.Error())
+			return
+		}
+
+		clientIP := ratelimit.GetClientIP(r)
+		status := http.StatusOK
+		results := make([]AlertResult, 0, len(p.Alerts))
+		for _, a := range p.Alerts {
+			if a.Status == "" {
+				a.Status = p.Status
+			}
+			if a.Fingerprint == "" {
+				a.Fingerprint = alertFingerprint(a.Labels)
+			}
+			req := alertRequest(p, a, severityLabel, priorities)
+			req.Topic = renderAlertTopic(topic, p, a)
+			h.fitRequest(&req)
+
+			res := AlertResult{Fingerprint: a.Fingerprint, Status: a.Status}
+
+			// Alertmanager 每次通知都携带组内全部告警，状态未变的告警不再更新
+			if existing, err := h.broker.MessageByKey(req.Key); err == nil {
+				if existing.Recalled() || alertStatus(existing.Extra) == a.Status {
+					res.ID = existing.ID
+					res.Unchanged = true
+					results = append(results, res)
+					continue
+				}
+			}
+
+			code, resp := h.dispatch(w, clientIP, credential, req)
+			res.ID, res.Updated, res.Dropped = resp.ID, resp.Updated, resp.Dropped
+			if !resp.Success {
+				res.Error = resp.Message
+				status = max(status, code)
+				results = append(results, res)
+				continue
+			}
+
+			// 恢复时原消息已更新；另发布一条恢复通知，不带 key 以免替换原消息
+			if cfg.ResolvedNotice && a.Status == alertResolved && resp.Updated {
+				notice := req
+				notice.Key = ""
+				notice.Priority = nil
+				if code, resp := h.dispatch(w, clientIP, credential, notice); resp.Success {
+					res.NoticeID = resp.ID
+				} else {
+					res.Error = resp.Message
+					status = max(status, code)
+				}
+			}
+			logger.Info("告警已处理", "fingerprint", a.Fingerprint, "status", a.Status, "id", res.ID, "updated", res.Updated)
+			results = append(results, res)
+		}
+
+		resp := AlertmanagerResponse{
+			Success: status == http.StatusOK,
+			Message: fmt.Sprintf("已处理 %d 条告警", len(results)),
+			Alerts:  results,
+		}
+		if !resp.Success {
+			resp.Message = "部分告警处理失败"
+		}
+		// 5xx 时 Alertmanager 会重试，已处理的告警因状态未变而跳过
+		writeJSON(w, status, resp)
+	}, nil
+}
+
+// alertRequest 将告警转为发布请求，key 由 fingerprint 和开始时间组成，
+// 同一次告警的触发和恢复对应同一条消息，恢复后再次触发为新消息
+func alertRequest(p alertPayload, a alert, severityLabel string, priorities map[string]broker.Priority) Request {
+	name := a.Labels["alertname"]
+	if name == "" {
+		name = "告警"
+	}
+
+	req := Request{
+		Client: "alertmanager",
+		Key:    fmt.Sprintf("alertmanager/%s/%d", a.Fingerprint, a.StartsAt.Unix()),
+	}
+	var lines []string
+	if s := a.Annotations["summary"]; s != "" {
+		lines = append(lines, s)
+	}
+	if s := a.Annotations["description"]; s != "" {
+		lines = append(lines, s)
+	}
+	if s := a.Labels["instance"]; s != "" {
+		lines = append(lines, "实例: "+s)
+	}
+	lines = append(lines, "开始: "+a.StartsAt.Local().Format(time.DateTime))
+
+	if a.Status == alertResolved {
+		req.Title = "[已恢复] " + name
+		low := broker.PriorityLow
+		req.Priority = &low
+		if !a.EndsAt.IsZero() {
+			lines = append(lines, "恢复: "+a.EndsAt.Local().Format(time.DateTime))
+		}
+	} else {
+		req.Title = "[告警] " + name
+		p := priorities[a.Labels[severityLabel]]
+		req.Priority = &p
+	}
+	req.Content = strings.Join(lines, "\n")
+
+	extra := map[string]any{
+		"source":        "alertmanager",
+		"status":        a.Status,
+		"fingerprint":   a.Fingerprint,
+		"alertname":     a.Labels["alertname"],
+		"severity":      a.Labels[severityLabel],
+		"labels":        stringMap(a.Labels),
+		"annotations":   stringMap(a.Annotations),
+		"group_labels":  stringMap(p.GroupLabels),
+		"starts_at":     a.StartsAt,
+		"generator_url": a.GeneratorURL,
+		"receiver":      p.Receiver,
+		"group_key":     p.GroupKey,
+		"external_url":  p.ExternalURL,
+	}
+	if a.Status == alertResolved && !a.EndsAt.IsZero() {
+		extra["ends_at"] = a.EndsAt
+	}
+	req.Extra = extra
+
+	return req
+}
+
+// renderAlertTopic 渲染告警的发布主题，未配置、渲染失败或结果无效时返回空（使用默认主题）
+func renderAlertTopic(tmpl *template.Template, p alertPayload, a alert) string {
+	if tmpl == nil {
+		return ""
+	}
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, AlertData{
+		Receiver:     p.Receiver,
+		Status:       a.Status,
+		GroupLabels:  p.GroupLabels,
+		CommonLabels: p.CommonLabels,
+		Labels:       a.Labels,
+		Annotations:  a.Annotations,
+	})
+	if err != nil {
+		logger.Warn("告警主题渲染失败", "error", err)
+		return ""
+	}
+	t := strings.Trim(strings.TrimSpace(buf.String()), "/")
+	if strings.ContainsAny(t, "+#") || strings.HasPrefix(t, "$") {
+		logger.Warn("告警主题无效，使用默认主题", "topic", t)
+		return ""
+	}
+	return t
+}
+
+// alertStatus 读取已保存消息中的告警状态
+func alertStatus(extra any) string {
+	if m, ok := extra.(map[string]any); ok {
+		if s, ok := m["status"].(string); ok {
+			return s
+		}
+	}
+	return ""
+}
+
+// alertFingerprint 旧版 Alertmanager 不提供 fingerprint 时按标签计算
+func alertFingerprint(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	sum := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(sum, "%s\xff%s\xff", k, labels[k])
+	}
+	return hex.EncodeToString(sum.Sum(nil))[:16]
+}
+
+// stringMap 转为 map[string]any，使路由规则可按 extra 路径匹配标签
+func stringMap(m map[string]string) map[string]any {
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
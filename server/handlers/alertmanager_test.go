@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"notice-server/broker"
+)
+
+func TestAlertRequest(t *testing.T) {
+	starts := time.Date(2026, 1, 8, 12, 0, 0, 0, time.UTC)
+	ends := starts.Add(10 * time.Minute)
+	p := alertPayload{Receiver: "notice", GroupKey: "{}:{alertname=\"DiskFull\"}", GroupLabels: map[string]string{"alertname": "DiskFull"}}
+	priorities := map[string]broker.Priority{"critical": broker.PriorityUrgent, "warning": broker.PriorityHigh}
+
+	tests := []struct {
+		name     string
+		alert    alert
+		label    string
+		title    string
+		priority broker.Priority
+		content  []string // 内容包含的行
+		missing  string   // 内容不应包含的片段
+		extra    map[string]any
+	}{
+		{
+			name: "触发",
+			alert: alert{
+				Status:      "firing",
+				Labels:      map[string]string{"alertname": "DiskFull", "severity": "critical", "instance": "web1"},
+				Annotations: map[string]string{"summary": "磁盘将满", "description": "使用率 95%"},
+				StartsAt:    starts,
+				Fingerprint: "abc",
+			},
+			label:    "severity",
+			title:    "[告警] DiskFull",
+			priority: broker.PriorityUrgent,
+			content:  []string{"磁盘将满", "使用率 95%", "实例: web1", "开始: " + starts.Local().Format(time.DateTime)},
+			missing:  "恢复:",
+			extra:    map[string]any{"status": "firing", "alertname": "DiskFull", "severity": "critical", "fingerprint": "abc", "receiver": "notice"},
+		},
+		{
+			name: "恢复",
+			alert: alert{
+				Status:      alertResolved,
+				Labels:      map[string]string{"alertname": "DiskFull", "severity": "critical"},
+				StartsAt:    starts,
+				EndsAt:      ends,
+				Fingerprint: "abc",
+			},
+			label:    "severity",
+			title:    "[已恢复] DiskFull",
+			priority: broker.PriorityLow,
+			content:  []string{"恢复: " + ends.Local().Format(time.DateTime)},
+			extra:    map[string]any{"status": alertResolved, "ends_at": ends},
+		},
+		{
+			name:     "未映射的级别",
+			alert:    alert{Status: "firing", Labels: map[string]string{"alertname": "Slow", "severity": "info"}, StartsAt: starts},
+			label:    "severity",
+			title:    "[告警] Slow",
+			priority: broker.PriorityDefault,
+		},
+		{
+			name:     "自定义级别标签",
+			alert:    alert{Status: "firing", Labels: map[string]string{"alertname": "Down", "level": "warning"}, StartsAt: starts},
+			label:    "level",
+			title:    "[告警] Down",
+			priority: broker.PriorityHigh,
+			extra:    map[string]any{"severity": "warning"},
+		},
+		{
+			name:     "缺少告警名",
+			alert:    alert{Status: "firing", StartsAt: starts},
+			label:    "severity",
+			title:    "[告警] 告警",
+			priority: broker.PriorityDefault,
+			extra:    map[string]any{"alertname": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := alertRequest(p, tt.alert, tt.label, priorities)
+			if req.Title != tt.title {
+				t.Errorf("标题 = %q, 期望 %q", req.Title, tt.title)
+			}
+			if req.Priority == nil || *req.Priority != tt.priority {
+				t.Errorf("优先级 = %v, 期望 %q", req.Priority, tt.priority)
+			}
+			if req.Client != "alertmanager" {
+				t.Errorf("client = %q", req.Client)
+			}
+			if want := "alertmanager/" + tt.alert.Fingerprint + "/" + strconv.FormatInt(starts.Unix(), 10); req.Key != want {
+				t.Errorf("key = %q, 期望 %q", req.Key, want)
+			}
+			lines := strings.Split(req.Content, "\n")
+			for _, want := range tt.content {
+				if !slices.Contains(lines, want) {
+					t.Errorf("内容缺少行 %q: %q", want, lines)
+				}
+			}
+			if tt.missing != "" && strings.Contains(req.Content, tt.missing) {
+				t.Errorf("内容不应包含 %q: %q", tt.missing, req.Content)
+			}
+			extra := req.Extra.(map[string]any)
+			for k, want := range tt.extra {
+				if got := extra[k]; got != want {
+					t.Errorf("extra.%s = %v, 期望 %v", k, got, want)
+				}
+			}
+			if _, ok := extra["ends_at"]; ok != (tt.alert.Status == alertResolved) {
+				t.Errorf("extra.ends_at 仅在恢复时存在: %v", extra["ends_at"])
+			}
+		})
+	}
+}
+
+func TestRenderAlertTopic(t *testing.T) {
+	p := alertPayload{Receiver: "ops", GroupLabels: map[string]string{"team": "db"}}
+	a := alert{Status: "firing", Labels: map[string]string{"alertname": "Down", "env": "prod"}}
+
+	tests := []struct {
+		name string
+		tmpl string
+		want string
+	}{
+		{"未配置", "", ""},
+		{"标签", "alerts/{{.Labels.env}}/{{.GroupLabels.team}}", "alerts/prod/db"},
+		{"接收者和状态", "/{{.Receiver}}/{{.Status}}/", "ops/firing"},
+		{"缺少的标签", "alerts/{{.Labels.missing}}", "alerts"},
+		{"通配符", "alerts/{{.Labels.env}}/#", ""},
+		{"系统主题", "$SYS/{{.Labels.env}}", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tmpl *template.Template
+			if tt.tmpl != "" {
+				tmpl = template.Must(template.New("topic").Option("missingkey=zero").Parse(tt.tmpl))
+			}
+			if got := renderAlertTopic(tmpl, p, a); got != tt.want {
+				t.Errorf("renderAlertTopic() = %q, 期望 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAlertStatus(t *testing.T) {
+	tests := []struct {
+		extra any
+		want  string
+	}{
+		{map[string]any{"status": "firing"}, "firing"},
+		{map[string]any{"status": 1}, ""},
+		{map[string]any{}, ""},
+		{"resolved", ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := alertStatus(tt.extra); got != tt.want {
+			t.Errorf("alertStatus(%v) = %q, 期望 %q", tt.extra, got, tt.want)
+		}
+	}
+}
+
+func TestAlertFingerprint(t *testing.T) {
+	a := alertFingerprint(map[string]string{"alertname": "Down", "instance": "web1"})
+	b := alertFingerprint(map[string]string{"instance": "web1", "alertname": "Down"})
+	if a != b {
+		t.Errorf("相同标签的 fingerprint 应相同: %s != %s", a, b)
+	}
+	if len(a) != 16 {
+		t.Errorf("fingerprint 长度 = %d, 期望 16", len(a))
+	}
+	// 标签边界不同的组合不应冲突
+	if alertFingerprint(map[string]string{"a": "bc"}) == alertFingerprint(map[string]string{"ab": "c"}) {
+		t.Error("不同标签的 fingerprint 不应相同")
+	}
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -38,7 +39,7 @@ func MessagesHandler(m *store.Manager, cfg *config.Config) http.HandlerFunc {
 
 		// 获取并校验 Token
 		token := ExtractToken(r)
-		if token == "" || token != cfg.Auth.Token {
+		if token == "" || !config.TokenEqual(token, cfg.Auth.Token) {
 			w.WriteHeader(http.StatusUnauthorized)
 			json.NewEncoder(w).Encode(map[string]any{
 				"success": false,
@@ -77,6 +78,240 @@ func MessagesHandler(m *store.Manager, cfg *config.Config) http.HandlerFunc {
 	}
 }
 
+// MessageHandler 单条消息查询，包含编辑历史
+// GET /messages/{id}
+func MessageHandler(m *store.Manager, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if !isAuthorized(ExtractToken(r), cfg) {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]any{
+				"success": false,
+				"message": "认证失败",
+			})
+			return
+		}
+
+		id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{
+				"success": false,
+				"message": "无效的消息 ID",
+			})
+			return
+		}
+
+		msg, err := m.Get(cfg.Auth.Token, id)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, store.ErrNotFound) {
+				status = http.StatusNotFound
+			}
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]any{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": true,
+			"data":    msg,
+		})
+	}
+}
+
+// RecallMessageHandler 撤回消息
+// DELETE /messages/{id}?recall=true
+// 管理员 Token 可撤回任意消息，普通 Token 只能撤回以普通 Token 发布的消息
+func RecallMessageHandler(b *broker.Broker, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		token := ExtractToken(r)
+		if !isAuthorized(token, cfg) {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]any{
+				"success": false,
+				"message": "认证失败",
+			})
+			return
+		}
+
+		id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{
+				"success": false,
+				"message": "无效的消息 ID",
+			})
+			return
+		}
+
+		// 消息历史不支持直接删除，只能撤回
+		if recall, _ := strconv.ParseBool(r.URL.Query().Get("recall")); !recall {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{
+				"success": false,
+				"message": "只支持撤回消息，请指定 recall=true",
+			})
+			return
+		}
+
+		credential := broker.CredentialToken
+		if cfg.IsAdmin(token) {
+			credential = broker.CredentialAdmin
+		}
+		result, err := b.Recall(id, credential)
+		if err != nil {
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				status = http.StatusNotFound
+			case errors.Is(err, broker.ErrRecallForbidden):
+				status = http.StatusForbidden
+			case errors.Is(err, store.ErrDisabled):
+				status = http.StatusServiceUnavailable
+			}
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]any{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": true,
+			"message": "消息已撤回",
+			"data":    result,
+		})
+	}
+}
+
+// DeliveriesHandler 消息投递回执查询
+// GET /messages/{id}/deliveries
+// 回执由投递钩子异步写入，经 Broker 读取以包含尚在写入队列中的回执
+func DeliveriesHandler(b *broker.Broker, m *store.Manager, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if !isAuthorized(ExtractToken(r), cfg) {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]any{
+				"success": false,
+				"message": "认证失败",
+			})
+			return
+		}
+
+		id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{
+				"success": false,
+				"message": "无效的消息 ID",
+			})
+			return
+		}
+
+		if _, err := m.Get(cfg.Auth.Token, id); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, store.ErrNotFound) {
+				status = http.StatusNotFound
+			}
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]any{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+
+		deliveries, err := b.Deliveries(id)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(map[string]any{
+				"success": false,
+				"message": "查询失败: " + err.Error(),
+			})
+			return
+		}
+
+		delivered := 0
+		for _, d := range deliveries {
+			if d.Status == store.DeliveryDelivered {
+				delivered++
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": true,
+			"data": map[string]any{
+				"id":         id,
+				"deliveries": deliveries,
+				"delivered":  delivered,
+				"total":      len(deliveries),
+			},
+		})
+	}
+}
+
+// ClientsHandler 客户端在线状态查询
+// 返回在线客户端及保留会话的离线客户端
+func ClientsHandler(b *broker.Broker, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			json.NewEncoder(w).Encode(map[string]any{
+				"success": false,
+				"message": "只支持 GET 请求",
+			})
+			return
+		}
+
+		if !isAuthorized(ExtractToken(r), cfg) {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]any{
+				"success": false,
+				"message": "认证失败",
+			})
+			return
+		}
+
+		clients := b.Clients()
+		online := 0
+		for _, c := range clients {
+			if c.Online {
+				online++
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]any{
+			"success": true,
+			"data": map[string]any{
+				"clients": clients,
+				"online":  online,
+				"total":   len(clients),
+			},
+		})
+	}
+}
+
+// isAuthorized 普通 Token 或管理员 Token 均可访问
+func isAuthorized(token string, cfg *config.Config) bool {
+	return token != "" && (config.TokenEqual(token, cfg.Auth.Token) || cfg.IsAdmin(token))
+}
+
 // ExtractToken 从请求中提取 Token
 func ExtractToken(r *http.Request) string {
 	// Authorization: Bearer <token>
@@ -99,8 +334,3 @@ func ExtractToken(r *http.Request) string {
 
 	return ""
 }
-
-// ValidateToken 校验 Token
-func ValidateToken(r *http.Request, token string) bool {
-	return ExtractToken(r) == token
-}
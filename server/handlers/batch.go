@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"notice-server/broker"
+	"notice-server/logger"
+	"notice-server/ratelimit"
+)
+
+// maxBatchSize 单次批量发布的最大消息数
+const maxBatchSize = 500
+
+// BatchItemResult 批量发布中一条消息的结果
+type BatchItemResult struct {
+	Index   int      `json:"index"` // 在请求数组中的位置，从 0 开始
+	Success bool     `json:"success"`
+	ID      uint64   `json:"id,omitempty"`    // 消息历史中的 ID（启用存储时）
+	Topic   string   `json:"topic,omitempty"` // 发布主题，分发到多个主题时为第一个
+	Rules   []string `json:"rules,omitempty"`
+	Dropped bool     `json:"dropped,omitempty"`
+	// 作为重复消息被合并（未发布），ID 为窗口内首条消息的 ID
+	Suppressed bool    `json:"suppressed,omitempty"`
+	Repeats    int     `json:"repeats,omitempty"`
+	Routes     []Route `json:"routes,omitempty"` // 分发到多个主题时每个主题的结果
+	Error      string  `json:"error,omitempty"`
+}
+
+// BatchResponse 批量发布的响应
+type BatchResponse struct {
+	Success   bool              `json:"success"` // 全部成功
+	Message   string            `json:"message"`
+	Clients   int               `json:"clients,omitempty"`
+	Published int               `json:"published"` // 成功（含被规则丢弃）的数量
+	Failed    int               `json:"failed"`
+	Results   []BatchItemResult `json:"results"`
+}
+
+// BatchHandler 批量发布：请求体为消息数组，逐条校验，与单条发布一样经重复消息合并后下发，返回每条消息的结果
+// POST /webhook/batch
+func (h *WebhookHandler) BatchHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	body, credential, ok := h.inbound(w, r, h.tokenCredential())
+	if !ok {
+		return
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(fixJSONNewlines(body), &raw); err != nil {
+		logger.Warn("批量请求解析失败", "error", err)
+		h.sendError(w, http.StatusBadRequest, "JSON 解析失败，请求体应为消息数组: "+err.Error())
+		return
+	}
+	if len(raw) == 0 {
+		h.sendError(w, http.StatusBadRequest, "消息数组不能为空")
+		return
+	}
+	if len(raw) > maxBatchSize {
+		h.sendError(w, http.StatusBadRequest, fmt.Sprintf("单次最多发布 %d 条消息", maxBatchSize))
+		return
+	}
+
+	clientIP := ratelimit.GetClientIP(r)
+	results := make([]BatchItemResult, len(raw))
+	var items []broker.BatchItem
+	var owners []int               // items[j] 属于 results[owners[j]]
+	var limits []*ratelimit.Result // 每条消息的限流结果
+	for i, data := range raw {
+		res := &results[i]
+		res.Index = i
+
+		var req Request
+		if err := json.Unmarshal(data, &req); err != nil {
+			res.Error = "JSON 解析失败: " + err.Error()
+			continue
+		}
+		if err := h.validateBatchItem(req); err != nil {
+			res.Error = err.Error()
+			continue
+		}
+
+		// 每条消息分别计入发布限流，与单条发布相同，被合并的重复消息不扣除
+		charge, limit := h.newCharge(w, clientIP, credential)
+		route := h.route(clientIP, credential, req)
+		res.Rules = route.Rules
+		if route.Dropped {
+			if err := charge(); err != nil {
+				res.Error = limitMessage(*limit)
+				continue
+			}
+			res.Success, res.Dropped = true, true
+			continue
+		}
+		for _, t := range route.Topics {
+			items = append(items, broker.BatchItem{Topic: t, Message: route.Message, Charge: charge})
+			owners = append(owners, i)
+			limits = append(limits, limit)
+		}
+	}
+
+	for j, pr := range h.broker.PublishBatch(items) {
+		route := Route{Topic: items[j].Topic, ID: pr.ID, Suppressed: pr.Suppressed}
+		switch {
+		case errors.Is(pr.Err, errPublishLimited):
+			route.Error = limitMessage(*limits[j])
+		case pr.Err != nil:
+			logger.Error("消息发布失败", "topic", route.Topic, "error", pr.Err)
+			route.Error = "消息推送失败"
+		}
+		res := &results[owners[j]]
+		if len(res.Routes) == 0 {
+			res.Repeats = pr.Repeats
+		}
+		res.Routes = append(res.Routes, route)
+	}
+
+	resp := BatchResponse{Clients: h.broker.ClientCount(), Results: results}
+	for i := range results {
+		res := &results[i]
+		if len(res.Routes) > 0 {
+			first := res.Routes[0]
+			res.Topic, res.ID, res.Suppressed = first.Topic, first.ID, first.Suppressed
+			res.Success = first.Error == ""
+			if !res.Success {
+				res.Error = first.Error
+			}
+			if len(res.Routes) == 1 {
+				res.Routes = nil
+			}
+		}
+		if res.Success {
+			resp.Published++
+		} else {
+			resp.Failed++
+		}
+	}
+	resp.Success = resp.Failed == 0
+	resp.Message = fmt.Sprintf("已发布 %d 条，失败 %d 条", resp.Published, resp.Failed)
+	logger.Info("批量发布完成", "total", len(results), "published", resp.Published, "failed", resp.Failed)
+
+	// 部分失败时仍返回 200，按 results 判断每条消息
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// validateBatchItem 校验批量发布中的一条消息，批量发布只支持立即发布新消息
+func (h *WebhookHandler) validateBatchItem(req Request) error {
+	if req.UpdateID > 0 || req.Key != "" {
+		return errors.New("批量发布不支持 update_id / key")
+	}
+	if req.SendAt != nil || req.Delay != nil {
+		return errors.New("批量发布不支持 send_at / delay")
+	}
+	return h.validate(req)
+}
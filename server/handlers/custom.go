@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"notice-server/broker"
+	"notice-server/config"
+	"notice-server/logger"
+	"notice-server/ratelimit"
+)
+
+// templateFuncs 自定义端点模板可用的函数
+var templateFuncs = template.FuncMap{
+	// json 编码为 JSON 文本
+	"json": func(v any) string {
+		data, _ := json.Marshal(v)
+		return string(data)
+	},
+	// default 值为空时使用默认值：{{default "未知" .name}}
+	"default": func(def, v any) any {
+		if v == nil || v == "" {
+			return def
+		}
+		return v
+	},
+	// join 以分隔符连接数组：{{join ", " .tags}}
+	"join": func(sep string, v any) string {
+		arr, ok := v.([]any)
+		if !ok {
+			return jsonString(v)
+		}
+		parts := make([]string, 0, len(arr))
+		for _, item := range arr {
+			parts = append(parts, jsonString(item))
+		}
+		return strings.Join(parts, sep)
+	},
+	// 文本函数接受任意值，字段不存在时为空
+	"lower": func(v any) string { return strings.ToLower(jsonString(v)) },
+	"upper": func(v any) string { return strings.ToUpper(jsonString(v)) },
+	"trim":  func(v any) string { return strings.TrimSpace(jsonString(v)) },
+}
+
+// expression 消息字段的提取表达式，JSONPath 或 Go 模板
+type expression struct {
+	path jsonPath
+	tmpl *template.Template
+}
+
+// compileExpression 解析表达式，为空时返回 nil
+func compileExpression(name, expr string) (*expression, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	if isJSONPath(expr) {
+		path, err := compileJSONPath(expr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return &expression{path: path}, nil
+	}
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%s 模板无效: %v", name, err)
+	}
+	return &expression{tmpl: tmpl}, nil
+}
+
+// value 求值，JSONPath 返回原始的 JSON 值，模板返回文本
+func (e *expression) value(data any) any {
+	if e == nil {
+		return nil
+	}
+	if e.tmpl == nil {
+		v, _ := e.path.eval(data)
+		return v
+	}
+	var buf bytes.Buffer
+	if err := e.tmpl.Execute(&buf, data); err != nil {
+		logger.Warn("自定义端点模板执行失败", "template", e.tmpl.Name(), "error", err)
+		return ""
+	}
+	// 请求体中不存在的字段在模板中输出为 <no value>
+	return strings.ReplaceAll(buf.String(), "<no value>", "")
+}
+
+// text 求值并转为文本
+func (e *expression) text(data any) string {
+	return strings.TrimSpace(jsonString(e.value(data)))
+}
+
+// customEndpoint 已解析的自定义端点
+type customEndpoint struct {
+	def      config.CustomWebhookConfig
+	title    *expression
+	content  *expression
+	topic    *expression
+	priority *expression
+	extra    map[string]*expression
+}
+
+func compileCustomEndpoint(def config.CustomWebhookConfig) (*customEndpoint, error) {
+	ep := &customEndpoint{def: def}
+	var err error
+	if ep.title, err = compileExpression("title", def.Title); err != nil {
+		return nil, err
+	}
+	if ep.content, err = compileExpression("content", def.Content); err != nil {
+		return nil, err
+	}
+	if ep.content == nil {
+		return nil, fmt.Errorf("content 不能为空")
+	}
+	if ep.topic, err = compileExpression("topic", def.Topic); err != nil {
+		return nil, err
+	}
+	if ep.priority, err = compileExpression("priority", def.Priority); err != nil {
+		return nil, err
+	}
+	if len(def.Extra) > 0 {
+		ep.extra = make(map[string]*expression, len(def.Extra))
+		for key, expr := range def.Extra {
+			e, err := compileExpression("extra."+key, expr)
+			if err != nil {
+				return nil, err
+			}
+			if e != nil {
+				ep.extra[key] = e
+			}
+		}
+	}
+	return ep, nil
+}
+
+// request 从请求体中提取发布请求
+func (ep *customEndpoint) request(data any) Request {
+	client := ep.def.Client
+	if client == "" {
+		client = ep.def.Name
+	}
+	req := Request{
+		Title:   ep.title.text(data),
+		Content: ep.content.text(data),
+		Topic:   ep.topic.text(data),
+		Client:  client,
+	}
+	if s := ep.priority.text(data); s != "" {
+		if p, err := broker.ParsePriority(s); err != nil {
+			logger.Warn("自定义端点优先级无效，使用默认优先级", "endpoint", ep.def.Name, "priority", s)
+		} else {
+			req.Priority = &p
+		}
+	}
+	if len(ep.extra) > 0 {
+		extra := make(map[string]any, len(ep.extra))
+		for key, e := range ep.extra {
+			if v := e.value(data); v != nil && v != "" {
+				extra[key] = v
+			}
+		}
+		if len(extra) > 0 {
+			req.Extra = extra
+		}
+	}
+	return req
+}
+
+// parseCustomBody 将请求体解析为 JSON，数字保留原始文本；不是 JSON 时为请求体文本
+func parseCustomBody(body []byte) any {
+	dec := json.NewDecoder(bytes.NewReader(fixJSONNewlines(body)))
+	dec.UseNumber()
+	var data any
+	if err := dec.Decode(&data); err != nil || dec.More() {
+		return string(body)
+	}
+	return data
+}
+
+// CustomHandler 配置文件定义的自定义 Webhook 端点，按表达式从任意请求体中提取消息字段
+// 表达式无效或端点名称重复时返回错误
+// POST /webhook/custom/{name}
+func (h *WebhookHandler) CustomHandler() (http.HandlerFunc, error) {
+	endpoints := make(map[string]*customEndpoint, len(h.config.Inbound.Custom))
+	for i, def := range h.config.Inbound.Custom {
+		if def.Name == "" {
+			return nil, fmt.Errorf("自定义端点 #%d 缺少 name", i+1)
+		}
+		if _, ok := endpoints[def.Name]; ok {
+			return nil, fmt.Errorf("自定义端点 %s 重复", def.Name)
+		}
+		ep, err := compileCustomEndpoint(def)
+		if err != nil {
+			return nil, fmt.Errorf("自定义端点 %s: %w", def.Name, err)
+		}
+		endpoints[def.Name] = ep
+	}
+	if len(endpoints) > 0 {
+		logger.Info("自定义 Webhook 端点已加载", "count", len(endpoints))
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		name := r.PathValue("name")
+		ep := endpoints[name]
+		if ep == nil {
+			h.sendError(w, http.StatusNotFound, "自定义端点不存在: "+name)
+			return
+		}
+
+		c := h.tokenCredential()
+		if ep.def.Secret != "" {
+			c = credential{name: "custom/" + name, token: ep.def.Secret, signing: ep.def.Signing}
+		}
+		body, credential, ok := h.inbound(w, r, c)
+		if !ok {
+			return
+		}
+
+		req := ep.request(parseCustomBody(body))
+		if req.Content == "" {
+			logger.Warn("自定义端点提取的内容为空", "endpoint", name, "body", string(body))
+			h.sendError(w, http.StatusBadRequest, "content 为空，请检查端点的 content 表达式")
+			return
+		}
+		h.fitRequest(&req)
+		h.publish(w, ratelimit.GetClientIP(r), credential, req)
+	}, nil
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"notice-server/broker"
+	"notice-server/config"
+)
+
+// customData 按自定义端点的方式解析 JSON 请求体
+func customData(t *testing.T, body string) any {
+	t.Helper()
+	data := parseCustomBody([]byte(body))
+	if _, ok := data.(string); ok {
+		t.Fatalf("请求体应解析为 JSON: %s", body)
+	}
+	return data
+}
+
+func TestJSONPath(t *testing.T) {
+	data := customData(t, `{
+		"alert": {"name": "磁盘", "value": 95, "tags": ["prod", "db"]},
+		"hosts": [{"name": "web1"}, {"name": "web2"}, {"name": "web3"}],
+		"a.b": "dotted",
+		"empty": null
+	}`)
+
+	tests := []struct {
+		expr string
+		want any
+		ok   bool
+	}{
+		{"$", data, true},
+		{"$.alert.name", "磁盘", true},
+		{"$.alert.value", json.Number("95"), true},
+		{"$.alert.tags[0]", "prod", true},
+		{"$.hosts[-1].name", "web3", true},
+		{"$.hosts[*].name", []any{"web1", "web2", "web3"}, true},
+		{"$['a.b']", "dotted", true},
+		{`$["alert"]["name"]`, "磁盘", true},
+		{"$.alert.*", []any{"磁盘", []any{"prod", "db"}, json.Number("95")}, true},
+		{"$.empty", nil, true},
+		{"$.missing", nil, false},
+		{"$.hosts[5].name", nil, false},
+		{"$.hosts[*].missing", []any(nil), false},
+		{"$.alert.name.first", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			path, err := compileJSONPath(tt.expr)
+			if err != nil {
+				t.Fatalf("compileJSONPath() error = %v", err)
+			}
+			got, ok := path.eval(data)
+			if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("eval() = %#v, %v, 期望 %#v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+
+	for _, expr := range []string{"alert", "$.", "$..name", "$[0", "$[x]", "$a"} {
+		if _, err := compileJSONPath(expr); err == nil {
+			t.Errorf("compileJSONPath(%q) 应返回错误", expr)
+		}
+	}
+}
+
+func TestCustomEndpointRequest(t *testing.T) {
+	def := config.CustomWebhookConfig{
+		Name:     "zabbix",
+		Title:    "[{{upper .severity}}] {{.host}}",
+		Content:  "$.message",
+		Topic:    "{{if .team}}ops/{{.team}}{{end}}",
+		Priority: "$.priority",
+		Extra: map[string]string{
+			"value": "$.value",
+			"tags":  "$.tags",
+			"host":  "{{.host}}",
+			"none":  "$.missing",
+		},
+	}
+	ep, err := compileCustomEndpoint(def)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		body  string
+		want  Request
+		extra map[string]any
+	}{
+		{
+			name: "完整字段",
+			body: `{"severity":"high","host":"db1","message":"CPU 95%","team":"dba","priority":"urgent","value":95,"tags":["a","b"]}`,
+			want: Request{Title: "[HIGH] db1", Content: "CPU 95%", Topic: "ops/dba", Client: "zabbix", Priority: priorityOf(broker.PriorityUrgent)},
+			extra: map[string]any{
+				"value": json.Number("95"),
+				"tags":  []any{"a", "b"},
+				"host":  "db1",
+			},
+		},
+		{
+			name:  "缺少的字段为空",
+			body:  `{"message":"恢复"}`,
+			want:  Request{Title: "[]", Content: "恢复", Client: "zabbix"},
+			extra: nil,
+		},
+		{
+			name:  "优先级无效时为默认",
+			body:  `{"host":"db1","message":"x","priority":"extreme"}`,
+			want:  Request{Title: "[] db1", Content: "x", Client: "zabbix"},
+			extra: map[string]any{"host": "db1"},
+		},
+		{
+			name:  "数字优先级",
+			body:  `{"message":"x","priority":5}`,
+			want:  Request{Title: "[]", Content: "x", Client: "zabbix", Priority: priorityOf(broker.PriorityUrgent)},
+			extra: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := ep.request(customData(t, tt.body))
+			var extra map[string]any
+			if req.Extra != nil {
+				extra = req.Extra.(map[string]any)
+			}
+			req.Extra = nil
+			if !reflect.DeepEqual(req, tt.want) {
+				t.Errorf("request() = %+v, 期望 %+v", req, tt.want)
+			}
+			if !reflect.DeepEqual(extra, tt.extra) {
+				t.Errorf("extra = %#v, 期望 %#v", extra, tt.extra)
+			}
+		})
+	}
+}
+
+func TestCustomEndpointText(t *testing.T) {
+	ep, err := compileCustomEndpoint(config.CustomWebhookConfig{
+		Name:    "raw",
+		Client:  "script",
+		Title:   "脚本通知",
+		Content: "{{.}}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 不是 JSON 的请求体作为文本传给模板
+	req := ep.request(parseCustomBody([]byte("备份完成\n")))
+	if req.Title != "脚本通知" || req.Content != "备份完成" || req.Client != "script" {
+		t.Errorf("request() = %+v", req)
+	}
+}
+
+func TestCompileCustomEndpoint(t *testing.T) {
+	tests := []struct {
+		name string
+		def  config.CustomWebhookConfig
+	}{
+		{"缺少内容", config.CustomWebhookConfig{Name: "a", Title: "$.title"}},
+		{"内容为空白", config.CustomWebhookConfig{Name: "a", Content: "  "}},
+		{"JSONPath 无效", config.CustomWebhookConfig{Name: "a", Content: "$.a[x]"}},
+		{"模板无效", config.CustomWebhookConfig{Name: "a", Content: "{{.a"}},
+		{"extra 无效", config.CustomWebhookConfig{Name: "a", Content: "$.a", Extra: map[string]string{"b": "{{end}}"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := compileCustomEndpoint(tt.def); err == nil {
+				t.Error("compileCustomEndpoint() 应返回错误")
+			}
+		})
+	}
+}
+
+func TestTemplateFuncs(t *testing.T) {
+	data := customData(t, `{"tags":["a","b"],"name":"  Web  ","obj":{"k":1},"n":3}`)
+	tests := []struct {
+		tmpl string
+		want string
+	}{
+		{`{{join "|" .tags}}`, "a|b"},
+		{`{{join "|" .name}}`, "  Web  "},
+		{`{{lower .name}}`, "  web  "},
+		{`{{trim .name}}`, "Web"},
+		{`{{upper .missing}}`, ""},
+		{`{{default "无" .missing}}`, "无"},
+		{`{{default "无" .n}}`, "3"},
+		{`{{json .obj}}`, `{"k":1}`},
+		{`{{.missing}}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tmpl, func(t *testing.T) {
+			e, err := compileExpression("t", tt.tmpl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := e.value(data); got != tt.want {
+				t.Errorf("value() = %q, 期望 %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCustomBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want any
+	}{
+		{"对象", `{"a":1}`, map[string]any{"a": json.Number("1")}},
+		{"字符串中的换行", "{\"a\":\"x\ny\"}", map[string]any{"a": "x\ny"}},
+		{"大整数保留原文", `{"id":12345678901234567890}`, map[string]any{"id": json.Number("12345678901234567890")}},
+		{"文本", "hello", "hello"},
+		{"多个 JSON 值", `{"a":1}{"b":2}`, `{"a":1}{"b":2}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseCustomBody([]byte(tt.body)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCustomBody() = %#v, 期望 %#v", got, tt.want)
+			}
+		})
+	}
+}
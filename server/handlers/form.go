@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"notice-server/broker"
+)
+
+// maxFormMemory multipart 表单在内存中保留的最大字节数，超出部分（文件）写入临时文件
+const maxFormMemory = 1 << 20
+
+// requestFields 表单、查询参数和请求头可指定的字段，名称与 JSON 相同
+// text/plain 请求的请求头为 X- 加字段名，下划线换为连字符，如 X-Title、X-Group-Key
+var requestFields = []string{"title", "content", "topic", "priority", "tags", "client", "group_key", "key", "update_id", "send_at", "delay", "extra"}
+
+// parseRequest 按请求方法和 Content-Type 解析请求：
+// GET 读取查询参数；表单（urlencoded / multipart）读取表单字段，未提供的字段取查询参数；
+// text/plain 以请求体为内容，其他字段取 X- 请求头或查询参数；其余按 JSON 解析
+func parseRequest(r *http.Request, body []byte) (Request, error) {
+	if r.Method == http.MethodGet {
+		return valuesRequest(r.URL.Query())
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/x-www-form-urlencoded", "multipart/form-data":
+		// curl -d 默认以表单类型发送，请求体是 JSON 时仍按 JSON 解析
+		if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '{' {
+			break
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		var err error
+		if mediaType == "multipart/form-data" {
+			err = r.ParseMultipartForm(maxFormMemory)
+		} else {
+			err = r.ParseForm()
+		}
+		if err != nil {
+			return Request{}, fmt.Errorf("表单解析失败: %v", err)
+		}
+		if r.MultipartForm != nil {
+			defer r.MultipartForm.RemoveAll()
+		}
+		return valuesRequest(r.Form)
+
+	case "text/plain":
+		values := r.URL.Query()
+		for _, field := range requestFields {
+			if v := headerValue(r, fieldHeader(field)); v != "" {
+				values.Set(field, v)
+			}
+		}
+		values.Set("content", strings.TrimRight(string(body), "\r\n"))
+		return valuesRequest(values)
+	}
+
+	// 预处理：修复 JSON 字符串中的换行符
+	// 将字符串值中的真实换行符转换为 \n 转义序列
+	body = fixJSONNewlines(body)
+
+	var req Request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return Request{}, fmt.Errorf("JSON 解析失败: %v", err)
+	}
+	return req, nil
+}
+
+// valuesRequest 从表单或查询参数构建请求
+// tags 可重复或以逗号分隔；extra 为 JSON 时按 JSON 解析，否则作为字符串
+func valuesRequest(values url.Values) (Request, error) {
+	req := Request{
+		Title:    values.Get("title"),
+		Content:  values.Get("content"),
+		Topic:    values.Get("topic"),
+		Client:   values.Get("client"),
+		GroupKey: values.Get("group_key"),
+		Key:      values.Get("key"),
+	}
+
+	var err error
+	if s := values.Get("priority"); s != "" {
+		p, err := broker.ParsePriority(s)
+		if err != nil {
+			return Request{}, err
+		}
+		req.Priority = &p
+	}
+	for _, v := range values["tags"] {
+		req.Tags = append(req.Tags, strings.Split(v, ",")...)
+	}
+	if s := values.Get("update_id"); s != "" {
+		if req.UpdateID, err = strconv.ParseUint(s, 10, 64); err != nil {
+			return Request{}, fmt.Errorf("update_id 无效: %s", s)
+		}
+	}
+	if s := values.Get("send_at"); s != "" {
+		t, err := parseFlexTime(s)
+		if err != nil {
+			return Request{}, err
+		}
+		req.SendAt = &FlexTime{t}
+	}
+	if s := values.Get("delay"); s != "" {
+		d, err := parseDuration(s)
+		if err != nil {
+			return Request{}, err
+		}
+		req.Delay = &FlexDuration{d}
+	}
+	if s := values.Get("extra"); s != "" {
+		var extra any
+		if err := json.Unmarshal([]byte(s), &extra); err != nil {
+			extra = s
+		}
+		req.Extra = extra
+	}
+	return req, nil
+}
+
+// fieldHeader text/plain 请求中传递字段的请求头名称，如 X-Title、X-Group-Key
+func fieldHeader(field string) string {
+	return "X-" + strings.ReplaceAll(field, "_", "-")
+}
+
+// headerValue 读取请求头，支持 RFC 2047 编码（如 =?UTF-8?B?...?=），以便传递非 ASCII 标题
+func headerValue(r *http.Request, name string) string {
+	v := strings.TrimSpace(r.Header.Get(name))
+	if strings.HasPrefix(v, "=?") {
+		if decoded, err := new(mime.WordDecoder).DecodeHeader(v); err == nil {
+			return decoded
+		}
+	}
+	return v
+}
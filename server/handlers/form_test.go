@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"bytes"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"notice-server/broker"
+)
+
+// multipartBody 构建 multipart 表单请求体，返回请求体和 Content-Type
+func multipartBody(t *testing.T, fields [][2]string) (string, string) {
+	t.Helper()
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for _, f := range fields {
+		if err := w.WriteField(f[0], f[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String(), w.FormDataContentType()
+}
+
+func TestParseRequest(t *testing.T) {
+	multiBody, multiType := multipartBody(t, [][2]string{{"title", "备份"}, {"content", "完成"}, {"extra", `{"size":3}`}})
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		ctype  string
+		header map[string]string
+		body   string
+		want   Request
+	}{
+		{
+			name:   "GET 查询参数",
+			method: "GET",
+			target: "/webhook?title=a&content=b&priority=HIGH&tags=x,y&tags=z&update_id=42&key=k",
+			want:   Request{Title: "a", Content: "b", Priority: priorityOf(broker.PriorityHigh), Tags: []string{"x", "y", "z"}, UpdateID: 42, Key: "k"},
+		},
+		{
+			name:   "表单优先于查询参数",
+			method: "POST",
+			target: "/webhook?topic=ops&title=query",
+			ctype:  "application/x-www-form-urlencoded",
+			body:   "title=form&content=c&group_key=g&priority=5",
+			want:   Request{Title: "form", Content: "c", Topic: "ops", GroupKey: "g", Priority: priorityOf(broker.PriorityUrgent)},
+		},
+		{
+			name:   "表单类型的 JSON 请求体",
+			method: "POST",
+			target: "/webhook",
+			ctype:  "application/x-www-form-urlencoded",
+			body:   ` {"title":"j","content":"c","priority":4}`,
+			want:   Request{Title: "j", Content: "c", Priority: priorityOf(broker.PriorityHigh)},
+		},
+		{
+			name:   "恢复默认优先级",
+			method: "GET",
+			target: "/webhook?content=c&key=k&priority=default",
+			want:   Request{Content: "c", Key: "k", Priority: priorityOf(broker.PriorityDefault)},
+		},
+		{
+			name:   "multipart 表单",
+			method: "POST",
+			target: "/webhook?client=cli",
+			ctype:  multiType,
+			body:   multiBody,
+			want:   Request{Title: "备份", Content: "完成", Client: "cli", Extra: map[string]any{"size": float64(3)}},
+		},
+		{
+			name:   "text/plain 请求头",
+			method: "POST",
+			target: "/webhook?topic=ops&client=query",
+			ctype:  "text/plain; charset=utf-8",
+			header: map[string]string{
+				"X-Title":     mime.BEncoding.Encode("UTF-8", "磁盘告警"),
+				"X-Group-Key": "disk",
+				"X-Client":    "cli",
+				"X-Content":   "被请求体覆盖",
+			},
+			body: "使用率 95%\r\n",
+			want: Request{Title: "磁盘告警", Content: "使用率 95%", Topic: "ops", Client: "cli", GroupKey: "disk"},
+		},
+		{
+			name:   "JSON 字符串中的换行",
+			method: "POST",
+			target: "/webhook",
+			ctype:  "application/json",
+			body:   "{\"title\":\"a\",\"content\":\"x\ny\"}",
+			want:   Request{Title: "a", Content: "x\ny"},
+		},
+		{
+			name:   "未指定类型按 JSON 解析",
+			method: "POST",
+			target: "/webhook",
+			body:   `{"content":"c","tags":["a"]}`,
+			want:   Request{Content: "c", Tags: []string{"a"}},
+		},
+		{
+			name:   "extra 不是 JSON 时为字符串",
+			method: "GET",
+			target: "/webhook?content=c&extra=plain",
+			want:   Request{Content: "c", Extra: "plain"},
+		},
+		{
+			name:   "定时和延迟",
+			method: "GET",
+			target: "/webhook?content=c&send_at=1767225600&delay=2h",
+			want:   Request{Content: "c", SendAt: &FlexTime{time.Unix(1767225600, 0)}, Delay: &FlexDuration{2 * time.Hour}},
+		},
+		{
+			name:   "毫秒时间戳和秒数延迟",
+			method: "GET",
+			target: "/webhook?content=c&send_at=1767225600000&delay=90",
+			want:   Request{Content: "c", SendAt: &FlexTime{time.UnixMilli(1767225600000)}, Delay: &FlexDuration{90 * time.Second}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.ctype != "" {
+				r.Header.Set("Content-Type", tt.ctype)
+			}
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			got, err := parseRequest(r, []byte(tt.body))
+			if err != nil {
+				t.Fatalf("parseRequest() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRequest() = %+v, 期望 %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRequestError(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		target string
+		ctype  string
+		body   string
+		want   string // 错误信息包含的片段
+	}{
+		{"优先级无效", "GET", "/webhook?content=c&priority=extreme", "", "", "priority 无效"},
+		{"update_id 无效", "GET", "/webhook?content=c&update_id=-1", "", "", "update_id 无效"},
+		{"send_at 无效", "GET", "/webhook?content=c&send_at=tomorrow", "", "", "时间格式无效"},
+		{"delay 无效", "GET", "/webhook?content=c&delay=soon", "", "", "soon"},
+		{"表单中的优先级无效", "POST", "/webhook", "application/x-www-form-urlencoded", "content=c&priority=9", "priority 无效"},
+		{"multipart 缺少边界", "POST", "/webhook", "multipart/form-data", "content=c", "表单解析失败"},
+		{"JSON 无效", "POST", "/webhook", "application/json", "{", "JSON 解析失败"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.ctype != "" {
+				r.Header.Set("Content-Type", tt.ctype)
+			}
+			_, err := parseRequest(r, []byte(tt.body))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parseRequest() error = %v, 应包含 %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFieldHeader(t *testing.T) {
+	tests := map[string]string{
+		"title":     "X-Title",
+		"group_key": "X-Group-Key",
+		"update_id": "X-Update-Id",
+	}
+	for field, want := range tests {
+		if got := http.CanonicalHeaderKey(fieldHeader(field)); got != want {
+			t.Errorf("fieldHeader(%q) = %q, 期望 %q", field, got, want)
+		}
+	}
+}
+
+// priorityOf 返回指向优先级的指针，用于构造期望的请求
+func priorityOf(p broker.Priority) *broker.Priority {
+	return &p
+}
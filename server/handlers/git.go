@@ -0,0 +1,623 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"notice-server/broker"
+	"notice-server/config"
+	"notice-server/logger"
+	"notice-server/ratelimit"
+)
+
+// 代码托管平台
+const (
+	platformGitHub = "github"
+	platformGitLab = "gitlab"
+	platformGitea  = "gitea"
+)
+
+// 归一化的事件类型，用于 inbound.<platform>.topics 和 extra.event
+const (
+	gitEventPush        = "push"
+	gitEventPullRequest = "pull_request"
+	gitEventPipeline    = "pipeline"
+	gitEventRelease     = "release"
+	gitEventIssue       = "issue"
+)
+
+// maxPushCommits 推送通知中最多列出的提交数
+const maxPushCommits = 5
+
+// gitEvent 从平台事件转换出的通知
+type gitEvent struct {
+	Event    string
+	Title    string
+	Content  string
+	Priority broker.Priority
+	Extra    map[string]any
+}
+
+// gitUser 平台用户，各平台字段不同，取第一个非空值
+type gitUser struct {
+	Login    string `json:"login"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+}
+
+func (u gitUser) String() string {
+	for _, s := range []string{u.Login, u.Username, u.Name} {
+		if s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// gitRepo 仓库，GitHub / Gitea 为 repository，GitLab 为 project
+type gitRepo struct {
+	FullName          string `json:"full_name"`
+	HTMLURL           string `json:"html_url"`
+	PathWithNamespace string `json:"path_with_namespace"`
+	WebURL            string `json:"web_url"`
+}
+
+func (r gitRepo) name() string {
+	if r.FullName != "" {
+		return r.FullName
+	}
+	return r.PathWithNamespace
+}
+
+func (r gitRepo) url() string {
+	if r.HTMLURL != "" {
+		return r.HTMLURL
+	}
+	return r.WebURL
+}
+
+type gitCommit struct {
+	ID      string `json:"id"`
+	Message string `json:"message"`
+	URL     string `json:"url"`
+	Author  struct {
+		Name string `json:"name"`
+	} `json:"author"`
+}
+
+// hubPayload GitHub 与 Gitea 的事件负载（Gitea 沿用了 GitHub 的格式）
+type hubPayload struct {
+	Action       string      `json:"action"`
+	Ref          string      `json:"ref"`
+	Before       string      `json:"before"`
+	After        string      `json:"after"`
+	Compare      string      `json:"compare"`
+	CompareURL   string      `json:"compare_url"` // Gitea
+	Created      bool        `json:"created"`
+	Deleted      bool        `json:"deleted"`
+	Forced       bool        `json:"forced"`
+	Commits      []gitCommit `json:"commits"`
+	TotalCommits int         `json:"total_commits"` // Gitea
+	Repository   gitRepo     `json:"repository"`
+	Sender       gitUser     `json:"sender"`
+	Pusher       gitUser     `json:"pusher"`
+
+	PullRequest *struct {
+		Number  int     `json:"number"`
+		Title   string  `json:"title"`
+		HTMLURL string  `json:"html_url"`
+		Merged  bool    `json:"merged"`
+		User    gitUser `json:"user"`
+		Head    struct {
+			Ref string `json:"ref"`
+		} `json:"head"`
+		Base struct {
+			Ref string `json:"ref"`
+		} `json:"base"`
+	} `json:"pull_request"`
+
+	Issue *struct {
+		Number  int     `json:"number"`
+		Title   string  `json:"title"`
+		HTMLURL string  `json:"html_url"`
+		User    gitUser `json:"user"`
+	} `json:"issue"`
+
+	Release *struct {
+		TagName    string  `json:"tag_name"`
+		Name       string  `json:"name"`
+		Body       string  `json:"body"`
+		HTMLURL    string  `json:"html_url"`
+		Prerelease bool    `json:"prerelease"`
+		Author     gitUser `json:"author"`
+	} `json:"release"`
+
+	WorkflowRun *struct {
+		Name       string `json:"name"`
+		HeadBranch string `json:"head_branch"`
+		HeadSHA    string `json:"head_sha"`
+		Conclusion string `json:"conclusion"`
+		HTMLURL    string `json:"html_url"`
+		RunNumber  int    `json:"run_number"`
+	} `json:"workflow_run"`
+}
+
+// labPayload GitLab 的事件负载
+type labPayload struct {
+	ObjectKind        string      `json:"object_kind"`
+	Ref               string      `json:"ref"`
+	Before            string      `json:"before"`
+	After             string      `json:"after"`
+	UserName          string      `json:"user_name"`     // Push Hook
+	UserUsername      string      `json:"user_username"` // Push Hook
+	User              gitUser     `json:"user"`
+	Project           gitRepo     `json:"project"`
+	Commits           []gitCommit `json:"commits"`
+	TotalCommitsCount int         `json:"total_commits_count"`
+
+	ObjectAttributes struct {
+		ID           int    `json:"id"`
+		IID          int    `json:"iid"`
+		Title        string `json:"title"`
+		URL          string `json:"url"`
+		Action       string `json:"action"`
+		SourceBranch string `json:"source_branch"`
+		TargetBranch string `json:"target_branch"`
+		Ref          string `json:"ref"`
+		SHA          string `json:"sha"`
+		Status       string `json:"status"`
+	} `json:"object_attributes"`
+
+	// Release Hook 的字段位于顶层
+	Action      string `json:"action"`
+	Tag         string `json:"tag"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	URL         string `json:"url"`
+}
+
+// GitHandler 代码托管平台 Webhook：校验平台签名，将推送、PR/MR、流水线、发布和 Issue 事件转为通知
+// POST /webhook/github、/webhook/gitlab、/webhook/gitea
+func (h *WebhookHandler) GitHandler(platform string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		cfg := h.gitConfig(platform)
+		c := h.tokenCredential()
+		if cfg.Secret != "" {
+			c = credential{
+				name: platform,
+				verify: func(r *http.Request, body []byte) bool {
+					return verifyGitSignature(platform, cfg.Secret, r, body)
+				},
+			}
+		}
+		body, credential, ok := h.inbound(w, r, c)
+		if !ok {
+			return
+		}
+
+		var event *gitEvent
+		var err error
+		switch platform {
+		case platformGitLab:
+			event, err = parseGitLabEvent(r.Header.Get("X-Gitlab-Event"), body)
+		case platformGitea:
+			event, err = parseHubEvent(platform, r.Header.Get("X-Gitea-Event"), body)
+		default:
+			kind := r.Header.Get("X-GitHub-Event")
+			if kind == "ping" {
+				h.sendSuccess(w, "pong", h.broker.ClientCount())
+				return
+			}
+			event, err = parseHubEvent(platform, kind, body)
+		}
+		if err != nil {
+			logger.Warn("平台事件解析失败", "platform", platform, "error", err)
+			h.sendError(w, http.StatusBadRequest, "JSON 解析失败: "+err.Error())
+			return
+		}
+		if event == nil {
+			logger.Debug("平台事件已忽略", "platform", platform)
+			h.sendSuccess(w, "事件已忽略", 0)
+			return
+		}
+
+		topic := cfg.Topics[event.Event]
+		if topic == "" {
+			topic = cfg.Topic
+		}
+		req := Request{
+			Title:    event.Title,
+			Content:  event.Content,
+			Topic:    topic,
+			Extra:    event.Extra,
+			Client:   platform,
+			Priority: &event.Priority,
+		}
+		h.fitRequest(&req)
+		h.publish(w, ratelimit.GetClientIP(r), credential, req)
+	}
+}
+
+// gitConfig 返回平台的接入配置
+func (h *WebhookHandler) gitConfig(platform string) config.GitWebhookConfig {
+	switch platform {
+	case platformGitLab:
+		return h.config.Inbound.GitLab
+	case platformGitea:
+		return h.config.Inbound.Gitea
+	default:
+		return h.config.Inbound.GitHub
+	}
+}
+
+// verifyGitSignature 校验平台签名：GitHub 为 X-Hub-Signature-256，Gitea 为 X-Gitea-Signature，
+// GitLab 不签名，X-Gitlab-Token 即配置的 secret
+func verifyGitSignature(platform, secret string, r *http.Request, body []byte) bool {
+	switch platform {
+	case platformGitLab:
+		return config.TokenEqual(r.Header.Get("X-Gitlab-Token"), secret)
+	case platformGitea:
+		sig := r.Header.Get("X-Gitea-Signature")
+		if sig == "" {
+			sig = r.Header.Get("X-Hub-Signature-256")
+		}
+		return verifyHMAC(secret, body, sig)
+	default:
+		return verifyHMAC(secret, body, r.Header.Get("X-Hub-Signature-256"))
+	}
+}
+
+// verifyHMAC 以常量时间校验请求体的 HMAC-SHA256 签名（十六进制，可带 sha256= 前缀）
+func verifyHMAC(secret string, body []byte, signature string) bool {
+	want, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(signature), "sha256="))
+	if err != nil || len(want) == 0 {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), want)
+}
+
+// parseHubEvent 转换 GitHub / Gitea 事件，不关心的事件返回 nil
+func parseHubEvent(platform, kind string, body []byte) (*gitEvent, error) {
+	var p hubPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, err
+	}
+	repo := p.Repository.name()
+
+	switch kind {
+	case "push":
+		compare := p.Compare
+		if compare == "" {
+			compare = p.CompareURL
+		}
+		pusher := p.Pusher.String()
+		if pusher == "" {
+			pusher = p.Sender.String()
+		}
+		e := pushEvent(platform, repo, p.Ref, p.Before, p.After, pusher, p.Created, p.Deleted,
+			p.Commits, max(p.TotalCommits, len(p.Commits)))
+		e.Extra["url"] = firstNonEmpty(compare, p.Repository.url())
+		e.Extra["forced"] = p.Forced
+		return e, nil
+
+	case "pull_request":
+		pr := p.PullRequest
+		if pr == nil {
+			return nil, nil
+		}
+		action := p.Action
+		if action == "closed" && pr.Merged {
+			action = "merged"
+		}
+		if !changeActions[action] {
+			return nil, nil
+		}
+		number := pr.Number
+		e := newGitEvent(platform, gitEventPullRequest, action, repo, pr.HTMLURL, p.Sender.String())
+		e.Title = fmt.Sprintf("[%s] PR #%d %s", repo, number, actionLabel(action))
+		e.Content = joinLines(pr.Title, fmt.Sprintf("%s → %s · %s", pr.Head.Ref, pr.Base.Ref, p.Sender), pr.HTMLURL)
+		e.Extra["number"] = number
+		e.Extra["title"] = pr.Title
+		e.Extra["source_branch"] = pr.Head.Ref
+		e.Extra["target_branch"] = pr.Base.Ref
+		e.Extra["author"] = pr.User.String()
+		return e, nil
+
+	case "workflow_run":
+		run := p.WorkflowRun
+		if run == nil || p.Action != "completed" {
+			return nil, nil
+		}
+		e := pipelineEvent(platform, repo, run.HTMLURL, p.Sender.String(), run.Name, run.HeadBranch, run.HeadSHA, run.Conclusion)
+		e.Extra["run_number"] = run.RunNumber
+		e.Content = joinLines(e.Content, run.HTMLURL)
+		return e, nil
+
+	case "release":
+		rel := p.Release
+		if rel == nil || p.Action != "published" {
+			return nil, nil
+		}
+		e := releaseEvent(platform, repo, rel.HTMLURL, p.Sender.String(), rel.TagName, rel.Name, rel.Body, rel.Prerelease)
+		return e, nil
+
+	case "issues":
+		issue := p.Issue
+		if issue == nil || !changeActions[p.Action] || p.Action == "merged" {
+			return nil, nil
+		}
+		e := newGitEvent(platform, gitEventIssue, p.Action, repo, issue.HTMLURL, p.Sender.String())
+		e.Title = fmt.Sprintf("[%s] Issue #%d %s", repo, issue.Number, actionLabel(p.Action))
+		e.Content = joinLines(issue.Title, p.Sender.String(), issue.HTMLURL)
+		e.Extra["number"] = issue.Number
+		e.Extra["title"] = issue.Title
+		e.Extra["author"] = issue.User.String()
+		return e, nil
+	}
+	return nil, nil
+}
+
+// parseGitLabEvent 转换 GitLab 事件，不关心的事件返回 nil
+func parseGitLabEvent(kind string, body []byte) (*gitEvent, error) {
+	var p labPayload
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, err
+	}
+	repo := p.Project.name()
+	attrs := p.ObjectAttributes
+	user := p.User.String()
+
+	switch kind {
+	case "Push Hook", "Tag Push Hook":
+		pusher := firstNonEmpty(p.UserUsername, p.UserName)
+		e := pushEvent(platformGitLab, repo, p.Ref, p.Before, p.After, pusher, false, false,
+			p.Commits, max(p.TotalCommitsCount, len(p.Commits)))
+		e.Extra["url"] = p.Project.url()
+		return e, nil
+
+	case "Merge Request Hook":
+		action := labActions[attrs.Action]
+		if !changeActions[action] {
+			return nil, nil
+		}
+		e := newGitEvent(platformGitLab, gitEventPullRequest, action, repo, attrs.URL, user)
+		e.Title = fmt.Sprintf("[%s] MR !%d %s", repo, attrs.IID, actionLabel(action))
+		e.Content = joinLines(attrs.Title, fmt.Sprintf("%s → %s · %s", attrs.SourceBranch, attrs.TargetBranch, user), attrs.URL)
+		e.Extra["number"] = attrs.IID
+		e.Extra["title"] = attrs.Title
+		e.Extra["source_branch"] = attrs.SourceBranch
+		e.Extra["target_branch"] = attrs.TargetBranch
+		return e, nil
+
+	case "Pipeline Hook":
+		// 只通知结束的流水线
+		status := attrs.Status
+		switch status {
+		case "success":
+		case "failed":
+			status = "failure"
+		case "canceled":
+			status = "cancelled"
+		default:
+			return nil, nil
+		}
+		url := attrs.URL
+		if url == "" && p.Project.url() != "" {
+			url = p.Project.url() + "/-/pipelines/" + strconv.Itoa(attrs.ID)
+		}
+		e := pipelineEvent(platformGitLab, repo, url, user, "Pipeline #"+strconv.Itoa(attrs.ID), attrs.Ref, attrs.SHA, status)
+		e.Extra["pipeline_id"] = attrs.ID
+		e.Content = joinLines(e.Content, url)
+		return e, nil
+
+	case "Release Hook":
+		if p.Action != "create" {
+			return nil, nil
+		}
+		return releaseEvent(platformGitLab, repo, p.URL, user, p.Tag, p.Name, p.Description, false), nil
+
+	case "Issue Hook":
+		action := labActions[attrs.Action]
+		if !changeActions[action] || action == "merged" {
+			return nil, nil
+		}
+		e := newGitEvent(platformGitLab, gitEventIssue, action, repo, attrs.URL, user)
+		e.Title = fmt.Sprintf("[%s] Issue #%d %s", repo, attrs.IID, actionLabel(action))
+		e.Content = joinLines(attrs.Title, user, attrs.URL)
+		e.Extra["number"] = attrs.IID
+		e.Extra["title"] = attrs.Title
+		return e, nil
+	}
+	return nil, nil
+}
+
+// labActions GitLab 的动作名转为与 GitHub 一致的名称
+var labActions = map[string]string{
+	"open":   "opened",
+	"close":  "closed",
+	"reopen": "reopened",
+	"merge":  "merged",
+}
+
+// changeActions 需要通知的 PR/MR 和 Issue 动作，其余（编辑、指派、标签等）忽略
+var changeActions = map[string]bool{
+	"opened":           true,
+	"closed":           true,
+	"reopened":         true,
+	"merged":           true,
+	"ready_for_review": true,
+}
+
+func actionLabel(action string) string {
+	switch action {
+	case "opened":
+		return "已创建"
+	case "closed":
+		return "已关闭"
+	case "reopened":
+		return "已重新打开"
+	case "merged":
+		return "已合并"
+	case "ready_for_review":
+		return "待评审"
+	}
+	return action
+}
+
+// newGitEvent 创建事件并填充 extra 的公共字段
+func newGitEvent(platform, event, action, repo, url, sender string) *gitEvent {
+	return &gitEvent{
+		Event: event,
+		Extra: map[string]any{
+			"source":     platform,
+			"event":      event,
+			"action":     action,
+			"repository": repo,
+			"url":        url,
+			"sender":     sender,
+		},
+	}
+}
+
+// pushEvent 转换推送事件，包括分支和标签的创建、删除
+func pushEvent(platform, repo, ref, before, after, pusher string, created, deleted bool, commits []gitCommit, total int) *gitEvent {
+	created = created || isZeroSHA(before)
+	deleted = deleted || isZeroSHA(after)
+
+	kind, name := "branch", strings.TrimPrefix(ref, "refs/heads/")
+	kindLabel := "分支"
+	if tag, ok := strings.CutPrefix(ref, "refs/tags/"); ok {
+		kind, name, kindLabel = "tag", tag, "标签"
+	}
+
+	action := "pushed"
+	e := newGitEvent(platform, gitEventPush, action, repo, "", pusher)
+	switch {
+	case deleted:
+		action = "deleted"
+		e.Title = fmt.Sprintf("[%s] 删除%s %s", repo, kindLabel, name)
+		e.Content = fmt.Sprintf("%s 删除了%s %s", pusher, kindLabel, name)
+	case kind == "tag":
+		action = "created"
+		e.Title = fmt.Sprintf("[%s] 新标签 %s", repo, name)
+		e.Content = fmt.Sprintf("%s 推送了标签 %s", pusher, name)
+	case total == 0:
+		if created {
+			action = "created"
+			e.Title = fmt.Sprintf("[%s] 新建分支 %s", repo, name)
+		} else {
+			e.Title = fmt.Sprintf("[%s] 推送到 %s", repo, name)
+		}
+		e.Content = fmt.Sprintf("%s 推送到 %s", pusher, name)
+	default:
+		e.Title = fmt.Sprintf("[%s] %s 推送了 %d 个提交", repo, name, total)
+		e.Content = commitLines(commits, total)
+	}
+
+	e.Extra["action"] = action
+	e.Extra["ref"] = ref
+	e.Extra["ref_type"] = kind
+	e.Extra[kind] = name
+	e.Extra["before"] = before
+	e.Extra["after"] = after
+	e.Extra["commits"] = total
+	return e
+}
+
+// commitLines 每个提交一行：短 SHA、提交信息首行和作者，最多 maxPushCommits 行
+func commitLines(commits []gitCommit, total int) string {
+	var lines []string
+	for i, c := range commits {
+		if i == maxPushCommits {
+			break
+		}
+		msg, _, _ := strings.Cut(strings.TrimSpace(c.Message), "\n")
+		lines = append(lines, fmt.Sprintf("%s %s - %s", shortSHA(c.ID), msg, c.Author.Name))
+	}
+	if rest := total - len(lines); rest > 0 {
+		lines = append(lines, fmt.Sprintf("… 另有 %d 个提交", rest))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// pipelineEvent 转换结束的流水线，status 为 success / failure / cancelled 等，失败时为高优先级
+func pipelineEvent(platform, repo, url, sender, name, ref, sha, status string) *gitEvent {
+	e := newGitEvent(platform, gitEventPipeline, status, repo, url, sender)
+	label := status
+	switch status {
+	case "success":
+		label = "成功"
+	case "failure", "timed_out", "startup_failure":
+		label = "失败"
+		e.Priority = broker.PriorityHigh
+	case "cancelled":
+		label = "已取消"
+		e.Priority = broker.PriorityLow
+	}
+	e.Title = fmt.Sprintf("[%s] %s %s", repo, name, label)
+	e.Content = fmt.Sprintf("分支 %s · 提交 %s", ref, shortSHA(sha))
+	e.Extra["name"] = name
+	e.Extra["status"] = status
+	e.Extra["branch"] = ref
+	e.Extra["sha"] = sha
+	return e
+}
+
+// releaseEvent 转换发布事件
+func releaseEvent(platform, repo, url, sender, tag, name, notes string, prerelease bool) *gitEvent {
+	e := newGitEvent(platform, gitEventRelease, "published", repo, url, sender)
+	kind := "发布"
+	if prerelease {
+		kind = "预发布"
+	}
+	e.Title = fmt.Sprintf("[%s] %s %s", repo, kind, tag)
+	if name == tag {
+		name = ""
+	}
+	e.Content = joinLines(name, strings.TrimSpace(notes), url)
+	if e.Content == "" {
+		e.Content = fmt.Sprintf("%s %s了 %s", sender, kind, tag)
+	}
+	e.Extra["tag"] = tag
+	e.Extra["name"] = name
+	e.Extra["prerelease"] = prerelease
+	return e
+}
+
+func isZeroSHA(sha string) bool {
+	return sha != "" && strings.Trim(sha, "0") == ""
+}
+
+func shortSHA(sha string) string {
+	return sha[:min(len(sha), 7)]
+}
+
+func firstNonEmpty(list ...string) string {
+	for _, s := range list {
+		if s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// joinLines 以换行连接非空的行
+func joinLines(lines ...string) string {
+	var out []string
+	for _, s := range lines {
+		if s != "" {
+			out = append(out, s)
+		}
+	}
+	return strings.Join(out, "\n")
+}
@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"notice-server/broker"
+)
+
+// gitCase 事件转换的期望结果，extra 只检查列出的字段
+type gitCase struct {
+	name     string
+	kind     string
+	body     string
+	ignored  bool
+	title    string
+	content  string // 内容包含的片段
+	priority broker.Priority
+	extra    map[string]any
+}
+
+func checkGitEvent(t *testing.T, tt gitCase, e *gitEvent, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if tt.ignored {
+		if e != nil {
+			t.Fatalf("事件应被忽略，实际: %+v", e)
+		}
+		return
+	}
+	if e == nil {
+		t.Fatal("事件不应被忽略")
+	}
+	if e.Title != tt.title {
+		t.Errorf("标题 = %q, 期望 %q", e.Title, tt.title)
+	}
+	if !strings.Contains(e.Content, tt.content) {
+		t.Errorf("内容 = %q, 应包含 %q", e.Content, tt.content)
+	}
+	if e.Priority != tt.priority {
+		t.Errorf("优先级 = %q, 期望 %q", e.Priority, tt.priority)
+	}
+	for k, want := range tt.extra {
+		if got := e.Extra[k]; got != want {
+			t.Errorf("extra.%s = %v, 期望 %v", k, got, want)
+		}
+	}
+}
+
+func TestParseHubEvent(t *testing.T) {
+	const zero = "0000000000000000000000000000000000000000"
+	tests := []gitCase{
+		{
+			name: "推送提交",
+			kind: "push",
+			body: `{"ref":"refs/heads/main","before":"aaa","after":"bbbbbbbbbb","compare":"https://github.com/o/r/compare/a...b",
+				"repository":{"full_name":"o/r"},"pusher":{"name":"alice"},
+				"commits":[{"id":"1234567890","message":"fix: bug\n\ndetails","author":{"name":"alice"}}]}`,
+			title:   "[o/r] main 推送了 1 个提交",
+			content: "1234567 fix: bug - alice",
+			extra:   map[string]any{"event": "push", "action": "pushed", "branch": "main", "commits": 1, "url": "https://github.com/o/r/compare/a...b", "sender": "alice"},
+		},
+		{
+			name:    "新建分支",
+			kind:    "push",
+			body:    `{"ref":"refs/heads/dev","before":"` + zero + `","after":"bbb","repository":{"full_name":"o/r"},"sender":{"login":"bob"}}`,
+			title:   "[o/r] 新建分支 dev",
+			content: "bob 推送到 dev",
+			extra:   map[string]any{"action": "created", "ref_type": "branch"},
+		},
+		{
+			name:    "删除标签",
+			kind:    "push",
+			body:    `{"ref":"refs/tags/v1","before":"aaa","after":"` + zero + `","deleted":true,"repository":{"full_name":"o/r"},"pusher":{"name":"bob"}}`,
+			title:   "[o/r] 删除标签 v1",
+			content: "bob 删除了标签 v1",
+			extra:   map[string]any{"action": "deleted", "ref_type": "tag", "tag": "v1"},
+		},
+		{
+			name: "Gitea 推送提交数",
+			kind: "push",
+			body: `{"ref":"refs/heads/main","before":"a","after":"b","compare_url":"https://gitea/o/r/compare","total_commits":7,
+				"repository":{"full_name":"o/r"},"pusher":{"username":"carol"},
+				"commits":[{"id":"1","message":"a"},{"id":"2","message":"b"},{"id":"3","message":"c"},{"id":"4","message":"d"},{"id":"5","message":"e"},{"id":"6","message":"f"}]}`,
+			title:   "[o/r] main 推送了 7 个提交",
+			content: "… 另有 2 个提交",
+			extra:   map[string]any{"commits": 7, "url": "https://gitea/o/r/compare"},
+		},
+		{
+			name: "PR 合并",
+			kind: "pull_request",
+			body: `{"action":"closed","repository":{"full_name":"o/r"},"sender":{"login":"bob"},
+				"pull_request":{"number":42,"title":"新功能","html_url":"https://github.com/o/r/pull/42","merged":true,
+				"user":{"login":"alice"},"head":{"ref":"feat"},"base":{"ref":"main"}}}`,
+			title:   "[o/r] PR #42 已合并",
+			content: "feat → main · bob",
+			extra:   map[string]any{"event": "pull_request", "action": "merged", "number": 42, "author": "alice"},
+		},
+		{
+			name:    "PR 编辑忽略",
+			kind:    "pull_request",
+			body:    `{"action":"edited","repository":{"full_name":"o/r"},"pull_request":{"number":1}}`,
+			ignored: true,
+		},
+		{
+			name: "工作流失败",
+			kind: "workflow_run",
+			body: `{"action":"completed","repository":{"full_name":"o/r"},"sender":{"login":"ci"},
+				"workflow_run":{"name":"CI","head_branch":"main","head_sha":"abcdef123456","conclusion":"failure","html_url":"https://github.com/o/r/actions/runs/1","run_number":9}}`,
+			title:    "[o/r] CI 失败",
+			content:  "分支 main · 提交 abcdef1",
+			priority: broker.PriorityHigh,
+			extra:    map[string]any{"event": "pipeline", "status": "failure", "run_number": 9},
+		},
+		{
+			name:    "工作流进行中忽略",
+			kind:    "workflow_run",
+			body:    `{"action":"requested","workflow_run":{"name":"CI"}}`,
+			ignored: true,
+		},
+		{
+			name: "预发布",
+			kind: "release",
+			body: `{"action":"published","repository":{"full_name":"o/r"},"sender":{"login":"alice"},
+				"release":{"tag_name":"v2.0.0-rc1","name":"v2.0.0-rc1","body":"变更说明","html_url":"https://github.com/o/r/releases/1","prerelease":true}}`,
+			title:   "[o/r] 预发布 v2.0.0-rc1",
+			content: "变更说明",
+			extra:   map[string]any{"event": "release", "tag": "v2.0.0-rc1", "name": "", "prerelease": true},
+		},
+		{
+			name: "Issue 创建",
+			kind: "issues",
+			body: `{"action":"opened","repository":{"full_name":"o/r"},"sender":{"login":"alice"},
+				"issue":{"number":7,"title":"崩溃","html_url":"https://github.com/o/r/issues/7","user":{"login":"alice"}}}`,
+			title:   "[o/r] Issue #7 已创建",
+			content: "崩溃",
+			extra:   map[string]any{"event": "issue", "number": 7},
+		},
+		{
+			name:    "不关心的事件",
+			kind:    "star",
+			body:    `{"action":"created"}`,
+			ignored: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := parseHubEvent(platformGitHub, tt.kind, []byte(tt.body))
+			checkGitEvent(t, tt, e, err)
+		})
+	}
+
+	if _, err := parseHubEvent(platformGitHub, "push", []byte("{")); err == nil {
+		t.Error("无效 JSON 应返回错误")
+	}
+}
+
+func TestParseGitLabEvent(t *testing.T) {
+	tests := []gitCase{
+		{
+			name: "推送",
+			kind: "Push Hook",
+			body: `{"object_kind":"push","ref":"refs/heads/main","before":"a","after":"b","user_username":"alice","total_commits_count":1,
+				"project":{"path_with_namespace":"g/p","web_url":"https://gitlab/g/p"},
+				"commits":[{"id":"abcdef123","message":"init","author":{"name":"alice"}}]}`,
+			title:   "[g/p] main 推送了 1 个提交",
+			content: "abcdef1 init - alice",
+			extra:   map[string]any{"source": "gitlab", "sender": "alice", "url": "https://gitlab/g/p"},
+		},
+		{
+			name:    "标签推送",
+			kind:    "Tag Push Hook",
+			body:    `{"ref":"refs/tags/v1","before":"0000000000000000000000000000000000000000","after":"b","user_name":"Alice","project":{"path_with_namespace":"g/p"}}`,
+			title:   "[g/p] 新标签 v1",
+			content: "Alice 推送了标签 v1",
+			extra:   map[string]any{"ref_type": "tag", "action": "created"},
+		},
+		{
+			name: "MR 合并",
+			kind: "Merge Request Hook",
+			body: `{"user":{"username":"bob"},"project":{"path_with_namespace":"g/p"},
+				"object_attributes":{"iid":3,"title":"重构","url":"https://gitlab/g/p/-/merge_requests/3","action":"merge","source_branch":"dev","target_branch":"main"}}`,
+			title:   "[g/p] MR !3 已合并",
+			content: "dev → main · bob",
+			extra:   map[string]any{"event": "pull_request", "action": "merged", "number": 3},
+		},
+		{
+			name:    "MR 更新忽略",
+			kind:    "Merge Request Hook",
+			body:    `{"object_attributes":{"action":"update"}}`,
+			ignored: true,
+		},
+		{
+			name: "流水线取消",
+			kind: "Pipeline Hook",
+			body: `{"user":{"username":"bob"},"project":{"path_with_namespace":"g/p","web_url":"https://gitlab/g/p"},
+				"object_attributes":{"id":88,"ref":"main","sha":"1234567890","status":"canceled"}}`,
+			title:    "[g/p] Pipeline #88 已取消",
+			content:  "https://gitlab/g/p/-/pipelines/88",
+			priority: broker.PriorityLow,
+			extra:    map[string]any{"status": "cancelled", "pipeline_id": 88},
+		},
+		{
+			name:    "流水线运行中忽略",
+			kind:    "Pipeline Hook",
+			body:    `{"object_attributes":{"id":1,"status":"running"}}`,
+			ignored: true,
+		},
+		{
+			name:    "发布",
+			kind:    "Release Hook",
+			body:    `{"action":"create","tag":"v1.0","name":"首个版本","description":"","url":"https://gitlab/g/p/-/releases/v1.0","project":{"path_with_namespace":"g/p"}}`,
+			title:   "[g/p] 发布 v1.0",
+			content: "首个版本",
+			extra:   map[string]any{"event": "release", "tag": "v1.0"},
+		},
+		{
+			name:    "Issue 合并动作忽略",
+			kind:    "Issue Hook",
+			body:    `{"object_attributes":{"iid":1,"action":"merge"}}`,
+			ignored: true,
+		},
+		{
+			name:    "Issue 关闭",
+			kind:    "Issue Hook",
+			body:    `{"user":{"name":"Bob"},"project":{"path_with_namespace":"g/p"},"object_attributes":{"iid":5,"title":"问题","action":"close"}}`,
+			title:   "[g/p] Issue #5 已关闭",
+			content: "问题",
+			extra:   map[string]any{"event": "issue", "action": "closed"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := parseGitLabEvent(tt.kind, []byte(tt.body))
+			checkGitEvent(t, tt, e, err)
+		})
+	}
+}
+
+func TestVerifyGitSignature(t *testing.T) {
+	body := []byte(`{"ref":"refs/heads/main"}`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	sig := hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name     string
+		platform string
+		header   string
+		value    string
+		want     bool
+	}{
+		{"GitHub", platformGitHub, "X-Hub-Signature-256", "sha256=" + sig, true},
+		{"GitHub 签名错误", platformGitHub, "X-Hub-Signature-256", "sha256=" + strings.Repeat("0", 64), false},
+		{"GitHub 缺少签名", platformGitHub, "X-Other", sig, false},
+		{"Gitea", platformGitea, "X-Gitea-Signature", sig, true},
+		{"Gitea 兼容 GitHub 头", platformGitea, "X-Hub-Signature-256", "sha256=" + sig, true},
+		{"GitLab", platformGitLab, "X-Gitlab-Token", "secret", true},
+		{"GitLab Token 错误", platformGitLab, "X-Gitlab-Token", "nope", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/webhook/"+tt.platform, nil)
+			r.Header.Set(tt.header, tt.value)
+			if got := verifyGitSignature(tt.platform, "secret", r, body); got != tt.want {
+				t.Errorf("verifyGitSignature() = %v, 期望 %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// jsonPath 已解析的 JSONPath，支持 $、.key、['key']、[n]（负数从末尾计）和 [*]
+type jsonPath []pathStep
+
+type pathStep struct {
+	key   string
+	index int
+	kind  int // stepKey / stepIndex / stepAll
+}
+
+const (
+	stepKey = iota
+	stepIndex
+	stepAll
+)
+
+// isJSONPath 表达式是否为 JSONPath（以 $ 开头）
+func isJSONPath(expr string) bool {
+	expr = strings.TrimSpace(expr)
+	return expr == "$" || strings.HasPrefix(expr, "$.") || strings.HasPrefix(expr, "$[")
+}
+
+// compileJSONPath 解析 JSONPath 表达式
+func compileJSONPath(expr string) (jsonPath, error) {
+	expr = strings.TrimSpace(expr)
+	rest, ok := strings.CutPrefix(expr, "$")
+	if !ok {
+		return nil, fmt.Errorf("JSONPath 必须以 $ 开头: %s", expr)
+	}
+
+	var path jsonPath
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			key := rest[:end]
+			if key == "" {
+				return nil, fmt.Errorf("JSONPath 字段名为空: %s", expr)
+			}
+			if key == "*" {
+				path = append(path, pathStep{kind: stepAll})
+			} else {
+				path = append(path, pathStep{kind: stepKey, key: key})
+			}
+			rest = rest[end:]
+
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("JSONPath 缺少 ]: %s", expr)
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			switch {
+			case inner == "*":
+				path = append(path, pathStep{kind: stepAll})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				path = append(path, pathStep{kind: stepKey, key: inner[1 : len(inner)-1]})
+			default:
+				n, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("JSONPath 下标无效: %s", expr)
+				}
+				path = append(path, pathStep{kind: stepIndex, index: n})
+			}
+
+		default:
+			return nil, fmt.Errorf("JSONPath 语法无效: %s", expr)
+		}
+	}
+	return path, nil
+}
+
+// eval 在 JSON 值上求值，路径含 [*] 时返回所有匹配值组成的数组，没有匹配时返回 false
+func (p jsonPath) eval(v any) (any, bool) {
+	values := []any{v}
+	multi := false
+	for _, step := range p {
+		var next []any
+		for _, v := range values {
+			switch step.kind {
+			case stepKey:
+				if obj, ok := v.(map[string]any); ok {
+					if child, ok := obj[step.key]; ok {
+						next = append(next, child)
+					}
+				}
+			case stepIndex:
+				if arr, ok := v.([]any); ok {
+					i := step.index
+					if i < 0 {
+						i += len(arr)
+					}
+					if i >= 0 && i < len(arr) {
+						next = append(next, arr[i])
+					}
+				}
+			case stepAll:
+				multi = true
+				switch v := v.(type) {
+				case []any:
+					next = append(next, v...)
+				case map[string]any:
+					// 按键名排序，结果稳定
+					for _, key := range slices.Sorted(maps.Keys(v)) {
+						next = append(next, v[key])
+					}
+				}
+			}
+		}
+		values = next
+	}
+	if multi {
+		return values, len(values) > 0
+	}
+	if len(values) == 0 {
+		return nil, false
+	}
+	return values[0], true
+}
+
+// jsonString 将 JSON 值转为文本：字符串原样返回，数组各元素以逗号连接，对象编码为 JSON
+func jsonString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, jsonString(item))
+		}
+		return strings.Join(parts, ", ")
+	case map[string]any:
+		data, _ := json.Marshal(v)
+		return string(data)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"notice-server/broker"
+	"notice-server/config"
+	"notice-server/store"
+)
+
+// RecurringRequest 创建或更新周期消息的请求体
+type RecurringRequest struct {
+	Name     string `json:"name"`
+	Cron     string `json:"cron"`
+	Timezone string `json:"timezone"`
+	Topic    string `json:"topic"`
+	Title    string `json:"title"`
+	Content  string `json:"content"`
+	Extra    any    `json:"extra"`
+	Priority string `json:"priority"`
+	CatchUp  bool   `json:"catch_up"`
+}
+
+// RecurringHandler 列出所有周期消息
+// GET /recurring
+func RecurringHandler(b *broker.Broker, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if !isAuthorized(ExtractToken(r), cfg) {
+			writeJSON(w, http.StatusUnauthorized, map[string]any{
+				"success": false,
+				"message": "认证失败",
+			})
+			return
+		}
+
+		list, err := b.Recurring()
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]any{
+				"success": false,
+				"message": "查询失败: " + err.Error(),
+			})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"success": true,
+			"data": map[string]any{
+				"recurring": list,
+				"total":     len(list),
+			},
+		})
+	}
+}
+
+// SaveRecurringHandler 按名称创建或更新周期消息
+// POST /recurring
+func SaveRecurringHandler(b *broker.Broker, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if !isAuthorized(ExtractToken(r), cfg) {
+			writeJSON(w, http.StatusUnauthorized, map[string]any{
+				"success": false,
+				"message": "认证失败",
+			})
+			return
+		}
+
+		var req RecurringRequest
+		if cfg.Message.MaxPayloadBytes > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, int64(cfg.Message.MaxPayloadBytes))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{
+				"success": false,
+				"message": "无效的 JSON 格式",
+			})
+			return
+		}
+
+		topic := ""
+		if req.Topic != "" {
+			topic = topicForPublish(req.Topic)
+		}
+		info, err := b.SaveRecurring(store.Recurring{
+			Name:     req.Name,
+			Cron:     req.Cron,
+			Timezone: req.Timezone,
+			Topic:    topic,
+			Title:    req.Title,
+			Content:  req.Content,
+			Extra:    req.Extra,
+			Priority: req.Priority,
+			CatchUp:  req.CatchUp,
+		})
+		if err != nil {
+			status := http.StatusInternalServerError
+			switch {
+			case errors.Is(err, broker.ErrInvalidRecurring):
+				status = http.StatusBadRequest
+			case errors.Is(err, broker.ErrRecurringReadOnly):
+				status = http.StatusConflict
+			case errors.Is(err, broker.ErrSchedulerDisabled):
+				status = http.StatusServiceUnavailable
+			}
+			writeJSON(w, status, map[string]any{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"success": true,
+			"message": "周期消息已保存",
+			"data":    info,
+		})
+	}
+}
+
+// DeleteRecurringHandler 删除周期消息
+// DELETE /recurring/{name}
+func DeleteRecurringHandler(b *broker.Broker, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if !isAuthorized(ExtractToken(r), cfg) {
+			writeJSON(w, http.StatusUnauthorized, map[string]any{
+				"success": false,
+				"message": "认证失败",
+			})
+			return
+		}
+
+		if err := b.DeleteRecurring(r.PathValue("name")); err != nil {
+			status := http.StatusInternalServerError
+			message := err.Error()
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				status = http.StatusNotFound
+				message = "周期消息不存在"
+			case errors.Is(err, broker.ErrRecurringReadOnly):
+				status = http.StatusConflict
+			}
+			writeJSON(w, status, map[string]any{
+				"success": false,
+				"message": message,
+			})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"success": true,
+			"message": "周期消息已删除",
+		})
+	}
+}
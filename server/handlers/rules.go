@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"notice-server/broker"
+	"notice-server/config"
+	"notice-server/ratelimit"
+)
+
+// RulesTestRequest 路由规则测试的请求体
+type RulesTestRequest struct {
+	Title    string          `json:"title"`
+	Content  string          `json:"content"`
+	Topic    string          `json:"topic"`
+	Extra    any             `json:"extra"`
+	Client   string          `json:"client"`
+	Priority broker.Priority `json:"priority"`
+	Tags     []string        `json:"tags"`
+
+	IP         string `json:"ip"`         // 模拟的来源 IP，默认为本次请求的来源
+	Credential string `json:"credential"` // 模拟的凭据名称，默认 token
+}
+
+// RulesTestHandler 路由规则试运行：返回消息命中的规则和路由结果，不发布消息（需要管理员 Token）
+// POST /rules/test
+func RulesTestHandler(b *broker.Broker, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !requireAdmin(w, r, cfg) {
+			return
+		}
+
+		var req RulesTestRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{
+				"success": false,
+				"message": "JSON 解析失败: " + err.Error(),
+			})
+			return
+		}
+
+		// 与 Webhook 使用相同的默认值
+		topic := req.Topic
+		if topic == "" {
+			topic = cfg.MQTT.Topic
+		}
+		client := strings.TrimSpace(req.Client)
+		if client == "" {
+			client = "webhook"
+		}
+		ip := req.IP
+		if ip == "" {
+			ip = ratelimit.GetClientIP(r)
+		}
+		credential := req.Credential
+		if credential == "" {
+			credential = broker.CredentialToken
+		}
+
+		result := b.Route(broker.RouteInput{
+			Topic: topicForPublish(topic),
+			Message: broker.Message{
+				Title:     req.Title,
+				Content:   req.Content,
+				Extra:     req.Extra,
+				Timestamp: time.Now(),
+				Client:    client,
+				Priority:  req.Priority,
+				Tags:      normalizeTags(req.Tags),
+			},
+			IP:         ip,
+			Credential: credential,
+		})
+		writeJSON(w, http.StatusOK, map[string]any{
+			"success": true,
+			"data":    result,
+		})
+	}
+}
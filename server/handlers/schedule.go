@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"notice-server/broker"
+	"notice-server/config"
+	"notice-server/store"
+)
+
+// maxScheduleAhead 定时消息最远的发送时间，防止把毫秒时间戳误当作秒等错误
+const maxScheduleAhead = 366 * 24 * time.Hour
+
+// FlexTime 支持 RFC3339 字符串或 Unix 时间戳（秒或毫秒）
+type FlexTime struct{ time.Time }
+
+func (t *FlexTime) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, []byte("null")) {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		parsed, err := parseFlexTime(s)
+		if err != nil {
+			return err
+		}
+		t.Time = parsed
+		return nil
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return err
+	}
+	v, err := n.Int64()
+	if err != nil {
+		return err
+	}
+	t.Time = unixTime(v)
+	return nil
+}
+
+// parseFlexTime 解析 RFC3339 或 Unix 时间戳字符串，空字符串返回零值
+func parseFlexTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return unixTime(n), nil
+	}
+	parsed, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("时间格式无效，应为 RFC3339 或 Unix 时间戳: %s", s)
+	}
+	return parsed, nil
+}
+
+// unixTime 大于 1e12 的时间戳视为毫秒
+func unixTime(v int64) time.Time {
+	if v >= 1e12 {
+		return time.UnixMilli(v)
+	}
+	return time.Unix(v, 0)
+}
+
+// FlexDuration 支持秒数或时长字符串（如 "90s"、"2h30m"、"7d"）
+type FlexDuration struct{ time.Duration }
+
+func (d *FlexDuration) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, []byte("null")) {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		parsed, err := parseDuration(s)
+		if err != nil {
+			return err
+		}
+		d.Duration = parsed
+		return nil
+	}
+
+	var secs float64
+	if err := json.Unmarshal(b, &secs); err != nil {
+		return err
+	}
+	d.Duration = time.Duration(secs * float64(time.Second))
+	return nil
+}
+
+// parseDuration 解析时长，在 time.ParseDuration 基础上支持按天的 "d" 单位和纯数字秒数
+func parseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(secs * float64(time.Second)), nil
+	}
+
+	var days time.Duration
+	if i := strings.Index(s, "d"); i > 0 {
+		n, err := strconv.Atoi(s[:i])
+		if err != nil {
+			return 0, fmt.Errorf("时长格式无效: %s", s)
+		}
+		days = time.Duration(n) * 24 * time.Hour
+		s = s[i+1:]
+		if s == "" {
+			return days, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("时长格式无效: %s", s)
+	}
+	return days + d, nil
+}
+
+// scheduleTime 根据 send_at / delay 计算发送时间，未指定时返回零值（立即发送）
+func (req *Request) scheduleTime(now time.Time) (time.Time, error) {
+	if req.SendAt != nil && !req.SendAt.IsZero() && req.Delay != nil && req.Delay.Duration != 0 {
+		return time.Time{}, errors.New("send_at 和 delay 不能同时指定")
+	}
+
+	var at time.Time
+	switch {
+	case req.SendAt != nil && !req.SendAt.IsZero():
+		at = req.SendAt.Time
+		if !at.After(now) {
+			return time.Time{}, errors.New("send_at 必须晚于当前时间")
+		}
+	case req.Delay != nil && req.Delay.Duration != 0:
+		if req.Delay.Duration < 0 {
+			return time.Time{}, errors.New("delay 不能为负数")
+		}
+		at = now.Add(req.Delay.Duration)
+	default:
+		return time.Time{}, nil
+	}
+
+	if at.Sub(now) > maxScheduleAhead {
+		return time.Time{}, fmt.Errorf("发送时间不能晚于 %d 天后", int(maxScheduleAhead.Hours()/24))
+	}
+	return at, nil
+}
+
+// ScheduledHandler 列出等待发送的定时消息
+// GET /scheduled
+func ScheduledHandler(b *broker.Broker, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if !isAuthorized(ExtractToken(r), cfg) {
+			writeJSON(w, http.StatusUnauthorized, map[string]any{
+				"success": false,
+				"message": "认证失败",
+			})
+			return
+		}
+
+		list, err := b.ScheduledMessages()
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]any{
+				"success": false,
+				"message": "查询失败: " + err.Error(),
+			})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"success": true,
+			"data": map[string]any{
+				"scheduled": list,
+				"total":     len(list),
+			},
+		})
+	}
+}
+
+// CancelScheduledHandler 取消定时消息
+// DELETE /scheduled/{id}
+func CancelScheduledHandler(b *broker.Broker, cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if !isAuthorized(ExtractToken(r), cfg) {
+			writeJSON(w, http.StatusUnauthorized, map[string]any{
+				"success": false,
+				"message": "认证失败",
+			})
+			return
+		}
+
+		id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]any{
+				"success": false,
+				"message": "无效的定时消息 ID",
+			})
+			return
+		}
+
+		if err := b.CancelScheduled(id); err != nil {
+			status := http.StatusInternalServerError
+			message := err.Error()
+			if errors.Is(err, store.ErrNotFound) {
+				status = http.StatusNotFound
+				message = "定时消息不存在或已发送"
+			}
+			writeJSON(w, status, map[string]any{
+				"success": false,
+				"message": message,
+			})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{
+			"success": true,
+			"message": "定时消息已取消",
+		})
+	}
+}
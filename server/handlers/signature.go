@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"notice-server/broker"
+	"notice-server/config"
+)
+
+// 请求签名的请求头
+const (
+	headerSignature = "X-Notice-Signature" // sha256=<hex>，HMAC-SHA256(密钥, 签名串)，见 signedPayload
+	headerTimestamp = "X-Notice-Timestamp" // Unix 时间戳（秒）
+	headerNonce     = "X-Notice-Nonce"     // 每个请求唯一的随机串
+)
+
+// maxNonceLength nonce 的最大长度
+const maxNonceLength = 128
+
+// errAuthFailed 返回给调用方的认证失败信息，具体原因只记录在服务端日志中
+var errAuthFailed = errors.New("认证失败")
+
+// credential 接入端点的认证方式
+type credential struct {
+	name    string               // 凭据名称，用于发布限流和路由规则匹配
+	token   string               // Token，也是默认的签名密钥
+	signing config.SigningConfig // 请求签名配置
+	// 平台签名（如 GitHub 的 X-Hub-Signature-256），非 nil 时只按它校验
+	verify func(r *http.Request, body []byte) bool
+}
+
+// tokenCredential auth.token 及其请求签名配置
+func (h *WebhookHandler) tokenCredential() credential {
+	return credential{
+		name:    broker.CredentialToken,
+		token:   h.config.Auth.Token,
+		signing: h.config.Auth.Signing,
+	}
+}
+
+// signature 请求携带的签名
+type signature struct {
+	timestamp int64
+	nonce     string
+	value     string
+}
+
+// precheck 读取请求体之前的认证：未签名的请求校验 Token，签名请求检查时间戳和 nonce 格式
+// 返回请求的签名，未签名或使用平台签名时为 nil
+func (c credential) precheck(r *http.Request, now time.Time) (*signature, error) {
+	if c.verify != nil {
+		return nil, nil
+	}
+
+	value := r.Header.Get(headerSignature)
+	if value == "" {
+		if c.signing.Required {
+			return nil, errors.New("该凭据要求请求签名")
+		}
+		if !config.TokenEqual(ExtractToken(r), c.token) {
+			return nil, errors.New("Token 无效")
+		}
+		return nil, nil
+	}
+
+	if c.secret() == "" {
+		return nil, errors.New("凭据未配置签名密钥")
+	}
+	ts, err := strconv.ParseInt(r.Header.Get(headerTimestamp), 10, 64)
+	if err != nil {
+		return nil, errors.New("缺少或无效的 " + headerTimestamp)
+	}
+	nonce := r.Header.Get(headerNonce)
+	if nonce == "" || len(nonce) > maxNonceLength {
+		return nil, errors.New("缺少或无效的 " + headerNonce)
+	}
+	window := c.signing.Window()
+	if sent := time.Unix(ts, 0); sent.Before(now.Add(-window)) || sent.After(now.Add(window)) {
+		return nil, errors.New("时间戳超出允许范围")
+	}
+	// 签名只覆盖查询参数和请求体，不接受通过请求头传递的消息字段
+	for _, field := range requestFields {
+		if r.Header.Get(fieldHeader(field)) != "" {
+			return nil, errors.New("签名请求不能通过请求头 " + fieldHeader(field) + " 传递消息字段")
+		}
+	}
+	return &signature{timestamp: ts, nonce: nonce, value: value}, nil
+}
+
+// secret 签名密钥，未配置时为 Token
+func (c credential) secret() string {
+	if c.signing.Secret != "" {
+		return c.signing.Secret
+	}
+	return c.token
+}
+
+// check 读取请求体之后的认证：校验平台签名，或校验请求签名并占用 nonce
+func (h *WebhookHandler) check(c credential, sig *signature, r *http.Request, body []byte, now time.Time) error {
+	if c.verify != nil {
+		if !c.verify(r, body) {
+			return errors.New("平台签名无效")
+		}
+		return nil
+	}
+	if sig == nil {
+		return nil
+	}
+
+	// 先校验签名，未通过签名的请求不能占用 nonce
+	if !verifyHMAC(c.secret(), signedPayload(r, sig.timestamp, sig.nonce, body), sig.value) {
+		return errors.New("签名无效")
+	}
+	// 时间戳超出窗口的请求已被拒绝，nonce 只需保留到窗口结束
+	expires := time.Unix(sig.timestamp, 0).Add(c.signing.Window())
+	if !h.nonces.use(c.name+"\n"+sig.nonce, expires, now) {
+		return errors.New("nonce 已使用")
+	}
+	return nil
+}
+
+// signedPayload 签名串，各部分以换行分隔：
+// 时间戳、nonce、请求方法、路径、原始查询串（不含 ?，可为空）、请求体
+func signedPayload(r *http.Request, timestamp int64, nonce string, body []byte) []byte {
+	path, query := r.URL.EscapedPath(), r.URL.RawQuery
+	b := make([]byte, 0, len(body)+len(nonce)+len(r.Method)+len(path)+len(query)+24)
+	b = strconv.AppendInt(b, timestamp, 10)
+	b = append(b, '\n')
+	b = append(b, nonce...)
+	b = append(b, '\n')
+	b = append(b, r.Method...)
+	b = append(b, '\n')
+	b = append(b, path...)
+	b = append(b, '\n')
+	b = append(b, query...)
+	b = append(b, '\n')
+	return append(b, body...)
+}
+
+// nonceCache 记录窗口内已使用的 nonce，防止签名请求被重放
+// 仅保存在内存中，服务重启后窗口内的请求可被重放一次
+type nonceCache struct {
+	mu     sync.Mutex
+	seen   map[string]time.Time // nonce -> 过期时间
+	pruned time.Time
+}
+
+func newNonceCache() *nonceCache {
+	return &nonceCache{seen: make(map[string]time.Time)}
+}
+
+// use 记录 nonce，已使用且未过期时返回 false
+func (c *nonceCache) use(nonce string, expires, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// 每分钟清理一次过期记录
+	if now.Sub(c.pruned) > time.Minute {
+		for k, exp := range c.seen {
+			if now.After(exp) {
+				delete(c.seen, k)
+			}
+		}
+		c.pruned = now
+	}
+
+	if exp, ok := c.seen[nonce]; ok && !now.After(exp) {
+		return false
+	}
+	c.seen[nonce] = expires
+	return true
+}
@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"notice-server/config"
+	"notice-server/ratelimit"
+)
+
+// signRequest 按文档中的签名串格式为请求签名
+func signRequest(r *http.Request, secret string, ts int64, nonce, body string) {
+	payload := fmt.Sprintf("%d\n%s\n%s\n%s\n%s\n%s", ts, nonce, r.Method, r.URL.EscapedPath(), r.URL.RawQuery, body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	r.Header.Set(headerTimestamp, strconv.FormatInt(ts, 10))
+	r.Header.Set(headerNonce, nonce)
+	r.Header.Set(headerSignature, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+}
+
+func newSignedRequest(method, target, secret string, ts int64, nonce, body string) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	signRequest(r, secret, ts, nonce, body)
+	return r
+}
+
+func TestCredentialPrecheck(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	c := credential{name: "token", token: "secret-token", signing: config.SigningConfig{MaxSkew: 60}}
+	required := c
+	required.signing.Required = true
+
+	tests := []struct {
+		name    string
+		c       credential
+		req     func() *http.Request
+		wantErr bool
+		signed  bool
+	}{
+		{"token header", c, func() *http.Request {
+			r := httptest.NewRequest("POST", "/webhook", nil)
+			r.Header.Set("Authorization", "Bearer secret-token")
+			return r
+		}, false, false},
+		{"token query", c, func() *http.Request {
+			return httptest.NewRequest("GET", "/webhook?token=secret-token", nil)
+		}, false, false},
+		{"wrong token", c, func() *http.Request {
+			return httptest.NewRequest("POST", "/webhook?token=nope", nil)
+		}, true, false},
+		{"required without signature", required, func() *http.Request {
+			return httptest.NewRequest("POST", "/webhook?token=secret-token", nil)
+		}, true, false},
+		{"signed", required, func() *http.Request {
+			return newSignedRequest("POST", "/webhook", "secret-token", now.Unix(), "n1", "{}")
+		}, false, true},
+		{"within window", c, func() *http.Request {
+			return newSignedRequest("POST", "/webhook", "secret-token", now.Unix()-60, "n1", "{}")
+		}, false, true},
+		{"stale timestamp", c, func() *http.Request {
+			return newSignedRequest("POST", "/webhook", "secret-token", now.Unix()-61, "n1", "{}")
+		}, true, false},
+		{"future timestamp", c, func() *http.Request {
+			return newSignedRequest("POST", "/webhook", "secret-token", now.Unix()+61, "n1", "{}")
+		}, true, false},
+		{"invalid timestamp", c, func() *http.Request {
+			r := newSignedRequest("POST", "/webhook", "secret-token", now.Unix(), "n1", "{}")
+			r.Header.Set(headerTimestamp, "yesterday")
+			return r
+		}, true, false},
+		{"missing nonce", c, func() *http.Request {
+			r := newSignedRequest("POST", "/webhook", "secret-token", now.Unix(), "n1", "{}")
+			r.Header.Del(headerNonce)
+			return r
+		}, true, false},
+		{"nonce too long", c, func() *http.Request {
+			return newSignedRequest("POST", "/webhook", "secret-token", now.Unix(), strings.Repeat("n", maxNonceLength+1), "{}")
+		}, true, false},
+		{"message header", c, func() *http.Request {
+			r := newSignedRequest("POST", "/webhook", "secret-token", now.Unix(), "n1", "body")
+			r.Header.Set("X-Title", "forged")
+			return r
+		}, true, false},
+		{"no secret", credential{name: "token"}, func() *http.Request {
+			return newSignedRequest("POST", "/webhook", "", now.Unix(), "n1", "{}")
+		}, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sig, err := tt.c.precheck(tt.req(), now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("precheck() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (sig != nil) != tt.signed {
+				t.Errorf("precheck() signature = %v, want signed %v", sig, tt.signed)
+			}
+		})
+	}
+}
+
+func TestSignatureCheck(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	ts := now.Unix()
+	c := credential{name: "token", token: "secret-token", signing: config.SigningConfig{MaxSkew: 60}}
+	body := `{"content":"hi"}`
+
+	tests := []struct {
+		name    string
+		c       credential
+		req     func() *http.Request // 签名后被改写的请求
+		body    string               // 服务端收到的请求体
+		wantErr bool
+	}{
+		{"valid", c, func() *http.Request {
+			return newSignedRequest("POST", "/webhook", "secret-token", ts, "a", body)
+		}, body, false},
+		{"valid query", c, func() *http.Request {
+			return newSignedRequest("GET", "/webhook?title=t&content=c", "secret-token", ts, "b", "")
+		}, "", false},
+		{"custom secret", credential{name: "custom/x", token: "x", signing: config.SigningConfig{Secret: "signing-key"}}, func() *http.Request {
+			return newSignedRequest("POST", "/webhook/custom/x", "signing-key", ts, "c", body)
+		}, body, false},
+		{"wrong secret", c, func() *http.Request {
+			return newSignedRequest("POST", "/webhook", "other", ts, "d", body)
+		}, body, true},
+		{"tampered body", c, func() *http.Request {
+			return newSignedRequest("POST", "/webhook", "secret-token", ts, "e", body)
+		}, `{"content":"evil"}`, true},
+		{"tampered query", c, func() *http.Request {
+			r := newSignedRequest("GET", "/webhook?title=t&content=c", "secret-token", ts, "f", "")
+			r.URL.RawQuery = "title=t&content=evil"
+			return r
+		}, "", true},
+		{"added query", c, func() *http.Request {
+			r := newSignedRequest("POST", "/webhook", "secret-token", ts, "g", body)
+			r.URL.RawQuery = "topic=other"
+			return r
+		}, body, true},
+		{"tampered path", c, func() *http.Request {
+			r := newSignedRequest("POST", "/webhook", "secret-token", ts, "h", "[]")
+			r.URL.Path = "/webhook/batch"
+			return r
+		}, "[]", true},
+		{"tampered method", c, func() *http.Request {
+			r := newSignedRequest("POST", "/webhook?content=c", "secret-token", ts, "i", "")
+			r.Method = "GET"
+			return r
+		}, "", true},
+		{"tampered timestamp", c, func() *http.Request {
+			r := newSignedRequest("POST", "/webhook", "secret-token", ts, "j", body)
+			r.Header.Set(headerTimestamp, strconv.FormatInt(ts+1, 10))
+			return r
+		}, body, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &WebhookHandler{nonces: newNonceCache()}
+			r := tt.req()
+			sig, err := tt.c.precheck(r, now)
+			if err != nil {
+				t.Fatalf("precheck() error = %v", err)
+			}
+			err = h.check(tt.c, sig, r, []byte(tt.body), now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSignatureReplay(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	window := time.Minute
+	c := credential{name: "token", token: "secret-token", signing: config.SigningConfig{MaxSkew: 60}}
+	h := &WebhookHandler{nonces: newNonceCache()}
+	body := `{"content":"hi"}`
+
+	verify := func(c credential, nonce string, at time.Time) error {
+		r := newSignedRequest("POST", "/webhook", c.secret(), now.Unix(), nonce, body)
+		sig, err := c.precheck(r, at)
+		if err != nil {
+			return err
+		}
+		return h.check(c, sig, r, []byte(body), at)
+	}
+
+	if err := verify(c, "n1", now); err != nil {
+		t.Fatalf("首次请求失败: %v", err)
+	}
+	if err := verify(c, "n1", now.Add(30*time.Second)); err == nil {
+		t.Error("重放的请求应被拒绝")
+	}
+	if err := verify(c, "n2", now); err != nil {
+		t.Errorf("不同 nonce 的请求失败: %v", err)
+	}
+	other := credential{name: "custom/x", token: "secret-token"}
+	if err := verify(other, "n1", now); err != nil {
+		t.Errorf("其他凭据使用相同 nonce 失败: %v", err)
+	}
+	// 窗口结束后时间戳已过期，重放仍被拒绝
+	if err := verify(c, "n1", now.Add(window+time.Second)); err == nil {
+		t.Error("窗口结束后的重放应被拒绝")
+	}
+
+	// 签名无效的请求不占用 nonce
+	r := newSignedRequest("POST", "/webhook", "wrong", now.Unix(), "n3", body)
+	sig, _ := c.precheck(r, now)
+	if err := h.check(c, sig, r, []byte(body), now); err == nil {
+		t.Fatal("签名无效的请求应被拒绝")
+	}
+	if err := verify(c, "n3", now); err != nil {
+		t.Errorf("签名无效的请求占用了 nonce: %v", err)
+	}
+}
+
+func TestNonceCacheExpiry(t *testing.T) {
+	c := newNonceCache()
+	now := time.Unix(1_700_000_000, 0)
+	if !c.use("n", now.Add(time.Minute), now) {
+		t.Fatal("首次使用应成功")
+	}
+	if c.use("n", now.Add(time.Minute), now.Add(time.Minute)) {
+		t.Error("过期前不能重复使用")
+	}
+	if !c.use("n", now.Add(3*time.Minute), now.Add(2*time.Minute)) {
+		t.Error("过期后应可再次使用")
+	}
+	// 清理过期记录
+	c.use("m", now.Add(10*time.Minute), now.Add(5*time.Minute))
+	if _, ok := c.seen["n"]; ok {
+		t.Error("过期记录未被清理")
+	}
+}
+
+// unreadBody 被读取时报告错误，用于确认认证失败时未读取请求体
+type unreadBody struct{ t *testing.T }
+
+func (b unreadBody) Read([]byte) (int, error) {
+	b.t.Error("认证失败的请求不应读取请求体")
+	return 0, io.EOF
+}
+
+func TestInboundAuthFailure(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Auth.Token = "secret-token"
+	cfg.Auth.Signing.MaxSkew = 60
+	h := &WebhookHandler{
+		config:  cfg,
+		limiter: ratelimit.New(ratelimit.Config{}),
+		nonces:  newNonceCache(),
+	}
+	now := time.Now().Unix()
+
+	tests := []struct {
+		name string
+		req  func() *http.Request
+	}{
+		{"wrong token", func() *http.Request {
+			r := httptest.NewRequest("POST", "/webhook?token=nope", nil)
+			r.Body = io.NopCloser(unreadBody{t})
+			return r
+		}},
+		{"stale timestamp", func() *http.Request {
+			r := newSignedRequest("POST", "/webhook", "secret-token", now-3600, "n1", "{}")
+			r.Body = io.NopCloser(unreadBody{t})
+			return r
+		}},
+		{"bad signature", func() *http.Request {
+			return newSignedRequest("POST", "/webhook", "wrong", now, "n2", "{}")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			if _, _, ok := h.inbound(w, tt.req(), h.tokenCredential()); ok {
+				t.Fatal("inbound() ok = true, want false")
+			}
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("status = %d, want 401", w.Code)
+			}
+			var resp Response
+			json.NewDecoder(w.Body).Decode(&resp)
+			if resp.Message != errAuthFailed.Error() {
+				t.Errorf("message = %q, want %q", resp.Message, errAuthFailed.Error())
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	body, credential, ok := h.inbound(w, newSignedRequest("POST", "/webhook", "secret-token", now, "n3", "{}"), h.tokenCredential())
+	if !ok || string(body) != "{}" || credential != "token" {
+		t.Errorf("签名请求 inbound() = %q, %q, %v", body, credential, ok)
+	}
+}
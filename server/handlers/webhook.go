@@ -3,9 +3,13 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 	"unicode/utf8"
@@ -14,6 +18,7 @@ import (
 	"notice-server/config"
 	"notice-server/logger"
 	"notice-server/ratelimit"
+	"notice-server/store"
 )
 
 // Request Webhook 请求结构
@@ -23,34 +28,73 @@ type Request struct {
 	Topic   string `json:"topic,omitempty"` // 可选：指定主题
 	Extra   any    `json:"extra,omitempty"` // 可选：额外数据
 	Client  string `json:"client,omitempty"` // 可选：发送端标识，如 web / android / cli
+
+	// 可选：优先级 min / low / default / high / urgent 或 1-5，不传为默认优先级；更新消息时不传则保留原优先级
+	Priority *broker.Priority `json:"priority,omitempty"`
+	// 可选：去重分组键，启用 dedup_window 时窗口内同组消息只发布一次；不填则按标题和内容去重
+	GroupKey string `json:"group_key,omitempty"`
+	// 可选：标签，路由规则可追加
+	Tags []string `json:"tags,omitempty"`
+
+	// 可选：更新已发布的消息，二选一
+	UpdateID uint64 `json:"update_id,omitempty"` // 按消息 ID 更新
+	Key      string `json:"key,omitempty"`       // 按稳定标识更新，尚无该标识的消息时作为新消息发布
+
+	// 可选：定时发送，二选一
+	SendAt *FlexTime     `json:"send_at,omitempty"` // 发送时间，RFC3339 或 Unix 时间戳
+	Delay  *FlexDuration `json:"delay,omitempty"`   // 延迟发送，秒数或时长字符串（如 "2h"、"7d"）
 }
 
 // Response Webhook 响应
 type Response struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
-	Clients int    `json:"clients,omitempty"` // 当前连接的客户端数
+	Success    bool             `json:"success"`
+	Message    string           `json:"message"`
+	Clients    int              `json:"clients,omitempty"`    // 当前连接的客户端数
+	ID         uint64           `json:"id,omitempty"`         // 消息历史中的 ID（启用存储时）
+	Deliveries []store.Delivery `json:"deliveries,omitempty"` // 发布时的投递回执快照
+
+	ScheduledID uint64     `json:"scheduled_id,omitempty"` // 定时消息 ID，可用于取消
+	SendAt      *time.Time `json:"send_at,omitempty"`      // 定时消息的发送时间
+
+	Suppressed bool `json:"suppressed,omitempty"` // 重复消息已合并，未再次发布
+	Repeats    int  `json:"repeats,omitempty"`    // 窗口内已合并的重复次数
+
+	Updated bool `json:"updated,omitempty"` // 已更新原消息，未创建新消息
+	Edits   int  `json:"edits,omitempty"`   // 消息的编辑历史条数
+
+	Rules   []string `json:"rules,omitempty"`   // 命中的路由规则
+	Dropped bool     `json:"dropped,omitempty"` // 消息被路由规则丢弃
+	Routes  []Route  `json:"routes,omitempty"`  // 分发到多个主题时每个主题的结果，顶层字段为第一个主题的结果
+}
+
+// Route 分发到单个主题的结果
+type Route struct {
+	Topic       string `json:"topic"`
+	ID          uint64 `json:"id,omitempty"`
+	ScheduledID uint64 `json:"scheduled_id,omitempty"`
+	Suppressed  bool   `json:"suppressed,omitempty"`
+	Error       string `json:"error,omitempty"`
 }
 
 // WebhookHandler Webhook 处理器
 type WebhookHandler struct {
-	broker  *broker.Broker
-	config  *config.Config
-	limiter *ratelimit.Limiter
+	broker       *broker.Broker
+	config       *config.Config
+	limiter      *ratelimit.Limiter
+	publishLimit *ratelimit.PublishLimiter
+	nonces       *nonceCache // 签名请求已使用的 nonce
 }
 
 // NewWebhookHandler 创建新的 Webhook 处理器
-func NewWebhookHandler(b *broker.Broker, cfg *config.Config) *WebhookHandler {
-	limiter := ratelimit.New(ratelimit.Config{
-		MaxFailures: cfg.RateLimit.MaxFailures,
-		BlockTime:   time.Duration(cfg.RateLimit.BlockTime) * time.Second,
-		WindowTime:  time.Duration(cfg.RateLimit.WindowTime) * time.Second,
-	})
-
+// limiter 与 MQTT 认证共享，任一入口的失败都计入同一 IP
+// publishLimit 与 MQTT 发布共享，同一凭据经两个入口发布共用额度
+func NewWebhookHandler(b *broker.Broker, cfg *config.Config, limiter *ratelimit.Limiter, publishLimit *ratelimit.PublishLimiter) *WebhookHandler {
 	return &WebhookHandler{
-		broker:  b,
-		config:  cfg,
-		limiter: limiter,
+		broker:       b,
+		config:       cfg,
+		limiter:      limiter,
+		publishLimit: publishLimit,
+		nonces:       newNonceCache(),
 	}
 }
 
@@ -58,83 +102,203 @@ func NewWebhookHandler(b *broker.Broker, cfg *config.Config) *WebhookHandler {
 func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	clientIP := ratelimit.GetClientIP(r)
+	// 接受 POST 和 GET（查询参数）请求
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+		logger.Warn("Webhook 收到不支持的请求方法", "method", r.Method)
+		w.Header().Set("Allow", "GET, POST")
+		h.sendError(w, http.StatusMethodNotAllowed, "只支持 GET / POST 请求")
+		return
+	}
 
-	// 检查 IP 是否被封禁
-	if h.limiter.IsBlocked(clientIP) {
-		logger.Warn("请求被拒绝，IP 已封禁", "ip", clientIP)
-		h.sendError(w, http.StatusTooManyRequests, "请求过于频繁，请稍后再试")
+	// 检查 IP 封禁、读取请求体并认证（Token 或请求签名）
+	body, credential, ok := h.inbound(w, r, h.tokenCredential())
+	if !ok {
 		return
 	}
 
-	// 只接受 POST 请求
-	if r.Method != http.MethodPost {
-		logger.Warn("Webhook 收到非 POST 请求", "method", r.Method)
-		h.sendError(w, http.StatusMethodNotAllowed, "只支持 POST 请求")
+	logger.Debug("收到 Webhook 请求", "method", r.Method, "content_type", r.Header.Get("Content-Type"), "body_size", len(body))
+
+	// 解析消息（JSON、表单、纯文本或查询参数）
+	req, err := parseRequest(r, body)
+	if err != nil {
+		logger.Warn("请求解析失败", "error", err, "body", string(body))
+		h.sendError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	// Token 校验
-	if !ValidateToken(r, h.config.Auth.Token) {
-		h.limiter.RecordFailure(clientIP)
-		logger.Warn("Webhook Token 校验失败", "ip", clientIP)
-		h.sendError(w, http.StatusUnauthorized, "认证失败")
+	// 仅做 Token 校验，不发布到 MQTT（Web 端登录时用）
+	if req.Content == "__auth_check__" {
+		h.sendSuccess(w, "认证成功", h.broker.ClientCount())
 		return
 	}
 
-	// 认证成功，清除失败记录
-	h.limiter.RecordSuccess(clientIP)
+	h.publish(w, ratelimit.GetClientIP(r), credential, req)
+}
 
-	// 读取请求体
-	body, err := io.ReadAll(r.Body)
+// publish 发布已解析的请求并写入响应
+func (h *WebhookHandler) publish(w http.ResponseWriter, clientIP, credential string, req Request) {
+	status, resp := h.dispatch(w, clientIP, credential, req)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// dispatch 校验并发布已解析的请求，处理定时、更新、路由规则和去重，返回状态码和响应
+// credential 为发布使用的凭据名称，用于发布限流和路由规则匹配；w 仅用于写入限流响应头
+func (h *WebhookHandler) dispatch(w http.ResponseWriter, clientIP, credential string, req Request) (int, Response) {
+	if err := h.validate(req); err != nil {
+		return http.StatusBadRequest, Response{Message: err.Error()}
+	}
+
+	// 定时发送
+	sendAt, err := req.scheduleTime(time.Now())
 	if err != nil {
-		logger.Error("读取请求体失败", "error", err)
-		h.sendError(w, http.StatusBadRequest, "读取请求体失败")
-		return
+		logger.Warn("定时参数无效", "error", err)
+		return http.StatusBadRequest, Response{Message: err.Error()}
 	}
-	defer r.Body.Close()
 
-	logger.Debug("收到 Webhook 请求", "body_size", len(body))
+	req.Key = strings.TrimSpace(req.Key)
+	if (req.UpdateID > 0 || req.Key != "") && !sendAt.IsZero() {
+		logger.Warn("更新消息不支持定时发送")
+		return http.StatusBadRequest, Response{Message: "update_id / key 不能与 send_at / delay 同时使用"}
+	}
 
-	// 预处理：修复 JSON 字符串中的换行符
-	// 将字符串值中的真实换行符转换为 \n 转义序列
-	body = fixJSONNewlines(body)
+	// 发布限流（按凭据和来源 IP），每个请求只扣除一次；被去重合并的消息不扣除
+	charge, limit := h.newCharge(w, clientIP, credential)
 
-	// 解析消息
-	var req Request
-	if err := json.Unmarshal(body, &req); err != nil {
-		logger.Warn("JSON 解析失败", "error", err, "body", string(body))
-		h.sendError(w, http.StatusBadRequest, "JSON 解析失败: "+err.Error())
-		return
+	// 路由规则：改写主题、优先级和标签，丢弃或分发到多个主题
+	route := h.route(clientIP, credential, req)
+
+	// 立即发布的消息在去重之后扣除，其余请求在此扣除
+	if route.Dropped || !sendAt.IsZero() || req.UpdateID > 0 || req.Key != "" {
+		if err := charge(); err != nil {
+			return http.StatusTooManyRequests, Response{Message: limitMessage(*limit)}
+		}
 	}
 
-	// 验证必填字段
-	if req.Content == "" {
-		logger.Warn("content 字段为空")
-		h.sendError(w, http.StatusBadRequest, "content 字段不能为空")
-		return
+	if route.Dropped {
+		logger.Info("消息已按规则丢弃", "topic", req.Topic, "title", req.Title, "rules", route.Rules)
+		return http.StatusOK, Response{
+			Success: true,
+			Message: "消息已按规则丢弃",
+			Rules:   route.Rules,
+			Dropped: true,
+		}
+	}
+	msg := route.Message
+	topics := route.Topics
+	if len(route.Rules) > 0 {
+		logger.Debug("消息命中路由规则", "rules", route.Rules, "topics", topics)
 	}
 
-	// 仅做 Token 校验，不发布到 MQTT（Web 端登录时用）
-	if req.Content == "__auth_check__" {
-		h.sendSuccess(w, "认证成功", h.broker.ClientCount())
-		return
+	if !sendAt.IsZero() {
+		resp := Response{Success: true, Message: "消息将定时发送", Rules: route.Rules}
+		for _, t := range topics {
+			sm, err := h.broker.Schedule(t, msg, sendAt)
+			if err != nil {
+				logger.Error("定时消息保存失败", "topic", t, "error", err)
+				status := http.StatusInternalServerError
+				if errors.Is(err, broker.ErrSchedulerDisabled) {
+					status = http.StatusServiceUnavailable
+				}
+				return status, Response{Message: err.Error()}
+			}
+			logger.Info("定时消息已保存", "scheduled_id", sm.ID, "topic", t, "send_at", sm.SendAt)
+			if resp.ScheduledID == 0 {
+				resp.ScheduledID = sm.ID
+				resp.SendAt = &sm.SendAt
+			}
+			resp.Routes = append(resp.Routes, Route{Topic: t, ScheduledID: sm.ID})
+		}
+		if len(topics) == 1 {
+			resp.Routes = nil
+		}
+		return http.StatusOK, resp
+	}
+
+	// 更新消息只使用第一个主题，不分发；请求未指定且路由规则未改写优先级时保留原优先级
+	if req.UpdateID > 0 || req.Key != "" {
+		var priority *broker.Priority
+		if req.Priority != nil || msg.Priority != broker.PriorityDefault {
+			priority = &msg.Priority
+		}
+		return h.edit(topics[0], req.UpdateID, msg, priority)
+	}
+
+	var first broker.DedupResult
+	var routes []Route
+	for i, t := range topics {
+		result, err := h.broker.PublishDedup(t, msg, charge)
+		if errors.Is(err, errPublishLimited) {
+			// 只有第一条实际发布的消息会扣除额度，扣除失败时尚未发布任何消息
+			return http.StatusTooManyRequests, Response{Message: limitMessage(*limit)}
+		}
+		if err != nil {
+			logger.Error("消息发布失败", "topic", t, "error", err)
+			if i == 0 {
+				return http.StatusInternalServerError, Response{Message: "消息推送失败"}
+			}
+			routes = append(routes, Route{Topic: t, Error: "消息推送失败"})
+			continue
+		}
+		if i == 0 {
+			first = result
+		}
+		if result.Suppressed {
+			logger.Info("重复消息已合并", "topic", t, "title", req.Title, "id", result.ID, "repeats", result.Repeats)
+		}
+		routes = append(routes, Route{Topic: t, ID: result.ID, Suppressed: result.Suppressed})
+	}
+	if len(topics) == 1 {
+		routes = nil
+	}
+	id := first.ID
+
+	if first.Suppressed {
+		return http.StatusOK, Response{
+			Success:    true,
+			Message:    "重复消息已合并",
+			ID:         id,
+			Suppressed: true,
+			Repeats:    first.Repeats,
+			Rules:      route.Rules,
+			Routes:     routes,
+		}
+	}
+
+	clientCount := h.broker.ClientCount()
+	logger.Info("消息推送成功", "topic", topics[0], "title", req.Title, "priority", msg.Priority, "clients", clientCount, "id", id)
+
+	resp := Response{Success: true, Message: "消息推送成功", Clients: clientCount, ID: id, Rules: route.Rules, Routes: routes}
+	if id > 0 {
+		// 发布时已同步下发给在线客户端并进入离线队列，此时回执多为 queued，确认结果可稍后通过 /messages/{id}/deliveries 查询
+		if deliveries, err := h.broker.Deliveries(id); err == nil {
+			resp.Deliveries = deliveries
+		}
 	}
 
-	// 验证字段长度
+	// 成功响应
+	return http.StatusOK, resp
+}
+
+// validate 校验请求的必填字段和长度
+func (h *WebhookHandler) validate(req Request) error {
+	if req.Content == "" {
+		logger.Warn("content 字段为空")
+		return errors.New("content 字段不能为空")
+	}
 	if h.config.Message.MaxTitleLength > 0 && utf8.RuneCountInString(req.Title) > h.config.Message.MaxTitleLength {
 		logger.Warn("title 超出长度限制", "size", utf8.RuneCountInString(req.Title), "max", h.config.Message.MaxTitleLength)
-		h.sendError(w, http.StatusBadRequest, fmt.Sprintf("title 长度不能超过 %d 字符", h.config.Message.MaxTitleLength))
-		return
+		return fmt.Errorf("title 长度不能超过 %d 字符", h.config.Message.MaxTitleLength)
 	}
-
 	if h.config.Message.MaxContentLength > 0 && utf8.RuneCountInString(req.Content) > h.config.Message.MaxContentLength {
 		logger.Warn("content 超出长度限制", "size", utf8.RuneCountInString(req.Content), "max", h.config.Message.MaxContentLength)
-		h.sendError(w, http.StatusBadRequest, fmt.Sprintf("content 长度不能超过 %d 字符", h.config.Message.MaxContentLength))
-		return
+		return fmt.Errorf("content 长度不能超过 %d 字符", h.config.Message.MaxContentLength)
 	}
+	return nil
+}
 
-	// 构建推送消息
+// route 构建推送消息，解析发布主题并应用路由规则
+func (h *WebhookHandler) route(clientIP, credential string, req Request) broker.RouteResult {
 	client := strings.TrimSpace(req.Client)
 	if client == "" {
 		client = "webhook" // 经 Webhook 发送且未指定时
@@ -145,6 +309,13 @@ func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		Extra:     req.Extra,
 		Timestamp: time.Now(),
 		Client:    client,
+		GroupKey:  strings.TrimSpace(req.GroupKey),
+		Tags:      normalizeTags(req.Tags),
+		Key:       req.Key,
+		Publisher: credential,
+	}
+	if req.Priority != nil {
+		msg.Priority = *req.Priority
 	}
 
 	// 发布到 MQTT（订阅可用通配符 notice/#，发布必须用具体主题）
@@ -152,26 +323,174 @@ func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if topic == "" {
 		topic = h.config.MQTT.Topic
 	}
-	topic = topicForPublish(topic)
 
-	if err := h.broker.Publish(topic, msg); err != nil {
-		logger.Error("消息发布失败", "topic", topic, "error", err)
-		h.sendError(w, http.StatusInternalServerError, "消息推送失败")
-		return
+	return h.broker.Route(broker.RouteInput{
+		Topic:      topicForPublish(topic),
+		Message:    msg,
+		IP:         clientIP,
+		Credential: credential,
+	})
+}
+
+// errPublishLimited 超出发布限额
+var errPublishLimited = errors.New("超出发布限额")
+
+// newCharge 创建扣除一个请求发布额度的函数，多次调用只扣除一次，超出限额时返回 errPublishLimited
+// 返回的 limit 指向最近一次扣除的结果，w 用于写入限流响应头
+func (h *WebhookHandler) newCharge(w http.ResponseWriter, clientIP, credential string) (func() error, *ratelimit.Result) {
+	var limit ratelimit.Result
+	charged := false
+	return func() error {
+		if charged {
+			return nil
+		}
+		limit = h.publishLimit.Allow(credential, clientIP)
+		setRateLimitHeaders(w, limit)
+		if !limit.Allowed {
+			logger.Warn("Webhook 发布超出限额", "credential", credential, "ip", clientIP, "daily_quota", limit.Quota)
+			return errPublishLimited
+		}
+		charged = true
+		return nil
+	}, &limit
+}
+
+// limitMessage 发布限流的提示信息
+func limitMessage(limit ratelimit.Result) string {
+	if limit.Quota {
+		return "已超出每日消息配额"
+	}
+	return "发送过于频繁，请稍后再试"
+}
+
+// readBody 按 max_payload_bytes 限制读取请求体，失败时已写入响应
+func (h *WebhookHandler) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if h.config.Message.MaxPayloadBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, int64(h.config.Message.MaxPayloadBytes))
+	}
+	defer r.Body.Close()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			logger.Warn("请求体超出大小限制", "max", tooLarge.Limit)
+			h.sendError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("请求体不能超过 %d 字节", tooLarge.Limit))
+			return nil, false
+		}
+		logger.Error("读取请求体失败", "error", err)
+		h.sendError(w, http.StatusBadRequest, "读取请求体失败")
+		return nil, false
 	}
+	return body, true
+}
 
-	// 消息存储由 broker 的 MessageStoreHook 自动处理
+// inbound 接入的公共处理：检查 IP 封禁、认证并读取请求体，返回请求体和凭据名称
+// 未签名的请求在读取请求体之前校验 Token；签名请求（平台签名或 X-Notice-Signature）读取请求体后校验
+// 失败时已写入响应，认证失败的原因只记录在日志中
+func (h *WebhookHandler) inbound(w http.ResponseWriter, r *http.Request, c credential) ([]byte, string, bool) {
+	clientIP := ratelimit.GetClientIP(r)
+	if h.limiter.IsBlocked(clientIP) {
+		logger.Warn("请求被拒绝，IP 已封禁", "ip", clientIP)
+		h.sendError(w, http.StatusTooManyRequests, "请求过于频繁，请稍后再试")
+		return nil, "", false
+	}
+
+	fail := func(err error) ([]byte, string, bool) {
+		h.limiter.RecordFailure(clientIP)
+		logger.Warn("Webhook 认证失败", "credential", c.name, "ip", clientIP, "error", err)
+		h.sendError(w, http.StatusUnauthorized, errAuthFailed.Error())
+		return nil, "", false
+	}
+
+	sig, err := c.precheck(r, time.Now())
+	if err != nil {
+		return fail(err)
+	}
+
+	body, ok := h.readBody(w, r)
+	if !ok {
+		return nil, "", false
+	}
+	if err := h.check(c, sig, r, body, time.Now()); err != nil {
+		return fail(err)
+	}
+	h.limiter.RecordSuccess(clientIP)
+	return body, c.name, true
+}
+
+// fitRequest 将超长的标题和内容截断到配置的长度，用于内容不受调用方控制的第三方平台
+func (h *WebhookHandler) fitRequest(req *Request) {
+	req.Title = ellipsis(req.Title, h.config.Message.MaxTitleLength)
+	req.Content = ellipsis(req.Content, h.config.Message.MaxContentLength)
+}
+
+// ellipsis 超过 n 个字符时截断并以省略号结尾，n <= 0 表示不限制
+func ellipsis(s string, n int) string {
+	if n <= 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:n-1]) + "…"
+}
+
+// edit 更新已发布的消息，按 Key 更新且尚无该 Key 的消息时作为新消息发布
+func (h *WebhookHandler) edit(topic string, id uint64, msg broker.Message, priority *broker.Priority) (int, Response) {
+	result, err := h.broker.Edit(topic, id, msg, priority)
+	if err != nil {
+		logger.Warn("消息更新失败", "id", id, "key", msg.Key, "error", err)
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			return http.StatusNotFound, Response{Message: err.Error()}
+		case errors.Is(err, broker.ErrMessageRecalled):
+			return http.StatusConflict, Response{Message: err.Error()}
+		case errors.Is(err, store.ErrDisabled):
+			return http.StatusServiceUnavailable, Response{Message: "按 update_id 更新消息需要启用存储"}
+		default:
+			return http.StatusInternalServerError, Response{Message: "消息推送失败"}
+		}
+	}
 
 	clientCount := h.broker.ClientCount()
-	logger.Info("消息推送成功", "topic", topic, "title", req.Title, "clients", clientCount)
+	resp := Response{Success: true, Clients: clientCount, ID: result.ID}
+	if result.Created {
+		logger.Info("消息推送成功", "topic", topic, "title", msg.Title, "key", msg.Key, "clients", clientCount, "id", result.ID)
+		resp.Message = "消息推送成功"
+	} else {
+		logger.Info("消息已更新", "id", result.ID, "key", msg.Key, "edits", result.Edits, "clients", clientCount)
+		resp.Message = "消息已更新"
+		resp.Updated = true
+		resp.Edits = result.Edits
+	}
+	if result.ID > 0 {
+		if deliveries, err := h.broker.Deliveries(result.ID); err == nil {
+			resp.Deliveries = deliveries
+		}
+	}
+	return http.StatusOK, resp
+}
 
-	// 成功响应
-	h.sendSuccess(w, "消息推送成功", clientCount)
+// normalizeTags 去除标签两端空白，忽略空标签和重复标签
+// 标签在 MQTT 用户属性中以逗号分隔，标签内的逗号被忽略
+func normalizeTags(tags []string) []string {
+	var out []string
+	for _, t := range tags {
+		t = strings.TrimSpace(strings.ReplaceAll(t, ",", ""))
+		if t != "" && !slices.Contains(out, t) {
+			out = append(out, t)
+		}
+	}
+	return out
 }
 
 // topicForPublish 将订阅用主题转为可发布主题（MQTT 禁止向含 #/+ 的主题发布）
+// 共享订阅 $share/<group>/<filter> 取实际过滤器
 func topicForPublish(topic string) string {
 	topic = strings.TrimSpace(topic)
+	if rest, ok := strings.CutPrefix(topic, "$share/"); ok {
+		if _, filter, ok := strings.Cut(rest, "/"); ok {
+			topic = filter
+		}
+	}
 	if i := strings.Index(topic, "#"); i >= 0 {
 		topic = strings.TrimSuffix(strings.TrimSpace(topic[:i]), "/")
 		if topic == "" {
@@ -190,6 +509,24 @@ func topicForPublish(topic string) string {
 	return topic
 }
 
+// setRateLimitHeaders 写入 X-RateLimit-* 响应头，被拒绝时附带 Retry-After
+func setRateLimitHeaders(w http.ResponseWriter, res ratelimit.Result) {
+	if res.Limit == 0 {
+		return
+	}
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+	if !res.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(max(ceilSeconds(res.RetryAfter), 1)))
+	}
+}
+
+// ceilSeconds 向上取整到秒
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
 func (h *WebhookHandler) sendError(w http.ResponseWriter, status int, message string) {
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(Response{Success: false, Message: message})
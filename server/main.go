@@ -8,11 +8,14 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
+	_ "time/tzdata" // 周期消息时区，运行环境可能没有系统时区数据
 
 	"notice-server/broker"
 	"notice-server/config"
 	"notice-server/handlers"
 	"notice-server/logger"
+	"notice-server/ratelimit"
 	"notice-server/store"
 )
 
@@ -53,21 +56,74 @@ func main() {
 	logger.Info("启动 Notice Server...", "version", Version, "build", BuildTime)
 	logger.Info("项目地址", "url", ProjectURL)
 
+	if err := cfg.Validate(); err != nil {
+		logger.Error("配置无效", "error", err)
+		os.Exit(1)
+	}
+
 	// 创建消息存储管理器
 	storeManager := store.NewManager(cfg.Storage.Path, cfg.Storage.Enabled)
 	if storeManager.IsEnabled() {
 		logger.Info("消息存储已启用", "path", cfg.Storage.Path)
 	}
 
+	// 只信任来自可信反向代理的 X-Forwarded-For / X-Real-IP
+	if err := ratelimit.SetTrustedProxies(cfg.HTTP.TrustedProxies); err != nil {
+		logger.Error("HTTP 可信代理配置无效", "error", err)
+		os.Exit(1)
+	}
+	if len(cfg.HTTP.TrustedProxies) > 0 {
+		logger.Info("已配置可信反向代理", "proxies", cfg.HTTP.TrustedProxies)
+	}
+
+	// 认证失败限流，HTTP 与 MQTT 共享，按客户端 IP 统计
+	limiter := ratelimit.New(ratelimit.Config{
+		MaxFailures: cfg.RateLimit.MaxFailures,
+		BlockTime:   time.Duration(cfg.RateLimit.BlockTime) * time.Second,
+		WindowTime:  time.Duration(cfg.RateLimit.WindowTime) * time.Second,
+	})
+
+	// 发布限流，按凭据（Token 或接入端点，MQTT 与 Webhook 共享）和来源 IP 分别计算
+	publishLimit := ratelimit.NewPublishLimiter(
+		ratelimit.ThrottleConfig{
+			Rate:       cfg.RateLimit.CredentialRate,
+			Period:     time.Duration(cfg.RateLimit.CredentialPeriod) * time.Second,
+			Burst:      cfg.RateLimit.CredentialBurst,
+			DailyQuota: cfg.RateLimit.CredentialDailyQuota,
+		},
+		ratelimit.ThrottleConfig{
+			Rate:       cfg.RateLimit.IPRate,
+			Period:     time.Duration(cfg.RateLimit.IPPeriod) * time.Second,
+			Burst:      cfg.RateLimit.IPBurst,
+			DailyQuota: cfg.RateLimit.IPDailyQuota,
+		},
+	)
+
 	// 创建并启动 MQTT Broker
 	brokerCfg := broker.Config{
 		SessionExpiry:  cfg.MQTT.SessionExpiry,
 		MessageExpiry:  cfg.MQTT.MessageExpiry,
 		AuthToken:      cfg.Auth.Token,
+		AdminToken:     cfg.Auth.AdminToken,
 		StorageEnabled: cfg.Storage.Enabled,
 		StoragePath:    cfg.Storage.Path,
+		SysInterval:    cfg.MQTT.SysInterval,
+		PresenceTopic:  cfg.MQTT.PresenceTopic,
+		Bridges:        bridgeConfigs(cfg.MQTT.Bridges),
+		WSPath:         cfg.MQTT.WSPath,
+		PriorityTopics: cfg.Message.PriorityTopics,
+		DedupWindow:    cfg.Message.DedupWindow,
+		DedupSummary:   cfg.Message.DedupSummary,
+		Recurring:      recurringConfigs(cfg.Recurring),
+		Rules:          ruleConfigs(cfg.Rules),
+
+		MaxTitleLength:   cfg.Message.MaxTitleLength,
+		MaxContentLength: cfg.Message.MaxContentLength,
+		MaxPayloadBytes:  cfg.Message.MaxPayloadBytes,
+		StrictJSON:       cfg.Message.StrictJSON,
+		Truncate:         cfg.Message.Truncate,
 	}
-	mqttBroker := broker.New(cfg.MQTT.Topic, brokerCfg, storeManager)
+	mqttBroker := broker.New(cfg.MQTT.Topic, brokerCfg, storeManager, limiter, publishLimit)
 
 	// 日志输出认证状态
 	if cfg.Auth.Generated {
@@ -75,16 +131,58 @@ func main() {
 	} else {
 		logger.Info("认证已启用", "token_length", len(cfg.Auth.Token))
 	}
-	if err := mqttBroker.Start(":"+cfg.MQTT.TCPPort, ":"+cfg.MQTT.WSPort); err != nil {
+	wsAddr := ""
+	if cfg.MQTT.WSPort != "" && cfg.MQTT.WSPort != "0" {
+		wsAddr = ":" + cfg.MQTT.WSPort
+	}
+	if err := mqttBroker.Start(":"+cfg.MQTT.TCPPort, wsAddr); err != nil {
 		logger.Error("MQTT Broker 启动失败", "error", err)
 		os.Exit(1)
 	}
 
 	// 注册 API 路由
-	http.Handle("/webhook", handlers.NewWebhookHandler(mqttBroker, cfg))
+	webhook := handlers.NewWebhookHandler(mqttBroker, cfg, limiter, publishLimit)
+	http.Handle("/webhook", webhook)
+	http.HandleFunc("POST /webhook/batch", webhook.BatchHandler)
+	http.Handle("POST /webhook/github", webhook.GitHandler("github"))
+	http.Handle("POST /webhook/gitlab", webhook.GitHandler("gitlab"))
+	http.Handle("POST /webhook/gitea", webhook.GitHandler("gitea"))
+	alertmanager, err := webhook.AlertmanagerHandler()
+	if err != nil {
+		logger.Error("Alertmanager 接入配置无效", "error", err)
+		os.Exit(1)
+	}
+	http.Handle("POST /webhook/alertmanager", alertmanager)
+	custom, err := webhook.CustomHandler()
+	if err != nil {
+		logger.Error("自定义 Webhook 端点配置无效", "error", err)
+		os.Exit(1)
+	}
+	http.Handle("POST /webhook/custom/{name}", custom)
 	http.HandleFunc("/health", handlers.HealthHandler)
 	http.HandleFunc("/status", handlers.StatusHandler(mqttBroker, storeManager))
-	http.HandleFunc("/messages", handlers.MessagesHandler(storeManager, cfg))
+	http.Handle("/messages", limiter.Protect(handlers.MessagesHandler(storeManager, cfg)))
+	http.Handle("GET /messages/{id}", limiter.Protect(handlers.MessageHandler(storeManager, cfg)))
+	http.Handle("DELETE /messages/{id}", limiter.Protect(handlers.RecallMessageHandler(mqttBroker, cfg)))
+	http.Handle("GET /messages/{id}/deliveries", limiter.Protect(handlers.DeliveriesHandler(mqttBroker, storeManager, cfg)))
+	http.Handle("/clients", limiter.Protect(handlers.ClientsHandler(mqttBroker, cfg)))
+	http.Handle("GET /scheduled", limiter.Protect(handlers.ScheduledHandler(mqttBroker, cfg)))
+	http.Handle("DELETE /scheduled/{id}", limiter.Protect(handlers.CancelScheduledHandler(mqttBroker, cfg)))
+	http.Handle("GET /recurring", limiter.Protect(handlers.RecurringHandler(mqttBroker, cfg)))
+	http.Handle("POST /recurring", limiter.Protect(handlers.SaveRecurringHandler(mqttBroker, cfg)))
+	http.Handle("DELETE /recurring/{name}", limiter.Protect(handlers.DeleteRecurringHandler(mqttBroker, cfg)))
+	http.Handle("POST /rules/test", limiter.Protect(handlers.RulesTestHandler(mqttBroker, cfg)))
+
+	// MQTT over WebSocket 与 HTTP 共用端口，便于单一反向代理或隧道
+	if ws := mqttBroker.WebsocketHandler(); ws != nil {
+		http.Handle(cfg.MQTT.WSPath, ws)
+	}
+
+	// 注册管理接口（需要管理员 Token）
+	http.Handle("POST /clients/{id}/disconnect", limiter.Protect(handlers.DisconnectClientHandler(mqttBroker, cfg)))
+	http.Handle("GET /sessions", limiter.Protect(handlers.SessionsHandler(mqttBroker, cfg)))
+	http.Handle("DELETE /sessions/{id}", limiter.Protect(handlers.ExpireSessionHandler(mqttBroker, cfg)))
+	http.Handle("DELETE /sessions/{id}/queue", limiter.Protect(handlers.PurgeQueueHandler(mqttBroker, cfg)))
 
 	// 注册 Web 页面路由
 	webContent, _ := fs.Sub(webFS, "web")
@@ -115,9 +213,88 @@ func main() {
 	logger.Info("Web 控制台", "url", fmt.Sprintf("http://localhost%s/", addr))
 	logger.Info("Webhook 端点", "url", fmt.Sprintf("POST http://localhost%s/webhook", addr))
 	logger.Info("消息历史", "url", fmt.Sprintf("GET http://localhost%s/messages", addr))
+	if cfg.MQTT.WSPath != "" {
+		logger.Info("MQTT WebSocket", "url", fmt.Sprintf("ws://localhost%s%s", addr, cfg.MQTT.WSPath))
+	}
 
 	if err := http.ListenAndServe(addr, nil); err != nil {
 		logger.Error("HTTP 服务器启动失败", "error", err)
 		os.Exit(1)
 	}
 }
+
+// recurringConfigs 转换周期消息配置
+func recurringConfigs(list []config.RecurringConfig) []broker.RecurringConfig {
+	recurring := make([]broker.RecurringConfig, 0, len(list))
+	for _, c := range list {
+		recurring = append(recurring, broker.RecurringConfig{
+			Name:     c.Name,
+			Cron:     c.Cron,
+			Timezone: c.Timezone,
+			Topic:    c.Topic,
+			Title:    c.Title,
+			Content:  c.Content,
+			Priority: c.Priority,
+			CatchUp:  c.CatchUp,
+		})
+	}
+	return recurring
+}
+
+// bridgeConfigs 转换桥接配置
+func bridgeConfigs(list []config.BridgeConfig) []broker.BridgeConfig {
+	bridges := make([]broker.BridgeConfig, 0, len(list))
+	for _, c := range list {
+		topics := make([]broker.BridgeTopic, 0, len(c.Topics))
+		for _, t := range c.Topics {
+			topics = append(topics, broker.BridgeTopic{
+				Filter:       t.Filter,
+				Direction:    t.Direction,
+				Qos:          t.Qos,
+				LocalPrefix:  t.LocalPrefix,
+				RemotePrefix: t.RemotePrefix,
+			})
+		}
+		bridges = append(bridges, broker.BridgeConfig{
+			Name:            c.Name,
+			Address:         c.Address,
+			TLS:             c.TLS,
+			ClientID:        c.ClientID,
+			Username:        c.Username,
+			Password:        c.Password,
+			ProtocolVersion: c.ProtocolVersion,
+			Keepalive:       c.Keepalive,
+			CleanSession:    c.CleanSession,
+			RetryMin:        c.RetryMin,
+			RetryMax:        c.RetryMax,
+			Topics:          topics,
+		})
+	}
+	return bridges
+}
+
+// ruleConfigs 转换路由规则配置
+func ruleConfigs(list []config.RuleConfig) []broker.RuleConfig {
+	rules := make([]broker.RuleConfig, 0, len(list))
+	for _, c := range list {
+		rules = append(rules, broker.RuleConfig{
+			Name: c.Name,
+			Match: broker.RuleMatch{
+				Topic:      c.Match.Topic,
+				Title:      c.Match.Title,
+				Content:    c.Match.Content,
+				Client:     c.Match.Client,
+				Extra:      c.Match.Extra,
+				IP:         c.Match.IP,
+				Credential: c.Match.Credential,
+			},
+			Topic:    c.Topic,
+			Topics:   c.Topics,
+			Priority: c.Priority,
+			Tags:     c.Tags,
+			Drop:     c.Drop,
+			Continue: c.Continue,
+		})
+	}
+	return rules
+}
@@ -1,9 +1,13 @@
 package ratelimit
 
 import (
+	"fmt"
 	"net"
 	"net/http"
+	"net/netip"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"notice-server/logger"
@@ -175,30 +179,132 @@ func (l *Limiter) cleanup() {
 	}
 }
 
+// trustedProxies 可信反向代理的地址段，由 SetTrustedProxies 设置
+var trustedProxies atomic.Pointer[[]netip.Prefix]
+
+// SetTrustedProxies 设置可信反向代理（IP 或 CIDR）
+// 只有直连地址属于可信代理的请求才读取 X-Forwarded-For / X-Real-IP，未设置时只使用直连地址
+func SetTrustedProxies(list []string) error {
+	var prefixes []netip.Prefix
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		var p netip.Prefix
+		if strings.Contains(s, "/") {
+			parsed, err := netip.ParsePrefix(s)
+			if err != nil {
+				return fmt.Errorf("可信代理地址无效: %s", s)
+			}
+			p = parsed.Masked()
+		} else {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return fmt.Errorf("可信代理地址无效: %s", s)
+			}
+			addr = addr.Unmap()
+			p = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, p)
+	}
+	trustedProxies.Store(&prefixes)
+	return nil
+}
+
+// isTrustedProxy 判断 IP 是否属于可信反向代理
+func isTrustedProxy(ip string) bool {
+	prefixes := trustedProxies.Load()
+	if prefixes == nil || len(*prefixes) == 0 {
+		return false
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range *prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
 // GetClientIP 从请求中获取客户端 IP
+// 代理请求头可被任意调用方伪造，只有直连地址是可信代理时才读取，否则使用直连地址
 func GetClientIP(r *http.Request) string {
-	// 优先使用 X-Forwarded-For（代理场景）
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		// 取第一个 IP
-		if idx := len(xff); idx > 0 {
-			for i, c := range xff {
-				if c == ',' {
-					return xff[:i]
-				}
-			}
-			return xff
+	remote := RemoteIP(r.RemoteAddr)
+	if !isTrustedProxy(remote) {
+		return remote
+	}
+
+	// X-Forwarded-For 由各级代理依次追加，从右向左跳过可信代理，第一个不可信的地址即客户端
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(v, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(ip); err != nil {
+			break
+		}
+		if !isTrustedProxy(ip) {
+			return ip
 		}
 	}
 
 	// 其次使用 X-Real-IP
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
+	if xri := strings.TrimSpace(r.Header.Get("X-Real-IP")); xri != "" {
+		if _, err := netip.ParseAddr(xri); err == nil {
+			return xri
+		}
 	}
 
-	// 最后使用 RemoteAddr
-	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	return remote
+}
+
+// RemoteIP 从 host:port 形式的远端地址中提取 IP（如 MQTT 客户端的 cl.Net.Remote）
+func RemoteIP(addr string) string {
+	ip, _, err := net.SplitHostPort(addr)
 	if err != nil {
-		return r.RemoteAddr
+		return addr
 	}
 	return ip
 }
+
+// Protect 为需要 Token 的 HTTP 接口提供失败限流
+// 已封禁的 IP 直接返回 429；响应 401 记为认证失败，成功响应清除失败记录
+func (l *Limiter) Protect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientIP := GetClientIP(r)
+		if l.IsBlocked(clientIP) {
+			logger.Warn("请求被拒绝，IP 已封禁", "ip", clientIP, "path", r.URL.Path)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"success":false,"message":"请求过于频繁，请稍后再试"}`))
+			return
+		}
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		switch {
+		case sw.status == http.StatusUnauthorized:
+			l.RecordFailure(clientIP)
+		case sw.status < http.StatusBadRequest:
+			l.RecordSuccess(clientIP)
+		}
+	})
+}
+
+// statusWriter 记录响应状态码
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetClientIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []string
+		remote  string
+		xff     []string
+		xri     string
+		want    string
+	}{
+		{"no proxy headers", nil, "203.0.113.7:5000", nil, "", "203.0.113.7"},
+		{"untrusted xff", nil, "203.0.113.7:5000", []string{"1.2.3.4"}, "", "203.0.113.7"},
+		{"untrusted real ip", nil, "203.0.113.7:5000", nil, "1.2.3.4", "203.0.113.7"},
+		{"remote not in trusted", []string{"10.0.0.0/8"}, "203.0.113.7:5000", []string{"1.2.3.4"}, "", "203.0.113.7"},
+		{"trusted xff", []string{"127.0.0.1"}, "127.0.0.1:5000", []string{"1.2.3.4"}, "", "1.2.3.4"},
+		{"rightmost untrusted hop", []string{"127.0.0.1", "10.0.0.0/8"}, "127.0.0.1:5000", []string{"9.9.9.9, 1.2.3.4, 10.0.0.2"}, "", "1.2.3.4"},
+		{"multiple xff headers", []string{"127.0.0.1"}, "127.0.0.1:5000", []string{"9.9.9.9", "1.2.3.4"}, "", "1.2.3.4"},
+		{"invalid hop", []string{"127.0.0.1"}, "127.0.0.1:5000", []string{"unknown"}, "", "127.0.0.1"},
+		{"trusted real ip", []string{"127.0.0.1"}, "127.0.0.1:5000", nil, "1.2.3.4", "1.2.3.4"},
+		{"invalid real ip", []string{"127.0.0.1"}, "127.0.0.1:5000", nil, "bogus", "127.0.0.1"},
+		{"ipv6 proxy", []string{"::1"}, "[::1]:5000", []string{"2001:db8::1"}, "", "2001:db8::1"},
+		{"ipv4 mapped remote", []string{"127.0.0.1"}, "[::ffff:127.0.0.1]:5000", []string{"1.2.3.4"}, "", "1.2.3.4"},
+	}
+
+	defer SetTrustedProxies(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SetTrustedProxies(tt.proxies); err != nil {
+				t.Fatalf("SetTrustedProxies() error = %v", err)
+			}
+			r := httptest.NewRequest("POST", "/webhook", nil)
+			r.RemoteAddr = tt.remote
+			for _, v := range tt.xff {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if tt.xri != "" {
+				r.Header.Set("X-Real-IP", tt.xri)
+			}
+			if got := GetClientIP(r); got != tt.want {
+				t.Errorf("GetClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetTrustedProxiesInvalid(t *testing.T) {
+	defer SetTrustedProxies(nil)
+	for _, s := range []string{"proxy.local", "10.0.0.0/33", "1.2.3"} {
+		if err := SetTrustedProxies([]string{s}); err == nil {
+			t.Errorf("SetTrustedProxies(%q) 期望返回错误", s)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// ThrottleConfig 发布限流配置（令牌桶 + 每日配额）
+type ThrottleConfig struct {
+	Rate       int           // 每个周期允许的消息数，0 表示不限速
+	Period     time.Duration // 周期，默认 1 分钟
+	Burst      int           // 突发容量，默认等于 Rate
+	DailyQuota int           // 每日消息上限，0 表示不限
+}
+
+// Throttle 按 key 限制发布速率
+type Throttle struct {
+	config  ThrottleConfig
+	buckets map[string]*bucket
+	mu      sync.Mutex
+}
+
+type bucket struct {
+	tokens float64   // 当前可用令牌
+	last   time.Time // 上次更新时间
+	day    string    // 配额所属日期
+	used   int       // 当日已用配额
+}
+
+// Result 限流检查结果，用于生成 Retry-After 和 X-RateLimit-* 响应头
+type Result struct {
+	Allowed    bool
+	Limit      int           // 当前生效的上限，0 表示未限制
+	Remaining  int           // 剩余额度
+	Reset      time.Duration // 额度完全恢复所需时间
+	RetryAfter time.Duration // 被拒绝时建议的重试间隔
+	Quota      bool          // 是否因每日配额被拒绝
+}
+
+// NewThrottle 创建发布限流器
+func NewThrottle(cfg ThrottleConfig) *Throttle {
+	if cfg.Period <= 0 {
+		cfg.Period = time.Minute
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = cfg.Rate
+	}
+
+	t := &Throttle{
+		config:  cfg,
+		buckets: make(map[string]*bucket),
+	}
+	if t.Enabled() {
+		go t.cleanup()
+	}
+	return t
+}
+
+// Enabled 是否配置了任何限制
+func (t *Throttle) Enabled() bool {
+	return t.config.Rate > 0 || t.config.DailyQuota > 0
+}
+
+// Allow 检查并消耗一条消息的额度
+func (t *Throttle) Allow(key string) Result {
+	return t.take(key, time.Now())
+}
+
+// take 检查并消耗额度，超出限制时不消耗
+func (t *Throttle) take(key string, now time.Time) Result {
+	if !t.Enabled() {
+		return Result{Allowed: true}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b := t.refill(key, now)
+
+	if t.config.DailyQuota > 0 && b.used >= t.config.DailyQuota {
+		untilTomorrow := nextDay(now).Sub(now)
+		return Result{
+			Limit:      t.config.DailyQuota,
+			Reset:      untilTomorrow,
+			RetryAfter: untilTomorrow,
+			Quota:      true,
+		}
+	}
+	if t.config.Rate > 0 && b.tokens < 1 {
+		return Result{
+			Limit:      t.config.Burst,
+			Reset:      t.refillTime(b.tokens),
+			RetryAfter: time.Duration((1 - b.tokens) / t.ratePerSecond() * float64(time.Second)),
+		}
+	}
+
+	b.used++
+	if t.config.Rate > 0 {
+		b.tokens--
+		return Result{
+			Allowed:   true,
+			Limit:     t.config.Burst,
+			Remaining: int(b.tokens),
+			Reset:     t.refillTime(b.tokens),
+		}
+	}
+	return Result{
+		Allowed:   true,
+		Limit:     t.config.DailyQuota,
+		Remaining: t.config.DailyQuota - b.used,
+		Reset:     nextDay(now).Sub(now),
+	}
+}
+
+// refund 退还一条消息的额度（组合限流中其他维度拒绝时使用）
+func (t *Throttle) refund(key string) {
+	if !t.Enabled() {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b, ok := t.buckets[key]
+	if !ok {
+		return
+	}
+	if b.used > 0 {
+		b.used--
+	}
+	if t.config.Rate > 0 {
+		b.tokens = math.Min(b.tokens+1, float64(t.config.Burst))
+	}
+}
+
+// refill 获取 key 对应的桶并按经过的时间补充令牌，调用方需持有锁
+func (t *Throttle) refill(key string, now time.Time) *bucket {
+	day := now.Format(time.DateOnly)
+	b, ok := t.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(t.config.Burst), last: now, day: day}
+		t.buckets[key] = b
+		return b
+	}
+
+	if t.config.Rate > 0 {
+		elapsed := now.Sub(b.last).Seconds()
+		b.tokens = math.Min(b.tokens+elapsed*t.ratePerSecond(), float64(t.config.Burst))
+	}
+	b.last = now
+	if b.day != day {
+		b.day = day
+		b.used = 0
+	}
+	return b
+}
+
+// refillTime 从当前令牌数补满所需时间
+func (t *Throttle) refillTime(tokens float64) time.Duration {
+	missing := float64(t.config.Burst) - tokens
+	if missing <= 0 {
+		return 0
+	}
+	return time.Duration(missing / t.ratePerSecond() * float64(time.Second))
+}
+
+func (t *Throttle) ratePerSecond() float64 {
+	return float64(t.config.Rate) / t.config.Period.Seconds()
+}
+
+// cleanup 定期清理已补满且不再占用当日配额的桶
+func (t *Throttle) cleanup() {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		now := time.Now()
+		t.mu.Lock()
+		for key := range t.buckets {
+			b := t.refill(key, now)
+			if (t.config.Rate == 0 || b.tokens >= float64(t.config.Burst)) && b.used == 0 {
+				delete(t.buckets, key)
+			}
+		}
+		t.mu.Unlock()
+	}
+}
+
+// nextDay 下一个自然日零点（本地时间）
+func nextDay(now time.Time) time.Time {
+	y, m, d := now.Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, now.Location())
+}
+
+// PublishLimiter 发布限流：同时按凭据和来源 IP 限制，任一维度超限即拒绝
+// 凭据为发布使用的 Token 或接入端点名称（如 token、admin、github、custom/<name>），
+// 同一凭据经 MQTT 和 Webhook 发布的消息共享额度；来源 IP 的限制叠加在凭据限制之上
+type PublishLimiter struct {
+	credential *Throttle
+	ip         *Throttle
+}
+
+// NewPublishLimiter 创建发布限流器
+func NewPublishLimiter(credential, ip ThrottleConfig) *PublishLimiter {
+	return &PublishLimiter{
+		credential: NewThrottle(credential),
+		ip:         NewThrottle(ip),
+	}
+}
+
+// Allow 检查并消耗一条消息的额度，返回更严格的一方的结果
+func (p *PublishLimiter) Allow(credential, ip string) Result {
+	if p == nil {
+		return Result{Allowed: true}
+	}
+	return p.allow(credential, ip, time.Now())
+}
+
+func (p *PublishLimiter) allow(credential, ip string, now time.Time) Result {
+	byCredential := p.credential.take(credential, now)
+	if !byCredential.Allowed {
+		return byCredential
+	}
+	byIP := p.ip.take(ip, now)
+	if !byIP.Allowed {
+		p.credential.refund(credential)
+		return byIP
+	}
+
+	if byCredential.Limit == 0 || (byIP.Limit > 0 && byIP.Remaining < byCredential.Remaining) {
+		return byIP
+	}
+	return byCredential
+}
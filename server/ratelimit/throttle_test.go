@@ -0,0 +1,138 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThrottleTake(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local)
+
+	type step struct {
+		after   time.Duration // 相对 start 的时间
+		allowed bool
+	}
+	tests := []struct {
+		name  string
+		cfg   ThrottleConfig
+		steps []step
+	}{
+		{"disabled", ThrottleConfig{}, []step{{0, true}, {0, true}, {0, true}}},
+		{"burst then reject", ThrottleConfig{Rate: 2, Period: time.Minute}, []step{
+			{0, true}, {0, true}, {0, false},
+		}},
+		{"refill", ThrottleConfig{Rate: 2, Period: time.Minute}, []step{
+			{0, true}, {0, true}, {10 * time.Second, false}, {30 * time.Second, true}, {30 * time.Second, false},
+		}},
+		{"burst larger than rate", ThrottleConfig{Rate: 1, Period: time.Minute, Burst: 3}, []step{
+			{0, true}, {0, true}, {0, true}, {0, false}, {time.Minute, true},
+		}},
+		{"daily quota", ThrottleConfig{DailyQuota: 2}, []step{
+			{0, true}, {time.Hour, true}, {2 * time.Hour, false},
+		}},
+		{"daily quota resets next day", ThrottleConfig{DailyQuota: 1}, []step{
+			{0, true}, {time.Hour, false}, {12 * time.Hour, true}, {13 * time.Hour, false},
+		}},
+		{"rate and quota", ThrottleConfig{Rate: 10, Period: time.Second, DailyQuota: 2}, []step{
+			{0, true}, {time.Second, true}, {time.Minute, false},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			th := NewThrottle(tt.cfg)
+			for i, s := range tt.steps {
+				res := th.take("k", start.Add(s.after))
+				if res.Allowed != s.allowed {
+					t.Errorf("step %d (+%v): allowed = %v, want %v (%+v)", i, s.after, res.Allowed, s.allowed, res)
+				}
+			}
+		})
+	}
+}
+
+func TestThrottleResult(t *testing.T) {
+	now := time.Date(2026, 1, 1, 23, 0, 0, 0, time.Local)
+
+	th := NewThrottle(ThrottleConfig{Rate: 1, Period: time.Minute})
+	if res := th.take("k", now); !res.Allowed || res.Limit != 1 || res.Remaining != 0 || res.Reset != time.Minute {
+		t.Errorf("take() = %+v, want allowed limit 1 remaining 0 reset 1m", res)
+	}
+	res := th.take("k", now.Add(15*time.Second))
+	if res.Allowed || res.Quota || res.RetryAfter != 45*time.Second {
+		t.Errorf("take() = %+v, want rejected retry after 45s", res)
+	}
+
+	quota := NewThrottle(ThrottleConfig{DailyQuota: 1})
+	quota.take("k", now)
+	res = quota.take("k", now)
+	if res.Allowed || !res.Quota || res.RetryAfter != time.Hour {
+		t.Errorf("take() = %+v, want quota rejected retry after 1h", res)
+	}
+}
+
+func TestThrottleRefund(t *testing.T) {
+	now := time.Now()
+	th := NewThrottle(ThrottleConfig{Rate: 1, Period: time.Hour, DailyQuota: 1})
+	if !th.take("k", now).Allowed {
+		t.Fatal("首次 take() 应成功")
+	}
+	th.refund("k")
+	if !th.take("k", now).Allowed {
+		t.Error("退还后 take() 应成功")
+	}
+	if th.take("k", now).Allowed {
+		t.Error("额度用尽后 take() 应被拒绝")
+	}
+}
+
+func TestPublishLimiter(t *testing.T) {
+	now := time.Now()
+
+	t.Run("keyed by credential", func(t *testing.T) {
+		p := NewPublishLimiter(ThrottleConfig{Rate: 1, Period: time.Hour}, ThrottleConfig{})
+		if !p.allow("token", "10.0.0.1", now).Allowed {
+			t.Fatal("token 首条消息应被允许")
+		}
+		if p.allow("token", "10.0.0.2", now).Allowed {
+			t.Error("同一凭据来自不同 IP 或客户端的消息应共享额度")
+		}
+		if !p.allow("admin", "10.0.0.1", now).Allowed {
+			t.Error("其他凭据不应受 token 影响")
+		}
+		if !p.allow("github", "10.0.0.3", now).Allowed {
+			t.Error("接入端点不应受其他凭据影响")
+		}
+		if p.allow("github", "10.0.0.4", now).Allowed {
+			t.Error("同一接入端点来自不同 IP 的请求应共享额度")
+		}
+	})
+
+	t.Run("ip shared across credentials", func(t *testing.T) {
+		p := NewPublishLimiter(ThrottleConfig{}, ThrottleConfig{Rate: 1, Period: time.Hour})
+		if !p.allow("token", "10.0.0.1", now).Allowed {
+			t.Fatal("首条消息应被允许")
+		}
+		if p.allow("github", "10.0.0.1", now).Allowed {
+			t.Error("同一 IP 使用不同凭据发布应共享 IP 额度")
+		}
+	})
+
+	t.Run("ip rejection refunds credential", func(t *testing.T) {
+		p := NewPublishLimiter(ThrottleConfig{Rate: 1, Period: time.Hour}, ThrottleConfig{Rate: 1, Period: time.Hour})
+		p.allow("github", "10.0.0.1", now)
+		if p.allow("token", "10.0.0.1", now).Allowed {
+			t.Fatal("IP 额度用尽时应被拒绝")
+		}
+		if !p.allow("token", "10.0.0.2", now).Allowed {
+			t.Error("被 IP 维度拒绝时不应消耗凭据额度")
+		}
+	})
+
+	t.Run("nil limiter", func(t *testing.T) {
+		var p *PublishLimiter
+		if !p.Allow("x", "y").Allowed {
+			t.Error("nil 限流器应允许所有消息")
+		}
+	})
+}
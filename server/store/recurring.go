@@ -0,0 +1,174 @@
+package store
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// 周期消息来源
+const (
+	RecurringSourceConfig = "config" // 配置文件定义，随配置更新，不能通过接口修改
+	RecurringSourceAPI    = "api"    // 通过接口创建
+)
+
+// Recurring 周期消息定义及运行状态
+type Recurring struct {
+	Name         string    `json:"name"`
+	Cron         string    `json:"cron"`
+	Timezone     string    `json:"timezone,omitempty"`
+	Topic        string    `json:"topic,omitempty"`
+	Title        string    `json:"title,omitempty"` // 标题模板
+	Content      string    `json:"content"`         // 内容模板
+	Extra        any       `json:"extra,omitempty"`
+	Priority     string    `json:"priority,omitempty"`
+	CatchUp      bool      `json:"catch_up"`
+	Source       string    `json:"source"`                 // config / api
+	LastRun      time.Time `json:"last_run,omitzero"`      // 上次执行时间（计划时间）
+	LastID       uint64    `json:"last_id,omitempty"`      // 上次发送的消息 ID
+	SkippedUntil time.Time `json:"skipped_until,omitzero"` // 停机期间错过并跳过的最后一次计划时间
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at,omitzero"`
+}
+
+// recurringKey 周期消息 key: "rec:" + 名称
+func recurringKey(name string) []byte {
+	return []byte("rec:" + name)
+}
+
+// SaveRecurring 保存周期消息（按名称覆盖）
+func (ts *TokenStore) SaveRecurring(r *Recurring) error {
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now()
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return ts.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(recurringKey(r.Name), data)
+	})
+}
+
+// GetRecurring 按名称获取周期消息，不存在时返回 ErrNotFound
+func (ts *TokenStore) GetRecurring(name string) (*Recurring, error) {
+	var r Recurring
+	err := ts.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(recurringKey(name))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &r)
+		})
+	})
+	if err == badger.ErrKeyNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// ListRecurring 获取所有周期消息，按名称排序
+func (ts *TokenStore) ListRecurring() ([]Recurring, error) {
+	list := []Recurring{}
+	err := ts.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte("rec:")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			err := it.Item().Value(func(val []byte) error {
+				var r Recurring
+				if err := json.Unmarshal(val, &r); err != nil {
+					return err
+				}
+				list = append(list, r)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(list, func(a, b Recurring) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return list, nil
+}
+
+// DeleteRecurring 删除周期消息，不存在时返回 ErrNotFound
+func (ts *TokenStore) DeleteRecurring(name string) error {
+	return ts.db.Update(func(txn *badger.Txn) error {
+		key := recurringKey(name)
+		if _, err := txn.Get(key); err != nil {
+			if err == badger.ErrKeyNotFound {
+				return ErrNotFound
+			}
+			return err
+		}
+		return txn.Delete(key)
+	})
+}
+
+// SaveRecurring 保存周期消息（便捷方法）
+func (m *Manager) SaveRecurring(token string, r *Recurring) error {
+	if !m.enabled {
+		return ErrDisabled
+	}
+
+	ts, err := m.GetStore(token)
+	if err != nil {
+		return err
+	}
+	return ts.SaveRecurring(r)
+}
+
+// GetRecurring 获取周期消息（便捷方法）
+func (m *Manager) GetRecurring(token, name string) (*Recurring, error) {
+	if !m.enabled {
+		return nil, ErrNotFound
+	}
+
+	ts, err := m.GetStore(token)
+	if err != nil {
+		return nil, err
+	}
+	return ts.GetRecurring(name)
+}
+
+// ListRecurring 获取所有周期消息（便捷方法）
+func (m *Manager) ListRecurring(token string) ([]Recurring, error) {
+	if !m.enabled {
+		return []Recurring{}, nil
+	}
+
+	ts, err := m.GetStore(token)
+	if err != nil {
+		return nil, err
+	}
+	return ts.ListRecurring()
+}
+
+// DeleteRecurring 删除周期消息（便捷方法）
+func (m *Manager) DeleteRecurring(token, name string) error {
+	if !m.enabled {
+		return ErrNotFound
+	}
+
+	ts, err := m.GetStore(token)
+	if err != nil {
+		return err
+	}
+	return ts.DeleteRecurring(name)
+}
@@ -0,0 +1,189 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// ScheduledMessage 等待定时发送的消息
+type ScheduledMessage struct {
+	ID        uint64    `json:"id"`
+	Topic     string    `json:"topic"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	Extra     any       `json:"extra,omitempty"`
+	Client    string    `json:"client,omitempty"`
+	Priority  string    `json:"priority,omitempty"`
+	GroupKey  string    `json:"group_key,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	Publisher string    `json:"publisher,omitempty"` // 创建定时消息使用的凭据名称
+	SendAt    time.Time `json:"send_at"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// 发布失败后的重试状态
+	Attempts  int        `json:"attempts,omitempty"`   // 已失败的发布次数
+	LastError string     `json:"last_error,omitempty"` // 最近一次失败原因
+	RetryAt   *time.Time `json:"retry_at,omitempty"`   // 下次重试时间
+	Failed    bool       `json:"failed,omitempty"`     // 重试次数用尽，不再发送
+}
+
+// DueAt 下次发送时间：重试中为 RetryAt，否则为 SendAt
+func (sm *ScheduledMessage) DueAt() time.Time {
+	if sm.RetryAt != nil {
+		return *sm.RetryAt
+	}
+	return sm.SendAt
+}
+
+// scheduledKey 定时消息 key: "sch:" + ID
+func scheduledKey(id uint64) []byte {
+	key := make([]byte, 12)
+	copy(key, "sch:")
+	binary.BigEndian.PutUint64(key[4:], id)
+	return key
+}
+
+// SaveScheduled 保存定时消息并分配 ID（与消息历史的 ID 相互独立）
+func (ts *TokenStore) SaveScheduled(sm *ScheduledMessage) error {
+	id, err := ts.schSeq.Next()
+	if err == nil && id == 0 {
+		id, err = ts.schSeq.Next()
+	}
+	if err != nil {
+		return err
+	}
+
+	sm.ID = id
+	if sm.CreatedAt.IsZero() {
+		sm.CreatedAt = time.Now()
+	}
+
+	data, err := json.Marshal(sm)
+	if err != nil {
+		return err
+	}
+	return ts.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(scheduledKey(id), data)
+	})
+}
+
+// ListScheduled 获取所有定时消息，按发送时间排序
+func (ts *TokenStore) ListScheduled() ([]ScheduledMessage, error) {
+	list := []ScheduledMessage{}
+	err := ts.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := []byte("sch:")
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			err := it.Item().Value(func(val []byte) error {
+				var sm ScheduledMessage
+				if err := json.Unmarshal(val, &sm); err != nil {
+					return err
+				}
+				list = append(list, sm)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortStableFunc(list, func(a, b ScheduledMessage) int {
+		return a.SendAt.Compare(b.SendAt)
+	})
+	return list, nil
+}
+
+// UpdateScheduled 更新已有定时消息，不存在（已取消或已发送）时返回 ErrNotFound
+func (ts *TokenStore) UpdateScheduled(sm *ScheduledMessage) error {
+	data, err := json.Marshal(sm)
+	if err != nil {
+		return err
+	}
+	return ts.db.Update(func(txn *badger.Txn) error {
+		key := scheduledKey(sm.ID)
+		if _, err := txn.Get(key); err != nil {
+			if err == badger.ErrKeyNotFound {
+				return ErrNotFound
+			}
+			return err
+		}
+		return txn.Set(key, data)
+	})
+}
+
+// DeleteScheduled 删除定时消息，不存在时返回 ErrNotFound
+func (ts *TokenStore) DeleteScheduled(id uint64) error {
+	return ts.db.Update(func(txn *badger.Txn) error {
+		key := scheduledKey(id)
+		if _, err := txn.Get(key); err != nil {
+			if err == badger.ErrKeyNotFound {
+				return ErrNotFound
+			}
+			return err
+		}
+		return txn.Delete(key)
+	})
+}
+
+// SaveScheduled 保存定时消息（便捷方法）
+func (m *Manager) SaveScheduled(token string, sm *ScheduledMessage) error {
+	if !m.enabled {
+		return ErrDisabled
+	}
+
+	ts, err := m.GetStore(token)
+	if err != nil {
+		return err
+	}
+	return ts.SaveScheduled(sm)
+}
+
+// ListScheduled 获取定时消息（便捷方法）
+func (m *Manager) ListScheduled(token string) ([]ScheduledMessage, error) {
+	if !m.enabled {
+		return []ScheduledMessage{}, nil
+	}
+
+	ts, err := m.GetStore(token)
+	if err != nil {
+		return nil, err
+	}
+	return ts.ListScheduled()
+}
+
+// UpdateScheduled 更新定时消息（便捷方法）
+func (m *Manager) UpdateScheduled(token string, sm *ScheduledMessage) error {
+	if !m.enabled {
+		return ErrNotFound
+	}
+
+	ts, err := m.GetStore(token)
+	if err != nil {
+		return err
+	}
+	return ts.UpdateScheduled(sm)
+}
+
+// DeleteScheduled 删除定时消息（便捷方法）
+func (m *Manager) DeleteScheduled(token string, id uint64) error {
+	if !m.enabled {
+		return ErrNotFound
+	}
+
+	ts, err := m.GetStore(token)
+	if err != nil {
+		return err
+	}
+	return ts.DeleteScheduled(id)
+}
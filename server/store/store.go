@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"errors"
 	"path/filepath"
+	"slices"
 	"sync"
 	"time"
 
@@ -21,6 +22,19 @@ const (
 // ErrTokenCollision token 碰撞错误
 var ErrTokenCollision = errors.New("token 碰撞：该存储目录已被其他 token 占用")
 
+// ErrNotFound 消息不存在
+var ErrNotFound = errors.New("消息不存在")
+
+// ErrDisabled 未启用持久化存储
+var ErrDisabled = errors.New("未启用持久化存储")
+
+// 投递状态
+const (
+	DeliveryQueued    = "queued"    // 已下发（或进入离线队列），等待客户端确认
+	DeliveryDelivered = "delivered" // 客户端已确认接收
+	DeliveryDropped   = "dropped"   // 未送达即被丢弃（过期、被清除等）
+)
+
 // Message 存储的消息结构
 type Message struct {
 	ID        uint64    `json:"id"`
@@ -28,7 +42,77 @@ type Message struct {
 	Title     string    `json:"title"`
 	Content   string    `json:"content"`
 	Extra     any       `json:"extra,omitempty"`
+	Priority  string    `json:"priority,omitempty"`  // 优先级，默认优先级为空
+	GroupKey  string    `json:"group_key,omitempty"` // 去重分组键
+	Tags      []string  `json:"tags,omitempty"`      // 标签
+	Publisher string    `json:"publisher,omitempty"` // 发布使用的凭据名称（如 token、github），用于撤回时校验权限
 	Timestamp time.Time `json:"timestamp"`
+
+	Repeats    int       `json:"repeats,omitempty"`    // 去重窗口内被合并的重复次数（不含首次）
+	RepeatedAt time.Time `json:"repeated_at,omitzero"` // 最近一次重复的时间
+
+	Key       string    `json:"key,omitempty"`       // 发送方指定的稳定标识，可据此更新消息
+	Edits     []Edit    `json:"edits,omitempty"`     // 编辑历史（从旧到新），最多保留 MaxEdits 条
+	UpdatedAt time.Time `json:"updated_at,omitzero"` // 最近一次编辑的时间
+
+	RecalledAt time.Time `json:"recalled_at,omitzero"` // 撤回时间，未撤回为零值
+}
+
+// Recalled 消息是否已被撤回
+func (m *Message) Recalled() bool {
+	return !m.RecalledAt.IsZero()
+}
+
+// MaxEdits 每条消息保留的编辑历史条数
+const MaxEdits = 20
+
+// Edit 消息被编辑前的版本
+type Edit struct {
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	Extra     any       `json:"extra,omitempty"`
+	Priority  string    `json:"priority,omitempty"`
+	Timestamp time.Time `json:"timestamp"` // 该版本的发布时间
+}
+
+// ApplyEdit 用新的标题和内容替换消息，原版本追加到编辑历史
+// title 为空时保留原标题，extra、priority 为 nil 时保留原值（priority 指向空字符串表示恢复默认优先级）
+func (m *Message) ApplyEdit(title, content string, extra any, priority *string, now time.Time) {
+	since := m.Timestamp
+	if !m.UpdatedAt.IsZero() {
+		since = m.UpdatedAt
+	}
+	m.Edits = append(m.Edits, Edit{
+		Title:     m.Title,
+		Content:   m.Content,
+		Extra:     m.Extra,
+		Priority:  m.Priority,
+		Timestamp: since,
+	})
+	if len(m.Edits) > MaxEdits {
+		m.Edits = slices.Delete(m.Edits, 0, len(m.Edits)-MaxEdits)
+	}
+
+	if title != "" {
+		m.Title = title
+	}
+	m.Content = content
+	if extra != nil {
+		m.Extra = extra
+	}
+	if priority != nil {
+		m.Priority = *priority
+	}
+	m.UpdatedAt = now
+}
+
+// Delivery 消息对单个客户端的投递回执
+type Delivery struct {
+	ClientID    string     `json:"client_id"`
+	Status      string     `json:"status"` // queued / delivered / dropped
+	QueuedAt    time.Time  `json:"queued_at"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+	DroppedAt   *time.Time `json:"dropped_at,omitempty"`
 }
 
 // CursorResult 游标分页结果
@@ -61,11 +145,13 @@ func tokenPath(basePath, hash string) string {
 
 // TokenStore 单个 token 的消息存储
 type TokenStore struct {
-	db    *badger.DB
-	seq   *badger.Sequence
-	token string // 存储原始 token，用于验证
-	count uint64
-	mu    sync.RWMutex
+	db     *badger.DB
+	seq    *badger.Sequence
+	schSeq *badger.Sequence // 定时消息 ID
+	token  string           // 存储原始 token，用于验证
+	count  uint64
+	mu     sync.RWMutex
+	umu    sync.Mutex // 串行化消息的读改写，避免并发修改同一条消息时事务冲突
 }
 
 // newTokenStore 创建单个 token 的存储
@@ -114,11 +200,18 @@ func newTokenStore(path string, token string) (*TokenStore, error) {
 		db.Close()
 		return nil, err
 	}
+	schSeq, err := db.GetSequence([]byte("seq:sch"), 10)
+	if err != nil {
+		seq.Release()
+		db.Close()
+		return nil, err
+	}
 
 	ts := &TokenStore{
-		db:    db,
-		seq:   seq,
-		token: token,
+		db:     db,
+		seq:    seq,
+		schSeq: schSeq,
+		token:  token,
 	}
 	ts.loadCount()
 
@@ -180,21 +273,49 @@ func (ts *TokenStore) makeKey(id uint64) []byte {
 	return key
 }
 
+// keyIndex 消息 Key 索引: "key:" + Key -> 消息 ID
+func (ts *TokenStore) keyIndex(key string) []byte {
+	return []byte("key:" + key)
+}
+
+// deliveryPrefix 某条消息的投递回执 key 前缀: "dlv:" + 消息 ID
+func (ts *TokenStore) deliveryPrefix(id uint64) []byte {
+	key := make([]byte, 12)
+	copy(key, "dlv:")
+	binary.BigEndian.PutUint64(key[4:], id)
+	return key
+}
+
+// nextID 获取下一个消息 ID
+// 跳过 0：0 在游标分页中表示"从最新开始"，不能作为消息 ID
+// 旧版本新建存储的第一条消息 ID 为 0，升级后已有消息 ID 不变，新消息从当前序列继续
+func (ts *TokenStore) nextID() (uint64, error) {
+	id, err := ts.seq.Next()
+	if err == nil && id == 0 {
+		id, err = ts.seq.Next()
+	}
+	return id, err
+}
+
 // Save 保存消息
 func (ts *TokenStore) Save(topic, title, content string, extra any) (*Message, error) {
-	id, err := ts.seq.Next()
+	return ts.SaveMessage(&Message{
+		Topic:   topic,
+		Title:   title,
+		Content: content,
+		Extra:   extra,
+	})
+}
+
+// SaveMessage 保存消息，分配 ID 和时间戳后返回 msg
+func (ts *TokenStore) SaveMessage(msg *Message) (*Message, error) {
+	id, err := ts.nextID()
 	if err != nil {
 		return nil, err
 	}
 
-	msg := &Message{
-		ID:        id,
-		Topic:     topic,
-		Title:     title,
-		Content:   content,
-		Extra:     extra,
-		Timestamp: time.Now(),
-	}
+	msg.ID = id
+	msg.Timestamp = time.Now()
 
 	data, err := json.Marshal(msg)
 	if err != nil {
@@ -202,6 +323,13 @@ func (ts *TokenStore) Save(topic, title, content string, extra any) (*Message, e
 	}
 
 	err = ts.db.Update(func(txn *badger.Txn) error {
+		if msg.Key != "" {
+			buf := make([]byte, 8)
+			binary.BigEndian.PutUint64(buf, id)
+			if err := txn.Set(ts.keyIndex(msg.Key), buf); err != nil {
+				return err
+			}
+		}
 		return txn.Set(ts.makeKey(id), data)
 	})
 	if err != nil {
@@ -220,6 +348,235 @@ func (ts *TokenStore) Save(topic, title, content string, extra any) (*Message, e
 	return msg, nil
 }
 
+// SaveMessages 以一次批量写入保存多条消息，分配连续的 ID 和时间戳
+func (ts *TokenStore) SaveMessages(msgs []*Message) ([]*Message, error) {
+	if len(msgs) == 0 {
+		return msgs, nil
+	}
+
+	now := time.Now()
+	wb := ts.db.NewWriteBatch()
+	defer wb.Cancel()
+	for _, msg := range msgs {
+		id, err := ts.nextID()
+		if err != nil {
+			return nil, err
+		}
+		msg.ID = id
+		msg.Timestamp = now
+
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return nil, err
+		}
+		if msg.Key != "" {
+			buf := make([]byte, 8)
+			binary.BigEndian.PutUint64(buf, id)
+			if err := wb.Set(ts.keyIndex(msg.Key), buf); err != nil {
+				return nil, err
+			}
+		}
+		if err := wb.Set(ts.makeKey(id), data); err != nil {
+			return nil, err
+		}
+	}
+	if err := wb.Flush(); err != nil {
+		return nil, err
+	}
+
+	n := uint64(len(msgs))
+	ts.mu.Lock()
+	ts.count += n
+	count := ts.count
+	ts.mu.Unlock()
+
+	if count/100 != (count-n)/100 {
+		go ts.saveCount()
+	}
+
+	return msgs, nil
+}
+
+// Get 按 ID 获取消息
+func (ts *TokenStore) Get(id uint64) (*Message, error) {
+	var msg Message
+	err := ts.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(ts.makeKey(id))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &msg)
+		})
+	})
+	if err == badger.ErrKeyNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// GetByKey 按 Key 获取最近一条使用该 Key 的消息
+func (ts *TokenStore) GetByKey(key string) (*Message, error) {
+	var id uint64
+	err := ts.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(ts.keyIndex(key))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			if len(val) == 8 {
+				id = binary.BigEndian.Uint64(val)
+			}
+			return nil
+		})
+	})
+	if err == badger.ErrKeyNotFound || (err == nil && id == 0) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ts.Get(id)
+}
+
+// Update 在事务中修改消息，不存在时返回 ErrNotFound
+// 修改串行进行；与其他写入冲突时重新读取并重试，fn 可能被调用多次
+func (ts *TokenStore) Update(id uint64, fn func(m *Message)) (*Message, error) {
+	ts.umu.Lock()
+	defer ts.umu.Unlock()
+
+	var msg Message
+	err := updateRetry(ts.db, func(txn *badger.Txn) error {
+		msg = Message{}
+		key := ts.makeKey(id)
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+		if err := item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &msg)
+		}); err != nil {
+			return err
+		}
+
+		fn(&msg)
+
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		return txn.Set(key, data)
+	})
+	if err == badger.ErrKeyNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// maxTxnRetries 读改写事务与并发事务冲突时的最大重试次数
+const maxTxnRetries = 10
+
+// updateRetry 执行读改写事务，因并发写入同一 key 失败（badger.ErrConflict）时重新执行
+func updateRetry(db *badger.DB, fn func(txn *badger.Txn) error) error {
+	for i := 0; ; i++ {
+		err := db.Update(fn)
+		if !errors.Is(err, badger.ErrConflict) || i == maxTxnRetries {
+			return err
+		}
+	}
+}
+
+// DeliveryUpdate 一次投递回执更新
+type DeliveryUpdate struct {
+	ID       uint64 // 消息 ID
+	ClientID string
+	Apply    func(d *Delivery)
+}
+
+// maxDeliveryBatch 单个事务中写入的投递回执数
+const maxDeliveryBatch = 256
+
+// UpdateDelivery 更新消息对某客户端的投递回执，不存在则创建
+func (ts *TokenStore) UpdateDelivery(id uint64, clientID string, fn func(d *Delivery)) error {
+	return ts.UpdateDeliveries([]DeliveryUpdate{{ID: id, ClientID: clientID, Apply: fn}})
+}
+
+// UpdateDeliveries 按顺序批量更新投递回执，每 maxDeliveryBatch 条一个事务
+func (ts *TokenStore) UpdateDeliveries(updates []DeliveryUpdate) error {
+	for len(updates) > 0 {
+		n := min(len(updates), maxDeliveryBatch)
+		if err := updateRetry(ts.db, func(txn *badger.Txn) error {
+			for _, u := range updates[:n] {
+				if err := updateDelivery(txn, append(ts.deliveryPrefix(u.ID), u.ClientID...), u); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		updates = updates[n:]
+	}
+	return nil
+}
+
+// updateDelivery 在事务中读取、修改并写回一条投递回执
+func updateDelivery(txn *badger.Txn, key []byte, u DeliveryUpdate) error {
+	d := Delivery{ClientID: u.ClientID}
+	item, err := txn.Get(key)
+	if err == nil {
+		err = item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &d)
+		})
+	}
+	if err != nil && err != badger.ErrKeyNotFound {
+		return err
+	}
+
+	u.Apply(&d)
+
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return txn.Set(key, data)
+}
+
+// Deliveries 获取消息的所有投递回执，按 Client ID 排序
+func (ts *TokenStore) Deliveries(id uint64) ([]Delivery, error) {
+	deliveries := []Delivery{}
+	err := ts.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.DefaultIteratorOptions)
+		defer it.Close()
+
+		prefix := ts.deliveryPrefix(id)
+		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+			err := it.Item().Value(func(val []byte) error {
+				var d Delivery
+				if err := json.Unmarshal(val, &d); err != nil {
+					return err
+				}
+				deliveries = append(deliveries, d)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
 // List 游标分页查询
 func (ts *TokenStore) List(beforeID uint64, pageSize int) (*CursorResult, error) {
 	if pageSize < 1 {
@@ -295,6 +652,53 @@ func (ts *TokenStore) List(beforeID uint64, pageSize int) (*CursorResult, error)
 	}, nil
 }
 
+// Recent 从最新的消息开始向前查找，返回最多 n 条主题匹配的消息（按时间从旧到新）
+// 最多检查 scanLimit 条消息，避免在大量不匹配的历史中长时间扫描，0 表示不限
+func (ts *TokenStore) Recent(n, scanLimit int, match func(topic string) bool) ([]Message, error) {
+	if n < 1 {
+		return nil, nil
+	}
+
+	var messages []Message
+	err := ts.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Reverse = true
+
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		prefix := []byte("msg:")
+		scanned := 0
+		for it.Seek(append(prefix, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF)); it.ValidForPrefix(prefix); it.Next() {
+			if len(messages) >= n || (scanLimit > 0 && scanned >= scanLimit) {
+				break
+			}
+			scanned++
+
+			err := it.Item().Value(func(val []byte) error {
+				var msg Message
+				if err := json.Unmarshal(val, &msg); err != nil {
+					return err
+				}
+				if match == nil || match(msg.Topic) {
+					messages = append(messages, msg)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Reverse(messages)
+	return messages, nil
+}
+
 // Count 获取消息总数
 func (ts *TokenStore) Count() int {
 	ts.mu.RLock()
@@ -307,6 +711,9 @@ func (ts *TokenStore) Close() error {
 	if ts.seq != nil {
 		ts.seq.Release()
 	}
+	if ts.schSeq != nil {
+		ts.schSeq.Release()
+	}
 	ts.saveCount()
 	if ts.db != nil {
 		return ts.db.Close()
@@ -385,6 +792,40 @@ func (m *Manager) Save(token, topic, title, content string, extra any) (*Message
 	return ts.Save(topic, title, content, extra)
 }
 
+// SaveMessage 保存消息（便捷方法）
+func (m *Manager) SaveMessage(token string, msg *Message) (*Message, error) {
+	if !m.enabled {
+		return nil, nil
+	}
+
+	ts, err := m.GetStore(token)
+	if err != nil {
+		return nil, err
+	}
+	if ts == nil {
+		return nil, nil
+	}
+
+	return ts.SaveMessage(msg)
+}
+
+// SaveMessages 批量保存消息（便捷方法）
+func (m *Manager) SaveMessages(token string, msgs []*Message) ([]*Message, error) {
+	if !m.enabled {
+		return nil, nil
+	}
+
+	ts, err := m.GetStore(token)
+	if err != nil {
+		return nil, err
+	}
+	if ts == nil {
+		return nil, nil
+	}
+
+	return ts.SaveMessages(msgs)
+}
+
 // List 查询消息（便捷方法）
 func (m *Manager) List(token string, beforeID uint64, pageSize int) (*CursorResult, error) {
 	if !m.enabled {
@@ -408,6 +849,100 @@ func (m *Manager) List(token string, beforeID uint64, pageSize int) (*CursorResu
 	return ts.List(beforeID, pageSize)
 }
 
+// Recent 查询最近的匹配消息（便捷方法）
+func (m *Manager) Recent(token string, n, scanLimit int, match func(topic string) bool) ([]Message, error) {
+	if !m.enabled {
+		return nil, nil
+	}
+
+	ts, err := m.GetStore(token)
+	if err != nil {
+		return nil, err
+	}
+	if ts == nil {
+		return nil, nil
+	}
+	return ts.Recent(n, scanLimit, match)
+}
+
+// Get 按 ID 获取消息（便捷方法）
+func (m *Manager) Get(token string, id uint64) (*Message, error) {
+	if !m.enabled {
+		return nil, ErrNotFound
+	}
+
+	ts, err := m.GetStore(token)
+	if err != nil {
+		return nil, err
+	}
+	return ts.Get(id)
+}
+
+// GetByKey 按 Key 获取消息（便捷方法）
+func (m *Manager) GetByKey(token, key string) (*Message, error) {
+	if !m.enabled {
+		return nil, ErrNotFound
+	}
+
+	ts, err := m.GetStore(token)
+	if err != nil {
+		return nil, err
+	}
+	return ts.GetByKey(key)
+}
+
+// Update 修改消息（便捷方法）
+func (m *Manager) Update(token string, id uint64, fn func(m *Message)) (*Message, error) {
+	if !m.enabled {
+		return nil, ErrNotFound
+	}
+
+	ts, err := m.GetStore(token)
+	if err != nil {
+		return nil, err
+	}
+	return ts.Update(id, fn)
+}
+
+// UpdateDelivery 更新投递回执（便捷方法）
+func (m *Manager) UpdateDelivery(token string, id uint64, clientID string, fn func(d *Delivery)) error {
+	if !m.enabled {
+		return nil
+	}
+
+	ts, err := m.GetStore(token)
+	if err != nil {
+		return err
+	}
+	return ts.UpdateDelivery(id, clientID, fn)
+}
+
+// UpdateDeliveries 批量更新投递回执（便捷方法）
+func (m *Manager) UpdateDeliveries(token string, updates []DeliveryUpdate) error {
+	if !m.enabled {
+		return nil
+	}
+
+	ts, err := m.GetStore(token)
+	if err != nil {
+		return err
+	}
+	return ts.UpdateDeliveries(updates)
+}
+
+// Deliveries 获取投递回执（便捷方法）
+func (m *Manager) Deliveries(token string, id uint64) ([]Delivery, error) {
+	if !m.enabled {
+		return []Delivery{}, nil
+	}
+
+	ts, err := m.GetStore(token)
+	if err != nil {
+		return nil, err
+	}
+	return ts.Deliveries(id)
+}
+
 // Count 获取消息总数（便捷方法）
 func (m *Manager) Count(token string) int {
 	if !m.enabled {
@@ -425,6 +960,22 @@ func (m *Manager) Count(token string) int {
 	return ts.Count()
 }
 
+// Stats 获取已加载存储的消息数，key 为 token hash（即租户标识）
+func (m *Manager) Stats() map[string]int {
+	stats := make(map[string]int)
+	if !m.enabled {
+		return stats
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for hash, ts := range m.stores {
+		stats[hash] = ts.Count()
+	}
+	return stats
+}
+
 // Close 关闭所有存储
 func (m *Manager) Close() error {
 	m.mu.Lock()
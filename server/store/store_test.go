@@ -3,7 +3,10 @@ package store
 import (
 	"os"
 	"path/filepath"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestTokenHash(t *testing.T) {
@@ -385,3 +388,564 @@ func TestManagerConcurrent(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenStoreGet(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "store-get-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ts, err := newTokenStore(tmpDir, "test-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Close()
+
+	msg, err := ts.Save("topic", "标题", "内容", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ID 0 在游标分页中有特殊含义，不应分配给消息
+	if msg.ID == 0 {
+		t.Error("消息 ID 不应为 0")
+	}
+
+	got, err := ts.Get(msg.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "标题" || got.Content != "内容" {
+		t.Errorf("Get 返回的消息不匹配: %+v", got)
+	}
+
+	if _, err := ts.Get(msg.ID + 1000); err != ErrNotFound {
+		t.Errorf("不存在的消息应返回 ErrNotFound，实际: %v", err)
+	}
+}
+
+func TestTokenStoreDeliveries(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "store-delivery-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ts, err := newTokenStore(tmpDir, "test-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Close()
+
+	msg1, _ := ts.Save("topic", "标题1", "内容", nil)
+	msg2, _ := ts.Save("topic", "标题2", "内容", nil)
+
+	queued := func(d *Delivery) {
+		d.Status = DeliveryQueued
+		d.QueuedAt = time.Now()
+	}
+	for _, id := range []string{"phone-b", "phone-a"} {
+		if err := ts.UpdateDelivery(msg1.ID, id, queued); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ts.UpdateDelivery(msg2.ID, "phone-c", queued); err != nil {
+		t.Fatal(err)
+	}
+
+	// 更新已有回执
+	err = ts.UpdateDelivery(msg1.ID, "phone-a", func(d *Delivery) {
+		now := time.Now()
+		d.Status = DeliveryDelivered
+		d.DeliveredAt = &now
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries, err := ts.Deliveries(msg1.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 2 {
+		t.Fatalf("消息 1 应有 2 条回执，实际: %d", len(deliveries))
+	}
+	// 按 Client ID 排序
+	if deliveries[0].ClientID != "phone-a" || deliveries[1].ClientID != "phone-b" {
+		t.Errorf("回执顺序不正确: %s, %s", deliveries[0].ClientID, deliveries[1].ClientID)
+	}
+	if deliveries[0].Status != DeliveryDelivered || deliveries[0].DeliveredAt == nil {
+		t.Errorf("phone-a 应为已送达: %+v", deliveries[0])
+	}
+	if deliveries[0].QueuedAt.IsZero() {
+		t.Error("更新回执时应保留 queued_at")
+	}
+	if deliveries[1].Status != DeliveryQueued {
+		t.Errorf("phone-b 应为 queued，实际: %s", deliveries[1].Status)
+	}
+
+	// 回执不计入消息数
+	if ts.Count() != 2 {
+		t.Errorf("消息数应为 2，实际: %d", ts.Count())
+	}
+}
+
+func TestTokenStoreUpdateDeliveries(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "store-delivery-batch-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ts, err := newTokenStore(tmpDir, "test-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Close()
+
+	msg, _ := ts.Save("topic", "标题", "内容", nil)
+
+	// 超过单个事务的条数，同一客户端的多次更新按顺序生效
+	var updates []DeliveryUpdate
+	for i := range maxDeliveryBatch + 10 {
+		updates = append(updates, DeliveryUpdate{
+			ID:       msg.ID,
+			ClientID: "client-" + strconv.Itoa(i),
+			Apply:    func(d *Delivery) { d.Status = DeliveryQueued },
+		})
+	}
+	updates = append(updates,
+		DeliveryUpdate{ID: msg.ID, ClientID: "phone", Apply: func(d *Delivery) { d.Status = DeliveryQueued }},
+		DeliveryUpdate{ID: msg.ID, ClientID: "phone", Apply: func(d *Delivery) {
+			if d.Status == DeliveryQueued {
+				d.Status = DeliveryDelivered
+			}
+		}},
+	)
+	if err := ts.UpdateDeliveries(updates); err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries, err := ts.Deliveries(msg.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != maxDeliveryBatch+11 {
+		t.Fatalf("应有 %d 条回执，实际: %d", maxDeliveryBatch+11, len(deliveries))
+	}
+	for _, d := range deliveries {
+		if d.ClientID == "phone" && d.Status != DeliveryDelivered {
+			t.Errorf("同一批次中的后续更新应读取到之前的结果，实际: %s", d.Status)
+		}
+	}
+}
+
+func TestTokenStoreRecent(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "store-recent-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ts, err := newTokenStore(tmpDir, "test-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Close()
+
+	for i := 1; i <= 6; i++ {
+		topic := "notice"
+		if i%2 == 0 {
+			topic = "other"
+		}
+		if _, err := ts.Save(topic, "", strconv.Itoa(i), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	onlyNotice := func(topic string) bool { return topic == "notice" }
+
+	// 最近 2 条匹配消息，按时间从旧到新
+	msgs, err := ts.Recent(2, 0, onlyNotice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[0].Content != "3" || msgs[1].Content != "5" {
+		t.Errorf("Recent(2) = %+v, want contents [3 5]", msgs)
+	}
+
+	// 扫描上限：只检查最新的 3 条（6、5、4），其中匹配的只有 5
+	msgs, err = ts.Recent(10, 3, onlyNotice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || msgs[0].Content != "5" {
+		t.Errorf("Recent(10, 3) = %+v, want contents [5]", msgs)
+	}
+
+	// 不过滤
+	msgs, err = ts.Recent(100, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 6 {
+		t.Errorf("Recent(100) 返回 %d 条，want 6", len(msgs))
+	}
+}
+
+func TestTokenStoreScheduled(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "store-scheduled-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ts, err := newTokenStore(tmpDir, "test-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	later := &ScheduledMessage{Topic: "notice", Content: "later", SendAt: now.Add(2 * time.Hour)}
+	sooner := &ScheduledMessage{Topic: "notice", Content: "sooner", SendAt: now.Add(time.Hour)}
+	for _, sm := range []*ScheduledMessage{later, sooner} {
+		if err := ts.SaveScheduled(sm); err != nil {
+			t.Fatal(err)
+		}
+		if sm.ID == 0 {
+			t.Error("定时消息 ID 不应为 0")
+		}
+	}
+	if later.ID == sooner.ID {
+		t.Errorf("定时消息 ID 重复: %d", later.ID)
+	}
+
+	// 定时消息不计入消息历史
+	if ts.Count() != 0 {
+		t.Errorf("Count() = %d, want 0", ts.Count())
+	}
+
+	// 按发送时间排序
+	list, err := ts.ListScheduled()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Content != "sooner" || list[1].Content != "later" {
+		t.Errorf("ListScheduled() = %+v, want [sooner later]", list)
+	}
+
+	if err := ts.DeleteScheduled(sooner.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.DeleteScheduled(sooner.ID); err != ErrNotFound {
+		t.Errorf("重复删除应返回 ErrNotFound，实际: %v", err)
+	}
+
+	// 重启后保留
+	ts.Close()
+	ts, err = newTokenStore(tmpDir, "test-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Close()
+
+	list, err = ts.ListScheduled()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].ID != later.ID {
+		t.Errorf("重启后 ListScheduled() = %+v, want [later]", list)
+	}
+}
+
+func TestTokenStoreRecurring(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "store-recurring-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ts, err := newTokenStore(tmpDir, "test-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"weekly", "daily"} {
+		r := &Recurring{Name: name, Cron: "@daily", Content: name, Source: RecurringSourceAPI}
+		if err := ts.SaveRecurring(r); err != nil {
+			t.Fatal(err)
+		}
+		if r.CreatedAt.IsZero() {
+			t.Error("CreatedAt 应自动填充")
+		}
+	}
+
+	// 按名称覆盖并保留执行状态
+	lastRun := time.Now().Truncate(time.Second)
+	r, err := ts.GetRecurring("daily")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.LastRun = lastRun
+	r.LastID = 42
+	if err := ts.SaveRecurring(r); err != nil {
+		t.Fatal(err)
+	}
+
+	// 周期消息不计入消息历史
+	if ts.Count() != 0 {
+		t.Errorf("Count() = %d, want 0", ts.Count())
+	}
+
+	if _, err := ts.GetRecurring("missing"); err != ErrNotFound {
+		t.Errorf("GetRecurring(missing) 应返回 ErrNotFound，实际: %v", err)
+	}
+	if err := ts.DeleteRecurring("weekly"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ts.DeleteRecurring("weekly"); err != ErrNotFound {
+		t.Errorf("重复删除应返回 ErrNotFound，实际: %v", err)
+	}
+
+	// 重启后保留
+	ts.Close()
+	ts, err = newTokenStore(tmpDir, "test-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Close()
+
+	list, err := ts.ListRecurring()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Name != "daily" {
+		t.Fatalf("ListRecurring() = %+v, want [daily]", list)
+	}
+	if !list[0].LastRun.Equal(lastRun) || list[0].LastID != 42 {
+		t.Errorf("执行状态未保留: last_run=%v last_id=%d", list[0].LastRun, list[0].LastID)
+	}
+}
+
+func TestTokenStoreUpdate(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "store-update-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ts, err := newTokenStore(tmpDir, "test-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Close()
+
+	saved, err := ts.SaveMessage(&Message{Topic: "notice", Content: "disk 91%", GroupKey: "disk", Priority: "high"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		if _, err := ts.Update(saved.ID, func(m *Message) { m.Repeats = i }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := ts.Get(saved.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Repeats != 3 || got.GroupKey != "disk" || got.Priority != "high" || got.Content != "disk 91%" {
+		t.Errorf("Update 后消息不符: %+v", got)
+	}
+	if ts.Count() != 1 {
+		t.Errorf("Update 不应改变消息计数: %d", ts.Count())
+	}
+
+	if _, err := ts.Update(saved.ID+100, func(m *Message) {}); err != ErrNotFound {
+		t.Errorf("更新不存在的消息应返回 ErrNotFound，实际: %v", err)
+	}
+}
+
+func TestTokenStoreUpdateConcurrent(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "store-update-concurrent-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ts, err := newTokenStore(tmpDir, "test-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Close()
+
+	saved, err := ts.SaveMessage(&Message{Topic: "notice", Content: "disk 91%"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 并发修改同一条消息，冲突的事务重试后每次修改都应生效
+	const n = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ts.Update(saved.ID, func(m *Message) { m.Repeats++ }); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Update() error = %v", err)
+	}
+
+	got, err := ts.Get(saved.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Repeats != n {
+		t.Errorf("重复次数 = %d，期望 %d", got.Repeats, n)
+	}
+}
+
+func TestTokenStoreEdit(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "store-edit-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ts, err := newTokenStore(tmpDir, "test-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Close()
+
+	saved, err := ts.SaveMessage(&Message{Topic: "notice", Title: "备份", Content: "started", Key: "backup-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ts.GetByKey("backup-1")
+	if err != nil || got.ID != saved.ID {
+		t.Fatalf("GetByKey = %+v, %v", got, err)
+	}
+	if _, err := ts.GetByKey("missing"); err != ErrNotFound {
+		t.Errorf("不存在的 Key 应返回 ErrNotFound，实际: %v", err)
+	}
+
+	for _, content := range []string{"50%", "done"} {
+		if _, err := ts.Update(saved.ID, func(m *Message) {
+			m.ApplyEdit("", content, nil, nil, time.Now())
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err = ts.Get(saved.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "备份" || got.Content != "done" || got.UpdatedAt.IsZero() {
+		t.Errorf("编辑后消息不符: %+v", got)
+	}
+	if len(got.Edits) != 2 || got.Edits[0].Content != "started" || got.Edits[1].Content != "50%" {
+		t.Errorf("编辑历史不符: %+v", got.Edits)
+	}
+	if ts.Count() != 1 {
+		t.Errorf("编辑不应改变消息计数: %d", ts.Count())
+	}
+
+	// 编辑历史只保留最近 MaxEdits 条
+	for i := range MaxEdits + 5 {
+		if _, err := ts.Update(saved.ID, func(m *Message) {
+			m.ApplyEdit("", strconv.Itoa(i), nil, nil, time.Now())
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, _ = ts.Get(saved.ID)
+	if len(got.Edits) != MaxEdits || got.Edits[MaxEdits-1].Content != strconv.Itoa(MaxEdits+3) {
+		t.Errorf("编辑历史应保留最近 %d 条，实际 %d 条，最后一条 %q", MaxEdits, len(got.Edits), got.Edits[len(got.Edits)-1].Content)
+	}
+}
+
+func TestMessageApplyEditPriority(t *testing.T) {
+	high, def := "high", ""
+	tests := []struct {
+		name     string
+		priority *string
+		want     string
+	}{
+		{"未指定时保留", nil, "urgent"},
+		{"恢复默认优先级", &def, ""},
+		{"修改优先级", &high, "high"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Message{Title: "部署", Content: "started", Priority: "urgent"}
+			m.ApplyEdit("", "done", nil, tt.priority, time.Now())
+			if m.Priority != tt.want {
+				t.Errorf("Priority = %q, 期望 %q", m.Priority, tt.want)
+			}
+			if len(m.Edits) != 1 || m.Edits[0].Priority != "urgent" {
+				t.Errorf("编辑历史应保留原优先级: %+v", m.Edits)
+			}
+		})
+	}
+}
+
+func TestTokenStoreSaveMessages(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "store-batch-test-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	ts, err := newTokenStore(tmpDir, "test-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Close()
+
+	first, err := ts.Save("notice", "前", "before", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgs := []*Message{
+		{Topic: "report", Title: "host-1", Content: "ok"},
+		{Topic: "report", Title: "host-2", Content: "ok", Key: "host-2"},
+		{Topic: "report", Title: "host-3", Content: "disk 91%"},
+	}
+	saved, err := ts.SaveMessages(msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range saved {
+		if m.ID <= first.ID || (i > 0 && m.ID <= saved[i-1].ID) {
+			t.Errorf("ID 应递增: %d -> %d", first.ID, m.ID)
+		}
+		got, err := ts.Get(m.ID)
+		if err != nil || got.Title != m.Title {
+			t.Errorf("Get(%d) = %+v, %v", m.ID, got, err)
+		}
+	}
+
+	got, err := ts.GetByKey("host-2")
+	if err != nil || got.ID != saved[1].ID {
+		t.Errorf("GetByKey = %+v, %v", got, err)
+	}
+	if ts.Count() != 4 {
+		t.Errorf("Count = %d, want 4", ts.Count())
+	}
+
+	if res, err := ts.SaveMessages(nil); err != nil || len(res) != 0 {
+		t.Errorf("空批量应直接返回: %v, %v", res, err)
+	}
+}